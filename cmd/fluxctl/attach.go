@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/yourusername/fluxterm/pkg/client"
+	"github.com/yourusername/fluxterm/pkg/protocol/ws"
+	"golang.org/x/term"
+)
+
+// escapeChar detaches the terminal from a session (Ctrl-])
+const escapeChar = 0x1d
+
+// runOpen opens a session, connects it to a serial port or SSH host and
+// attaches the terminal to it
+func runOpen(ctx context.Context, c *client.Client, args []string) error {
+	fs := newFlagSet("open")
+	sessionID := fs.String("session", "", "Session ID (default: chosen by the backend)")
+	detachGrace := fs.Int("detach-grace", -1, "Seconds the connection outlives a detached terminal; -1 uses the backend's default")
+
+	port := fs.String("port", "", "Serial port to open")
+	baudRate := fs.Int("baud", 115200, "Baud rate")
+	dataBits := fs.Int("data-bits", 8, "Data bits (5-8)")
+	stopBits := fs.Float64("stop-bits", 1, "Stop bits (1, 1.5 or 2)")
+	parity := fs.String("parity", "none", "Parity: none, odd, even, mark or space")
+	flowControl := fs.String("flow", "none", "Flow control, only none is supported")
+
+	target := fs.String("ssh", "", "SSH target as [user@]host[:port]")
+	alias := fs.String("alias", "", "Host from the backend's ~/.ssh/config")
+	identity := fs.String("identity", "", "Private key file, sent to the backend")
+	authMethod := fs.String("auth", "", "Auth method: password, publickey, keyboard-interactive or agent")
+	jump := fs.String("jump", "", "Comma-separated jump hosts as [user@]host[:port]")
+	forwardAgent := fs.Bool("forward-agent", false, "Forward the backend's SSH agent")
+
+	if err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+	if (*port != "") == (*target != "" || *alias != "") {
+		fmt.Fprintln(fs.Output(), "Either -port or -ssh/-alias is required")
+		fs.Usage()
+		return errUsage
+	}
+
+	var detach ws.DetachParams
+	if *detachGrace >= 0 {
+		detach.DetachGrace = detachGrace
+	}
+
+	conn, err := c.Dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	session, err := conn.OpenSession(ctx, *sessionID)
+	if err != nil {
+		return err
+	}
+	session.SetPromptHandler(promptTerminal)
+
+	if *port != "" {
+		err = session.Connect(ctx, ws.ConnectParams{
+			Port:         *port,
+			BaudRate:     *baudRate,
+			DataBits:     *dataBits,
+			StopBits:     *stopBits,
+			Parity:       *parity,
+			FlowControl:  *flowControl,
+			DetachParams: detach,
+		})
+	} else {
+		params := ws.ConnectSSHParams{
+			HostAlias:    *alias,
+			AuthMethod:   *authMethod,
+			ForwardAgent: *forwardAgent,
+			TerminalType: getEnv("TERM", "xterm-256color"),
+			DetachParams: detach,
+		}
+		if *identity != "" {
+			key, err := os.ReadFile(*identity)
+			if err != nil {
+				return err
+			}
+			params.PrivateKey = string(key)
+		}
+		if *target != "" {
+			if params.Username, params.Host, params.Port, err = parseSSHTarget(*target); err != nil {
+				return err
+			}
+		}
+		if *jump != "" {
+			for _, hop := range strings.Split(*jump, ",") {
+				var jumpHost ws.ConnectSSHParams
+				if jumpHost.Username, jumpHost.Host, jumpHost.Port, err = parseSSHTarget(hop); err != nil {
+					return err
+				}
+				params.JumpHosts = append(params.JumpHosts, jumpHost)
+			}
+		}
+		if cols, rows, err := terminalSize(os.Stdin); err == nil {
+			params.Cols, params.Rows = cols, rows
+		}
+		if *authMethod == "password" {
+			if params.Password, err = readAnswer(fmt.Sprintf("Password for %s: ", *target), false); err != nil {
+				return err
+			}
+		}
+		err = session.ConnectSSH(ctx, params)
+	}
+	if err != nil {
+		session.Close(context.Background())
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Opened session %s\n", session.ID)
+	detached, err := attachTerminal(ctx, session, true)
+	if err == nil && !detached {
+		// The connection ended; the session is of no further use
+		session.Close(context.Background())
+	}
+	return err
+}
+
+// runAttach attaches the terminal to an existing session, taking it over
+// as its owner or joining it as a writer or observer
+func runAttach(ctx context.Context, c *client.Client, args []string) error {
+	fs := newFlagSet("attach")
+	mode := fs.String("mode", "owner", "Attach as owner, writer or observer (read-only)")
+	if err := parseArgs(fs, args, 1); err != nil {
+		return err
+	}
+
+	conn, err := c.Dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var session *client.Session
+	switch *mode {
+	case "owner":
+		session, err = conn.AttachSession(ctx, fs.Arg(0))
+	case ws.ModeWriter, ws.ModeObserver:
+		session, err = conn.JoinSession(ctx, fs.Arg(0), *mode)
+	default:
+		fs.Usage()
+		return errUsage
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = attachTerminal(ctx, session, *mode != ws.ModeObserver)
+	return err
+}
+
+// attachTerminal copies the terminal's input to a session and its output to
+// the terminal until the session ends or the user detaches. Input is dropped
+// unless writable. It reports whether the user detached.
+func attachTerminal(ctx context.Context, session *client.Session, writable bool) (bool, error) {
+	fmt.Fprintf(os.Stderr, "Attached to session %s. Press Ctrl-] to detach.\n", session.ID)
+
+	if isTerminal(os.Stdin) {
+		restore, err := makeRaw(os.Stdin)
+		if err != nil {
+			return false, err
+		}
+		defer restore()
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	// Only writers may resize; the terminal size is theirs to set
+	if writable {
+		if cols, rows, err := terminalSize(os.Stdin); err == nil {
+			session.Resize(cols, rows)
+		}
+		go watchResize(os.Stdin, stop, func(cols, rows int) {
+			session.Resize(cols, rows)
+		})
+	}
+
+	// A lost connection ends the attachment; SSH reconnects only report
+	lost := make(chan struct{}, 1)
+	session.SetStatusHandler(func(status ws.StatusPayload) {
+		switch status.State {
+		case "attached", "encoding", "closed", "detached":
+			return
+		}
+		fmt.Fprintf(os.Stderr, "\r\n[fluxctl] %s\r\n", statusMessage(status))
+		if status.State == "disconnected" {
+			select {
+			case lost <- struct{}{}:
+			default:
+			}
+		}
+	})
+
+	output := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(os.Stdout, session)
+		output <- err
+	}()
+
+	detach := make(chan struct{})
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if n > 0 {
+				data := buf[:n]
+				i := bytes.IndexByte(data, escapeChar)
+				if i >= 0 {
+					data = data[:i]
+				}
+				if writable && len(data) > 0 {
+					if _, err := session.Write(data); err != nil && !errors.Is(err, client.ErrDisconnected) {
+						return
+					}
+				}
+				if i >= 0 {
+					close(detach)
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var err error
+	detached := false
+	select {
+	case <-detach:
+		detached = true
+	case err = <-output:
+		if cause := session.Err(); !errors.Is(cause, client.ErrSessionClosed) {
+			err = cause
+		}
+	case <-lost:
+	case <-ctx.Done():
+	}
+
+	fmt.Fprint(os.Stderr, "\r\n")
+	if detached {
+		fmt.Fprintf(os.Stderr, "Detached from session %s\r\n", session.ID)
+	}
+	return detached, err
+}
+
+// statusMessage describes a status message for the user
+func statusMessage(status ws.StatusPayload) string {
+	msg := status.Message
+	if msg == "" {
+		msg = status.State
+	}
+	if status.Reason != "" {
+		msg += ": " + status.Reason
+	}
+	if status.ExitCode != nil {
+		msg += fmt.Sprintf(" (exit code %d)", *status.ExitCode)
+	} else if status.ExitSignal != "" {
+		msg += fmt.Sprintf(" (signal %s)", status.ExitSignal)
+	}
+	return msg
+}
+
+// promptTerminal answers keyboard-interactive challenges on the terminal
+func promptTerminal(prompt ws.AuthPromptPayload) ([]string, error) {
+	if prompt.Instruction != "" {
+		fmt.Fprintln(os.Stderr, prompt.Instruction)
+	}
+
+	answers := make([]string, len(prompt.Questions))
+	for i, question := range prompt.Questions {
+		answer, err := readAnswer(question.Prompt, question.Echo)
+		if err != nil {
+			return nil, err
+		}
+		answers[i] = answer
+	}
+	return answers, nil
+}
+
+// readAnswer reads a line from the terminal, without echoing it unless
+// echo is set. It reads a byte at a time, as term.ReadPassword does too, so
+// no input meant for the session is consumed.
+func readAnswer(prompt string, echo bool) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	if !echo && isTerminal(os.Stdin) {
+		answer, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		return string(answer), err
+	}
+
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := os.Stdin.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+		}
+		if err != nil {
+			if err == io.EOF && len(line) > 0 {
+				break
+			}
+			return "", err
+		}
+	}
+	return strings.TrimSuffix(string(line), "\r"), nil
+}
+
+// parseSSHTarget splits [user@]host[:port]
+func parseSSHTarget(target string) (string, string, int, error) {
+	var user string
+	if i := strings.LastIndex(target, "@"); i >= 0 {
+		user, target = target[:i], target[i+1:]
+	}
+
+	host, portStr, err := net.SplitHostPort(target)
+	if err != nil {
+		// No port; strip the brackets of an IPv6 address
+		return user, strings.Trim(target, "[]"), 0, nil
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("invalid SSH port %q", portStr)
+	}
+	return user, host, port, nil
+}
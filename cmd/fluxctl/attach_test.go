@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/yourusername/fluxterm/pkg/protocol/ws"
+)
+
+func TestParseSSHTarget(t *testing.T) {
+	tests := []struct {
+		target string
+		user   string
+		host   string
+		port   int
+	}{
+		{"example.com", "", "example.com", 0},
+		{"alice@example.com", "alice", "example.com", 0},
+		{"alice@example.com:2222", "alice", "example.com", 2222},
+		{"alice@corp@example.com", "alice@corp", "example.com", 0},
+		{"[::1]", "", "::1", 0},
+		{"root@[::1]:22", "root", "::1", 22},
+	}
+
+	for _, tt := range tests {
+		user, host, port, err := parseSSHTarget(tt.target)
+		if err != nil {
+			t.Errorf("parseSSHTarget(%q): %v", tt.target, err)
+			continue
+		}
+		if user != tt.user || host != tt.host || port != tt.port {
+			t.Errorf("parseSSHTarget(%q) = %q, %q, %d, want %q, %q, %d",
+				tt.target, user, host, port, tt.user, tt.host, tt.port)
+		}
+	}
+
+	if _, _, _, err := parseSSHTarget("example.com:ssh"); err == nil {
+		t.Error("parseSSHTarget accepted a non-numeric port")
+	}
+}
+
+func TestStatusMessage(t *testing.T) {
+	code := 3
+	tests := []struct {
+		status ws.StatusPayload
+		want   string
+	}{
+		{ws.StatusPayload{State: "connected"}, "connected"},
+		{ws.StatusPayload{State: "disconnected", Message: "SSH disconnected", Reason: "connection lost"}, "SSH disconnected: connection lost"},
+		{ws.StatusPayload{State: "disconnected", Reason: "process exited with 3", ExitCode: &code}, "disconnected: process exited with 3 (exit code 3)"},
+		{ws.StatusPayload{State: "disconnected", ExitSignal: "TERM"}, "disconnected (signal TERM)"},
+	}
+
+	for _, tt := range tests {
+		if got := statusMessage(tt.status); got != tt.want {
+			t.Errorf("statusMessage(%+v) = %q, want %q", tt.status, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/yourusername/fluxterm/pkg/client"
+	"github.com/yourusername/fluxterm/pkg/protocol/ws"
+)
+
+// runPorts lists the serial ports of the backend's machine
+func runPorts(ctx context.Context, c *client.Client, args []string) error {
+	if err := parseArgs(newFlagSet("ports"), args, 0); err != nil {
+		return err
+	}
+
+	ports, err := c.ListPorts(ctx)
+	if err != nil {
+		return err
+	}
+	open, err := c.ListOpenPorts(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tDESCRIPTION\tUSB ID\tSERIAL\tOPEN")
+	for _, port := range ports {
+		usbID := "-"
+		if port.IsUSB {
+			usbID = port.VID + ":" + port.PID
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", port.Name, orDash(port.Description), usbID,
+			orDash(port.SerialNumber), yesNo(slices.Contains(open, port.Name)))
+	}
+	return w.Flush()
+}
+
+// runSessions lists the backend's sessions
+func runSessions(ctx context.Context, c *client.Client, args []string) error {
+	if err := parseArgs(newFlagSet("sessions"), args, 0); err != nil {
+		return err
+	}
+
+	sessions, err := c.ListSessions(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SESSION\tTYPE\tSTATE\tSUBSCRIBERS\tOUTPUT")
+	for _, session := range sessions {
+		state := "attached"
+		if session.Detached {
+			state = "detached"
+		}
+
+		var subscribers []string
+		for _, sub := range session.Subscribers {
+			if sub.Client != "" {
+				subscribers = append(subscribers, fmt.Sprintf("%s (%s)", sub.Role, sub.Client))
+			} else {
+				subscribers = append(subscribers, sub.Role)
+			}
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\n", session.SessionID, orDash(session.ConnType), state,
+			orDash(strings.Join(subscribers, ", ")), session.OutputOffset)
+	}
+	return w.Flush()
+}
+
+// runTail prints a session's scrollback and follows its output as an
+// observer, until the session closes or fluxctl is interrupted
+func runTail(ctx context.Context, c *client.Client, args []string) error {
+	fs := newFlagSet("tail")
+	if err := parseArgs(fs, args, 1); err != nil {
+		return err
+	}
+
+	conn, err := c.Dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	session, err := conn.JoinSession(ctx, fs.Arg(0), ws.ModeObserver)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-session.Done():
+		}
+	}()
+
+	if _, err := io.Copy(os.Stdout, session); err != nil {
+		return err
+	}
+	if err := session.Err(); !errors.Is(err, client.ErrSessionClosed) && !errors.Is(err, client.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+// runSend sends a file over the serial port of a session, joining it as a
+// writer for the duration of the transfer
+func runSend(ctx context.Context, c *client.Client, args []string) error {
+	fs := newFlagSet("send")
+	protocol := fs.String("protocol", "", "Transfer protocol: xmodem, xmodem1k or ymodem (default XMODEM-CRC)")
+	if err := parseArgs(fs, args, 2); err != nil {
+		return err
+	}
+
+	path := fs.Arg(1)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	name := filepath.Base(path)
+
+	conn, err := c.Dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	session, err := conn.JoinSession(ctx, fs.Arg(0), ws.ModeWriter)
+	if err != nil {
+		return err
+	}
+	defer session.Close(context.Background())
+
+	err = session.SendFile(ctx, name, data, *protocol, func(progress ws.FileTransferPayload) {
+		if progress.Action == "progress" && progress.FileSize > 0 {
+			fmt.Fprintf(os.Stderr, "\r%s: %d/%d bytes (%d%%)", name, progress.Sent, progress.FileSize,
+				progress.Sent*100/progress.FileSize)
+		}
+	})
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "%s: sent %d bytes\n", name, len(data))
+	return nil
+}
+
+// runLog starts, stops or reports the logging of a session's output
+func runLog(ctx context.Context, c *client.Client, args []string) error {
+	fs := newFlagSet("log")
+	format := fs.String("format", "", "Log format: plain, timestamped or hex (default plain)")
+	fileName := fs.String("file", "", "File name template below the backend's log directory")
+	maxSize := fs.Int64("max-size", -1, "Bytes per file before rotating, 0 for no limit (-1 for the backend default)")
+	interval := fs.Duration("rotate", 0, "Rotate files of this age, e.g. 1h")
+	maxFiles := fs.Int("max-files", -1, "Files kept, 0 for all (-1 for the backend default)")
+	if err := parseArgs(fs, args, 2); err != nil {
+		return err
+	}
+
+	var status *client.LogStatus
+	var err error
+	switch fs.Arg(1) {
+	case "start":
+		params := ws.StartLogParams{
+			Format:         *format,
+			FileName:       *fileName,
+			RotateInterval: int(interval.Seconds()),
+		}
+		if *maxSize >= 0 {
+			params.MaxSize = maxSize
+		}
+		if *maxFiles >= 0 {
+			params.MaxFiles = maxFiles
+		}
+		status, err = c.StartSessionLog(ctx, fs.Arg(0), params)
+	case "stop":
+		status, err = c.StopSessionLog(ctx, fs.Arg(0))
+	case "status":
+		status, err = c.SessionLog(ctx, fs.Arg(0))
+	default:
+		fs.Usage()
+		return errUsage
+	}
+	if err != nil {
+		return err
+	}
+
+	if status == nil {
+		fmt.Println("Not logging")
+		return nil
+	}
+	fmt.Printf("%s (%s, %d bytes logged, %d files)\n", status.Path, status.Format, status.BytesLogged, status.Files)
+	if status.Error != "" {
+		fmt.Printf("Failed: %s\n", status.Error)
+	}
+	return nil
+}
+
+// runDTR sets the DTR line of a serial port
+func runDTR(ctx context.Context, c *client.Client, args []string) error {
+	fs := newFlagSet("dtr")
+	if err := parseArgs(fs, args, 2); err != nil {
+		return err
+	}
+
+	value, err := parseOnOff(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	return c.SetDTR(ctx, fs.Arg(0), value)
+}
+
+// runRTS sets the RTS line of a serial port
+func runRTS(ctx context.Context, c *client.Client, args []string) error {
+	fs := newFlagSet("rts")
+	if err := parseArgs(fs, args, 2); err != nil {
+		return err
+	}
+
+	value, err := parseOnOff(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	return c.SetRTS(ctx, fs.Arg(0), value)
+}
+
+// parseOnOff parses the state of a modem control line
+func parseOnOff(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "on", "1", "true", "high":
+		return true, nil
+	case "off", "0", "false", "low":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid line state %q: must be on or off", s)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
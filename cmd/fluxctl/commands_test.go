@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/yourusername/fluxterm/pkg/client"
+)
+
+// newTestClient returns a client for a backend served by handler
+func newTestClient(t *testing.T, handler http.HandlerFunc) *client.Client {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	c, err := client.New(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// captureStdout returns what fn prints to stdout
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		output <- string(data)
+	}()
+
+	fn()
+	w.Close()
+	return <-output
+}
+
+func TestRunSessions(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/ws/sessions" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"success": true, "sessions": [
+			{"session_id": "lab", "conn_type": "serial", "output_offset": 42,
+			 "subscribers": [{"role": "owner", "client": "fluxctl"}, {"role": "observer"}]},
+			{"session_id": "old", "detached": true, "subscribers": []}
+		]}`))
+	})
+
+	var err error
+	output := captureStdout(t, func() {
+		err = runSessions(context.Background(), c, nil)
+	})
+	if err != nil {
+		t.Fatalf("runSessions: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("printed %d lines, want a header and 2 sessions:\n%s", len(lines), output)
+	}
+	if fields := strings.Fields(lines[1]); strings.Join(fields, " ") != "lab serial attached owner (fluxctl), observer 42" {
+		t.Errorf("session line = %q", lines[1])
+	}
+	if fields := strings.Fields(lines[2]); strings.Join(fields, " ") != "old - detached - 0" {
+		t.Errorf("detached session line = %q", lines[2])
+	}
+}
+
+func TestRunDTR(t *testing.T) {
+	var path string
+	var body map[string]bool
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.EscapedPath()
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Write([]byte(`{"success": true}`))
+	})
+
+	if err := runDTR(context.Background(), c, []string{"/dev/ttyUSB0", "off"}); err != nil {
+		t.Fatalf("runDTR: %v", err)
+	}
+	if path != "/api/v1/ports/%2Fdev%2FttyUSB0/dtr" {
+		t.Errorf("requested %s", path)
+	}
+	if value, ok := body["value"]; !ok || value {
+		t.Errorf("body = %v, want value false", body)
+	}
+
+	if err := runDTR(context.Background(), c, []string{"/dev/ttyUSB0", "maybe"}); err == nil {
+		t.Error("runDTR accepted an invalid line state")
+	}
+	if err := runDTR(context.Background(), c, []string{"/dev/ttyUSB0"}); !errors.Is(err, errUsage) {
+		t.Errorf("runDTR without a state = %v, want errUsage", err)
+	}
+}
+
+func TestRunDTRError(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error": "Port not open"}`))
+	})
+
+	err := runDTR(context.Background(), c, []string{"COM3", "on"})
+	var apiErr *client.APIError
+	if !errors.As(err, &apiErr) || apiErr.Message != "Port not open" {
+		t.Errorf("runDTR error = %v, want the backend's message", err)
+	}
+}
@@ -0,0 +1,134 @@
+// Command fluxctl drives a running FluxTerm backend from the command line.
+// Sessions it opens can be shared with the GUI and vice versa.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/yourusername/fluxterm/pkg/client"
+)
+
+const defaultServer = "http://127.0.0.1:8080"
+
+// command is a fluxctl subcommand
+type command struct {
+	name  string
+	args  string
+	usage string
+	run   func(ctx context.Context, c *client.Client, args []string) error
+}
+
+// commands lists the subcommands; filled in init since they refer to it
+// for their usage
+var commands []command
+
+func init() {
+	commands = []command{
+		{"ports", "", "List serial ports", runPorts},
+		{"sessions", "", "List sessions, including detached ones", runSessions},
+		{"open", "[flags]", "Open a session on a serial port or SSH host and attach the terminal", runOpen},
+		{"attach", "[flags] SESSION", "Attach the terminal to an existing session", runAttach},
+		{"tail", "SESSION", "Print a session's scrollback and follow its output", runTail},
+		{"send", "[flags] SESSION FILE", "Send a file over a session's serial port", runSend},
+		{"log", "[flags] SESSION start|stop|status", "Log a session's output on the backend", runLog},
+		{"dtr", "PORT on|off", "Set the DTR line of a serial port", runDTR},
+		{"rts", "PORT on|off", "Set the RTS line of a serial port", runRTS},
+	}
+}
+
+// errUsage reports invalid arguments; the command's usage has been printed
+var errUsage = errors.New("invalid arguments")
+
+func main() {
+	server := flag.String("server", getEnv("FLUXTERM_URL", defaultServer), "FluxTerm backend URL (env FLUXTERM_URL)")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := flag.Arg(0)
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == name {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "fluxctl: unknown command %q\n\n", name)
+		usage()
+		os.Exit(2)
+	}
+
+	c, err := client.New(*server)
+	if err != nil {
+		fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := cmd.run(ctx, c, flag.Args()[1:]); err != nil {
+		if errors.Is(err, errUsage) {
+			os.Exit(2)
+		}
+		fatal(err)
+	}
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: fluxctl [-server URL] COMMAND [ARGS]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-10s %s\n", cmd.name, cmd.usage)
+	}
+	fmt.Fprintf(out, "\nRun 'fluxctl COMMAND -h' for the flags of a command.\n\nGlobal flags:\n")
+	flag.PrintDefaults()
+}
+
+// newFlagSet creates the flag set of a command
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		for _, cmd := range commands {
+			if cmd.name == name {
+				fmt.Fprintf(fs.Output(), "Usage: fluxctl %s %s\n\n%s\n", cmd.name, cmd.args, cmd.usage)
+			}
+		}
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseArgs parses the flags of a command and checks the number of
+// positional args
+func parseArgs(fs *flag.FlagSet, args []string, nargs int) error {
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() != nargs {
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "fluxctl: %v\n", err)
+	os.Exit(1)
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
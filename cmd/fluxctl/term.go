@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os"
+
+	"golang.org/x/term"
+)
+
+// isTerminal reports whether the file is a terminal
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// makeRaw puts a terminal into raw mode and returns a function restoring
+// its previous state
+func makeRaw(f *os.File) (func(), error) {
+	fd := int(f.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, err
+	}
+	restoreOutput := enableVirtualTerminal()
+
+	return func() {
+		restoreOutput()
+		term.Restore(fd, state)
+	}, nil
+}
@@ -0,0 +1,42 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/term"
+)
+
+// enableVirtualTerminal lets the terminal interpret the remote side's escape
+// sequences, which Unix terminals already do
+func enableVirtualTerminal() func() {
+	return func() {}
+}
+
+// terminalSize returns the columns and rows of a terminal
+func terminalSize(f *os.File) (int, int, error) {
+	return term.GetSize(int(f.Fd()))
+}
+
+// watchResize calls fn whenever the terminal is resized, until stop is
+// closed
+func watchResize(f *os.File, stop <-chan struct{}, fn func(cols, rows int)) {
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	defer signal.Stop(winch)
+
+	for {
+		select {
+		case <-winch:
+			if cols, rows, err := terminalSize(f); err == nil {
+				fn(cols, rows)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,53 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/term"
+)
+
+// enableVirtualTerminal lets the console interpret the remote side's escape
+// sequences and returns a function restoring its previous mode
+func enableVirtualTerminal() func() {
+	out := windows.Handle(os.Stdout.Fd())
+	var mode uint32
+	if windows.GetConsoleMode(out, &mode) != nil {
+		return func() {}
+	}
+	windows.SetConsoleMode(out, mode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING)
+	return func() { windows.SetConsoleMode(out, mode) }
+}
+
+// terminalSize returns the columns and rows of the console window. The size
+// belongs to the screen buffer, so it is read from stdout whatever f is.
+func terminalSize(f *os.File) (int, int, error) {
+	return term.GetSize(int(os.Stdout.Fd()))
+}
+
+// watchResize calls fn whenever the console window is resized, until stop
+// is closed. Windows has no resize signal, so the size is polled.
+func watchResize(f *os.File, stop <-chan struct{}, fn func(cols, rows int)) {
+	lastCols, lastRows, _ := terminalSize(f)
+
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			cols, rows, err := terminalSize(f)
+			if err != nil || (cols == lastCols && rows == lastRows) {
+				continue
+			}
+			lastCols, lastRows = cols, rows
+			fn(cols, rows)
+		case <-stop:
+			return
+		}
+	}
+}
@@ -8,6 +8,8 @@ require (
 	github.com/wailsapp/wails/v2 v2.11.0
 	go.bug.st/serial v1.6.4
 	golang.org/x/crypto v0.46.0
+	golang.org/x/sys v0.40.0
+	golang.org/x/term v0.38.0
 )
 
 require (
@@ -58,7 +60,6 @@ require (
 	go.uber.org/mock v0.6.0 // indirect
 	golang.org/x/arch v0.23.0 // indirect
 	golang.org/x/net v0.48.0 // indirect
-	golang.org/x/sys v0.40.0 // indirect
 	golang.org/x/text v0.33.0 // indirect
 	google.golang.org/protobuf v1.36.11 // indirect
 )
@@ -0,0 +1,297 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/fluxterm/internal/core/sessionlog"
+	"github.com/yourusername/fluxterm/pkg/protocol/ws"
+)
+
+// WSLogResponse represents the response for session log requests
+type WSLogResponse struct {
+	Success bool               `json:"success"`
+	Message string             `json:"message"`
+	Log     *sessionlog.Status `json:"log,omitempty"`
+}
+
+// SetLogDirectory sets the directory session logs are written below
+func (h *WebSocketHandler) SetLogDirectory(dir string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.logDir = dir
+}
+
+// logFormats lists the supported session log formats
+var logFormats = []string{ws.LogFormatPlain, ws.LogFormatTimestamped, ws.LogFormatHex}
+
+// logConfig builds a logger configuration from start_log params
+func (h *WebSocketHandler) logConfig(params ws.StartLogParams) sessionlog.Config {
+	config := sessionlog.DefaultConfig()
+
+	h.mu.RLock()
+	config.Directory = h.logDir
+	h.mu.RUnlock()
+
+	if params.Format != "" {
+		config.Format = sessionlog.Format(params.Format)
+	}
+	if params.FileName != "" {
+		config.FileName = params.FileName
+	}
+	if params.MaxSize != nil {
+		config.MaxSize = *params.MaxSize
+	}
+	if params.MaxFiles != nil {
+		config.MaxFiles = *params.MaxFiles
+	}
+	config.RotateInterval = time.Duration(params.RotateInterval) * time.Second
+	return config
+}
+
+// startLog starts logging a session's output, replacing its current logger
+func (h *WebSocketHandler) startLog(session *Session, params ws.StartLogParams) (*sessionlog.Logger, error) {
+	logger, err := sessionlog.New(session.ID, h.logConfig(params))
+	if err != nil {
+		return nil, err
+	}
+
+	session.outMu.Lock()
+	previous := session.logger
+	session.logger = logger
+	session.outMu.Unlock()
+
+	if previous != nil {
+		previous.Close()
+	}
+
+	log.Printf("[%s] Logging to %s", session.ID, logger.Status().Path)
+	return logger, nil
+}
+
+// stopLog stops logging a session's output, returning the final status of
+// the logger if there was one
+func (h *WebSocketHandler) stopLog(session *Session) (*sessionlog.Status, bool) {
+	session.outMu.Lock()
+	logger := session.logger
+	session.logger = nil
+	session.outMu.Unlock()
+
+	if logger == nil {
+		return nil, false
+	}
+	if err := logger.Close(); err != nil {
+		log.Printf("[%s] Failed to close log: %v", session.ID, err)
+	}
+
+	status := logger.Status()
+	log.Printf("[%s] Logging stopped (%d bytes logged)", session.ID, status.BytesLogged)
+	return &status, true
+}
+
+// writeLog logs session output. A logger that fails is detached and the
+// failure announced to the subscribers.
+func (h *WebSocketHandler) writeLog(session *Session, logger *sessionlog.Logger, data []byte) {
+	if _, err := logger.Write(data); err == nil {
+		return
+	}
+
+	// The logger may have been stopped meanwhile, which isn't a failure
+	session.outMu.Lock()
+	current := session.logger == logger
+	if current {
+		session.logger = nil
+	}
+	session.outMu.Unlock()
+	if !current {
+		return
+	}
+
+	status := logger.Status()
+	log.Printf("[%s] Logging failed: %s", session.ID, status.Error)
+	h.sendStatusPayload(session, ws.StatusPayload{
+		State:   "log_stopped",
+		Message: "Logging failed",
+		Reason:  status.Error,
+	})
+}
+
+// logStatus returns the status of a session's logger, if it has one
+func (s *Session) logStatus() *sessionlog.Status {
+	s.outMu.Lock()
+	logger := s.logger
+	s.outMu.Unlock()
+
+	if logger == nil {
+		return nil
+	}
+	status := logger.Status()
+	return &status
+}
+
+// checkLogFormat reports whether a requested log format is supported,
+// replying with the supported ones when it isn't
+func (h *WebSocketHandler) checkLogFormat(req *request, format string) bool {
+	if format != "" && !slices.Contains(logFormats, format) {
+		h.replyErrorPayload(req, ws.ErrorPayload{
+			Code:      ws.ErrCodeUnsupportedLogFormat,
+			Message:   "Unsupported log format",
+			Field:     "format",
+			Supported: logFormats,
+		})
+		return false
+	}
+	return true
+}
+
+// handleStartLog starts logging the session's output on the backend
+func (h *WebSocketHandler) handleStartLog(req *request, params ws.StartLogParams) {
+	if !h.checkLogFormat(req, params.Format) {
+		return
+	}
+
+	logger, err := h.startLog(req.session(), params)
+	if err != nil {
+		h.replyError(req, "LOG_FAILED", err.Error())
+		return
+	}
+
+	h.replyStatus(req, "logging", "Logging to "+logger.Status().Path)
+}
+
+// handleStopLog stops logging the session's output
+func (h *WebSocketHandler) handleStopLog(req *request) {
+	status, ok := h.stopLog(req.session())
+	if !ok {
+		h.replyError(req, "NOT_LOGGING", "Session is not being logged")
+		return
+	}
+
+	h.replyStatus(req, "log_stopped", fmt.Sprintf("Logged %d bytes to %s", status.BytesLogged, status.Path))
+}
+
+// getSession looks up the session named in the request path, replying 404
+// when it doesn't exist
+func (h *WebSocketHandler) getSession(c *gin.Context) (*Session, bool) {
+	h.mu.RLock()
+	session, exists := h.sessions[c.Param("session_id")]
+	h.mu.RUnlock()
+
+	if !exists {
+		c.JSON(http.StatusNotFound, WSLogResponse{
+			Success: false,
+			Message: "Session not found",
+		})
+		return nil, false
+	}
+	return session, true
+}
+
+// GetSessionLog handles GET /api/v1/ws/sessions/:session_id/log
+func (h *WebSocketHandler) GetSessionLog(c *gin.Context) {
+	session, ok := h.getSession(c)
+	if !ok {
+		return
+	}
+
+	status := session.logStatus()
+	if status == nil {
+		c.JSON(http.StatusOK, WSLogResponse{
+			Success: true,
+			Message: "Session is not being logged",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, WSLogResponse{
+		Success: true,
+		Message: "Session is being logged",
+		Log:     status,
+	})
+}
+
+// StartSessionLog handles POST /api/v1/ws/sessions/:session_id/log
+func (h *WebSocketHandler) StartSessionLog(c *gin.Context) {
+	session, ok := h.getSession(c)
+	if !ok {
+		return
+	}
+
+	var params ws.StartLogParams
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&params); err != nil {
+			c.JSON(http.StatusBadRequest, WSLogResponse{
+				Success: false,
+				Message: "Invalid request: " + err.Error(),
+			})
+			return
+		}
+	}
+	if err := params.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, WSLogResponse{
+			Success: false,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+	if params.Format != "" && !slices.Contains(logFormats, params.Format) {
+		c.JSON(http.StatusBadRequest, WSLogResponse{
+			Success: false,
+			Message: fmt.Sprintf("Unsupported log format %q", params.Format),
+		})
+		return
+	}
+
+	logger, err := h.startLog(session, params)
+	if err != nil {
+		c.JSON(http.StatusOK, WSLogResponse{
+			Success: false,
+			Message: "Failed to start logging: " + err.Error(),
+		})
+		return
+	}
+
+	status := logger.Status()
+	h.sendStatusPayload(session, ws.StatusPayload{
+		State:   "logging",
+		Message: "Logging to " + status.Path,
+	})
+
+	c.JSON(http.StatusOK, WSLogResponse{
+		Success: true,
+		Message: "Logging started",
+		Log:     &status,
+	})
+}
+
+// StopSessionLog handles DELETE /api/v1/ws/sessions/:session_id/log
+func (h *WebSocketHandler) StopSessionLog(c *gin.Context) {
+	session, ok := h.getSession(c)
+	if !ok {
+		return
+	}
+
+	status, stopped := h.stopLog(session)
+	if !stopped {
+		c.JSON(http.StatusOK, WSLogResponse{
+			Success: false,
+			Message: "Session is not being logged",
+		})
+		return
+	}
+
+	h.sendStatusPayload(session, ws.StatusPayload{
+		State:   "log_stopped",
+		Message: fmt.Sprintf("Logged %d bytes to %s", status.BytesLogged, status.Path),
+	})
+
+	c.JSON(http.StatusOK, WSLogResponse{
+		Success: true,
+		Message: "Logging stopped",
+		Log:     status,
+	})
+}
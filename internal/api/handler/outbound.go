@@ -0,0 +1,191 @@
+package handler
+
+import "sync"
+
+// Flow control limits for a WebSocket session's outbound queue
+const (
+	dataHighWater   = 256 * 1024 // Pending data bytes before transports are paused
+	maxCoalesceSize = 32 * 1024  // Largest data message built from coalesced chunks
+)
+
+// QueueStats reports the state of a session's outbound queue
+type QueueStats struct {
+	Depth           int   `json:"depth"`            // Queued messages
+	PendingBytes    int   `json:"pending_bytes"`    // Queued terminal data
+	MaxDepth        int   `json:"max_depth"`        // Highest depth seen
+	MessagesSent    int64 `json:"messages_sent"`    // Messages handed to the writer
+	DataBytesSent   int64 `json:"data_bytes_sent"`  // Terminal data handed to the writer
+	ChunksCoalesced int64 `json:"chunks_coalesced"` // Data chunks merged into a queued message
+	Pauses          int64 `json:"pauses"`           // Times a transport was paused by backpressure
+	DataDropped     int64 `json:"data_dropped"`     // Terminal data skipped while an observer was behind
+}
+
+// outboundItem is a queued message: a prepared frame, or terminal data that
+// is encoded when written so consecutive chunks can be coalesced
+type outboundItem struct {
+	frame  outboundFrame
+	data   []byte
+	isData bool
+}
+
+// outboundQueue orders messages for the WebSocket writer. Control messages
+// are never dropped; terminal data is coalesced, and its producers either
+// block or have it dropped while too much of it is pending.
+type outboundQueue struct {
+	mu          sync.Mutex
+	space       *sync.Cond    // Signalled when pending data drains
+	ready       chan struct{} // Signalled when an item is queued; shared by a socket's queues
+	items       []*outboundItem
+	pendingData int
+	closed      bool
+	stats       QueueStats
+}
+
+// newOutboundQueue creates an empty queue that signals ready when items are
+// queued
+func newOutboundQueue(ready chan struct{}) *outboundQueue {
+	q := &outboundQueue{
+		ready: ready,
+	}
+	q.space = sync.NewCond(&q.mu)
+	return q
+}
+
+// push queues a prepared frame. It never blocks; it returns false once the
+// queue is closed.
+func (q *outboundQueue) push(frame outboundFrame) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return false
+	}
+
+	q.append(&outboundItem{frame: frame})
+	return true
+}
+
+// pushData queues terminal data, merging it into the last queued data
+// message when possible. It blocks while the pending data is above the high
+// water mark and returns false once the queue is closed.
+func (q *outboundQueue) pushData(data []byte) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	paused := false
+	for q.pendingData >= dataHighWater && !q.closed {
+		if !paused {
+			q.stats.Pauses++
+			paused = true
+		}
+		q.space.Wait()
+	}
+	if q.closed {
+		return false
+	}
+
+	q.appendData(data)
+	return true
+}
+
+// offerData queues terminal data like pushData, but never blocks: data that
+// arrives while the pending data is above the high water mark is dropped. It
+// returns false if the data was not queued.
+func (q *outboundQueue) offerData(data []byte) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return false
+	}
+	if q.pendingData >= dataHighWater {
+		q.stats.DataDropped += int64(len(data))
+		return false
+	}
+
+	q.appendData(data)
+	return true
+}
+
+// appendData adds terminal data, coalescing it with the last queued data
+// message when possible. Must be called with q.mu held.
+func (q *outboundQueue) appendData(data []byte) {
+	q.pendingData += len(data)
+	if n := len(q.items); n > 0 && q.items[n-1].isData && len(q.items[n-1].data)+len(data) <= maxCoalesceSize {
+		q.items[n-1].data = append(q.items[n-1].data, data...)
+		q.stats.ChunksCoalesced++
+		return
+	}
+
+	q.append(&outboundItem{data: append([]byte(nil), data...), isData: true})
+}
+
+// append adds an item and wakes the writer. Must be called with q.mu held.
+func (q *outboundQueue) append(item *outboundItem) {
+	q.items = append(q.items, item)
+	if len(q.items) > q.stats.MaxDepth {
+		q.stats.MaxDepth = len(q.items)
+	}
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// take removes the next item without waiting. It returns nil when the queue
+// is empty, and closed once the queue was closed.
+func (q *outboundQueue) take() (item *outboundItem, closed bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return nil, true
+	}
+	if len(q.items) == 0 {
+		return nil, false
+	}
+
+	item = q.items[0]
+	q.items[0] = nil
+	q.items = q.items[1:]
+
+	q.stats.MessagesSent++
+	if item.isData {
+		q.pendingData -= len(item.data)
+		q.stats.DataBytesSent += int64(len(item.data))
+		q.space.Broadcast()
+	}
+
+	return item, false
+}
+
+// close discards queued items and releases blocked producers
+func (q *outboundQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return
+	}
+	q.closed = true
+	q.items = nil
+	q.pendingData = 0
+	q.space.Broadcast()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Stats returns a snapshot of the queue state
+func (q *outboundQueue) Stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stats := q.stats
+	stats.Depth = len(q.items)
+	stats.PendingBytes = q.pendingData
+	return stats
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/yourusername/fluxterm/pkg/protocol/ws"
+)
+
+// drain takes every queued item, returning the terminal data and the status
+// states in order
+func drain(q *outboundQueue) (data []byte, states []string) {
+	for {
+		item, _ := q.take()
+		if item == nil {
+			return data, states
+		}
+		if item.isData {
+			data = append(data, item.data...)
+			continue
+		}
+
+		var msg ws.Message
+		var status ws.StatusPayload
+		json.Unmarshal(item.frame.data, &msg)
+		json.Unmarshal(msg.Payload, &status)
+		states = append(states, status.State)
+	}
+}
+
+func TestOfferDataDropsAboveHighWater(t *testing.T) {
+	q := newOutboundQueue(make(chan struct{}, 1))
+	chunk := make([]byte, maxCoalesceSize)
+
+	for i := 0; i < dataHighWater/maxCoalesceSize; i++ {
+		if !q.offerData(chunk) {
+			t.Fatalf("offer %d dropped below the high water mark", i)
+		}
+	}
+	if q.offerData([]byte("x")) {
+		t.Fatal("offer at the high water mark was queued")
+	}
+	if got := q.Stats().DataDropped; got != 1 {
+		t.Errorf("DataDropped = %d, want 1", got)
+	}
+
+	q.take()
+	if !q.offerData([]byte("x")) {
+		t.Error("offer after draining was dropped")
+	}
+
+	q.close()
+	if q.offerData([]byte("x")) {
+		t.Error("offer to a closed queue was queued")
+	}
+}
+
+func TestObserverResync(t *testing.T) {
+	h := &WebSocketHandler{}
+	session := &Session{ID: "s", output: newScrollback(scrollbackSize)}
+	sub := &subscriber{
+		session: session,
+		socket:  &Socket{ID: "w"},
+		queue:   newOutboundQueue(make(chan struct{}, 1)),
+		role:    RoleObserver,
+	}
+
+	// Record output until the observer falls behind, then some more
+	var all []byte
+	record := func(data []byte) {
+		start := session.output.offset()
+		session.output.write(data)
+		all = append(all, data...)
+		h.offerObserver(session, sub, data, start)
+	}
+	chunk := bytes.Repeat([]byte("a"), maxCoalesceSize)
+	for !sub.behind {
+		record(chunk)
+	}
+	missedFrom := sub.resumeFrom
+	record([]byte("more"))
+	if !sub.behind {
+		t.Fatal("observer caught up before its queue drained")
+	}
+
+	queued, states := drain(sub.queue)
+	if len(states) != 0 || !bytes.Equal(queued, all[:missedFrom]) {
+		t.Fatalf("queued %d bytes and %q before falling behind, want %d bytes", len(queued), states, missedFrom)
+	}
+
+	h.resyncObserver(sub)
+	if sub.behind {
+		t.Fatal("observer still behind after its queue drained")
+	}
+	replayed, states := drain(sub.queue)
+	if len(states) != 1 || states[0] != "resync" {
+		t.Errorf("states = %q, want a single resync", states)
+	}
+	if !bytes.Equal(replayed, all[missedFrom:]) {
+		t.Errorf("replayed %d bytes, want the %d missed", len(replayed), len(all)-int(missedFrom))
+	}
+
+	// Caught up, output is queued directly again
+	record([]byte("next"))
+	if data, _ := drain(sub.queue); string(data) != "next" {
+		t.Errorf("queued %q after catching up, want %q", data, "next")
+	}
+}
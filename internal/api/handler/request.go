@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/yourusername/fluxterm/pkg/protocol/ws"
+)
+
+// request is a client message being handled. Replies to it echo its ID so
+// the client can match them to the command that caused them.
+type request struct {
+	id        string // Chosen by the client; empty for uncorrelated messages
+	action    string // Control action, if any
+	sessionID string // Session the message named
+	socket    *Socket
+	sub       *subscriber // Subscription the message went through, once there is one
+}
+
+// newRequest starts handling a message received on a socket
+func newRequest(socket *Socket, msg ws.Message) *request {
+	return &request{
+		id:        msg.RequestID,
+		sessionID: msg.SessionID,
+		socket:    socket,
+	}
+}
+
+// session returns the session the request went through
+func (r *request) session() *Session {
+	return r.sub.session
+}
+
+// replyStatus broadcasts a status message answering a request to the
+// subscribers of its session
+func (h *WebSocketHandler) replyStatus(req *request, state, message string) {
+	h.replyStatusPayload(req, ws.StatusPayload{
+		State:   state,
+		Message: message,
+	})
+}
+
+// replyStatusPayload broadcasts a status message answering a request
+func (h *WebSocketHandler) replyStatusPayload(req *request, payload ws.StatusPayload) {
+	session := req.session()
+	session.push(replyFrame(ws.MsgTypeStatus, session.ID, req.id, payload))
+}
+
+// replyError sends an error answering a request to the requesting socket
+func (h *WebSocketHandler) replyError(req *request, code, message string) {
+	h.replyErrorPayload(req, ws.ErrorPayload{
+		Code:    code,
+		Message: message,
+	})
+}
+
+// replyErrorPayload sends an error with structured details to the requesting
+// socket, after the session's pending messages when it has one
+func (h *WebSocketHandler) replyErrorPayload(req *request, payload ws.ErrorPayload) {
+	if payload.Action == "" {
+		payload.Action = req.action
+	}
+
+	if req.sub != nil {
+		if req.sub.queue.push(replyFrame(ws.MsgTypeError, req.sub.session.ID, req.id, payload)) {
+			return
+		}
+	}
+	req.socket.control.push(replyFrame(ws.MsgTypeError, req.sessionID, req.id, payload))
+}
+
+// decodeParams reads the params of a control request into v, replying with
+// the failing field when they don't validate
+func (h *WebSocketHandler) decodeParams(req *request, raw json.RawMessage, v interface{}) bool {
+	err := ws.DecodeParams(raw, v)
+	if err == nil {
+		return true
+	}
+
+	payload := ws.ErrorPayload{
+		Code:    ws.ErrCodeInvalidParams,
+		Message: err.Error(),
+	}
+	var paramErr *ws.ParamError
+	if errors.As(err, &paramErr) {
+		payload.Field = paramErr.Field
+	}
+	h.replyErrorPayload(req, payload)
+	return false
+}
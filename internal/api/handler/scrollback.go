@@ -0,0 +1,62 @@
+package handler
+
+// scrollback keeps the most recent output of a session for replay. Offsets
+// count every byte written over the session's lifetime.
+type scrollback struct {
+	buf   []byte
+	start int   // Index of the oldest byte in buf
+	size  int   // Bytes held
+	total int64 // Bytes written so far
+}
+
+// newScrollback creates a scrollback holding up to capacity bytes
+func newScrollback(capacity int) *scrollback {
+	return &scrollback{buf: make([]byte, capacity)}
+}
+
+// write appends output, overwriting the oldest bytes when full
+func (s *scrollback) write(p []byte) {
+	s.total += int64(len(p))
+
+	capacity := len(s.buf)
+	if len(p) >= capacity {
+		copy(s.buf, p[len(p)-capacity:])
+		s.start = 0
+		s.size = capacity
+		return
+	}
+
+	end := (s.start + s.size) % capacity
+	n := copy(s.buf[end:], p)
+	copy(s.buf, p[n:])
+
+	s.size += len(p)
+	if s.size > capacity {
+		s.start = (s.start + s.size - capacity) % capacity
+		s.size = capacity
+	}
+}
+
+// since returns the output written after offset, along with the offset it
+// starts at, which is later than requested if that output was overwritten
+func (s *scrollback) since(offset int64) ([]byte, int64) {
+	oldest := s.total - int64(s.size)
+	if offset < oldest {
+		offset = oldest
+	}
+	if offset > s.total {
+		offset = s.total
+	}
+
+	n := int(s.total - offset)
+	data := make([]byte, n)
+	from := (s.start + s.size - n) % len(s.buf)
+	copied := copy(data, s.buf[from:])
+	copy(data[copied:], s.buf)
+	return data, offset
+}
+
+// offset returns the number of bytes written so far
+func (s *scrollback) offset() int64 {
+	return s.total
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestScrollbackSince(t *testing.T) {
+	tests := []struct {
+		name      string
+		capacity  int
+		writes    []string
+		offset    int64
+		want      string
+		wantStart int64
+	}{
+		{"empty", 8, nil, 0, "", 0},
+		{"all", 8, []string{"abc", "de"}, 0, "abcde", 0},
+		{"from offset", 8, []string{"abc", "de"}, 3, "de", 3},
+		{"up to date", 8, []string{"abc"}, 3, "", 3},
+		{"offset ahead", 8, []string{"abc"}, 10, "", 3},
+		{"negative offset", 8, []string{"abc"}, -5, "abc", 0},
+		{"exactly full", 8, []string{"abcd", "efgh"}, 0, "abcdefgh", 0},
+		{"wrapped", 8, []string{"abcdef", "ghij"}, 0, "cdefghij", 2},
+		{"wrapped from offset", 8, []string{"abcdef", "ghij"}, 5, "fghij", 5},
+		{"overwritten offset", 8, []string{"abcdef", "ghij"}, 1, "cdefghij", 2},
+		{"write larger than capacity", 4, []string{"ab", "cdefghij"}, 0, "ghij", 6},
+		{"write of capacity", 4, []string{"ab", "cdef"}, 0, "cdef", 2},
+		{"many wraps", 3, []string{"ab", "cd", "ef", "gh", "i"}, 0, "ghi", 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newScrollback(tt.capacity)
+			for _, w := range tt.writes {
+				s.write([]byte(w))
+			}
+
+			data, start := s.since(tt.offset)
+			if string(data) != tt.want || start != tt.wantStart {
+				t.Errorf("since(%d) = %q, %d, want %q, %d", tt.offset, data, start, tt.want, tt.wantStart)
+			}
+			if want := int64(len(strings.Join(tt.writes, ""))); s.offset() != want {
+				t.Errorf("offset() = %d, want %d", s.offset(), want)
+			}
+		})
+	}
+}
+
+// TestScrollbackRandom compares the ring buffer to keeping all output
+func TestScrollbackRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	const capacity = 37
+
+	s := newScrollback(capacity)
+	var all []byte
+	for i := 0; i < 2000; i++ {
+		chunk := make([]byte, rng.Intn(2*capacity))
+		rng.Read(chunk)
+		s.write(chunk)
+		all = append(all, chunk...)
+
+		offset := rng.Int63n(int64(len(all)) + 1)
+		data, start := s.since(offset)
+
+		oldest := max(int64(len(all))-capacity, 0)
+		wantStart := max(offset, oldest)
+		if start != wantStart || !bytes.Equal(data, all[wantStart:]) {
+			t.Fatalf("write %d: since(%d) = %d bytes from %d, want %d bytes from %d",
+				i, offset, len(data), start, int64(len(all))-wantStart, wantStart)
+		}
+	}
+}
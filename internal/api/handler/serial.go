@@ -43,6 +43,12 @@ func (h *SerialHandler) OpenPort(c *gin.Context) {
 		})
 		return
 	}
+	if config.FlowControl != "" && config.FlowControl != serial.FlowNone {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid configuration: only flow control none is supported",
+		})
+		return
+	}
 
 	port, err := h.manager.Open(config)
 	if err != nil {
@@ -0,0 +1,510 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/yourusername/fluxterm/internal/core/serial"
+	"github.com/yourusername/fluxterm/internal/core/sessionlog"
+	"github.com/yourusername/fluxterm/internal/core/ssh"
+	"github.com/yourusername/fluxterm/pkg/protocol/ws"
+)
+
+// Session represents a terminal session, shared by the WebSockets attached
+// to it
+type Session struct {
+	ID          string
+	connType    ConnectionType
+	port        *serial.Port
+	sshClient   *ssh.Client
+	sshSession  string // SSH session ID in sshManager
+	stop        chan struct{}
+	prompts     map[string]chan ws.AuthResponsePayload // Pending keyboard-interactive prompts
+	promptSeq   int
+	detachGrace time.Duration // How long the connection outlives its last WebSocket
+	connecting  bool          // An SSH connect is in flight
+	closed      bool
+	mu          sync.Mutex
+
+	// Guarded by outMu, which may be taken while holding mu
+	subscribers []*subscriber      // Attached WebSockets; empty while detached
+	output      *scrollback        // Recent output, replayed when a socket attaches
+	logger      *sessionlog.Logger // Writes output to disk while logging
+	detachTimer *time.Timer
+	outMu       sync.Mutex
+}
+
+// Session limits
+const (
+	maxSessionIDLen    = 64 // Longest session ID a client may choose
+	defaultDetachGrace = 5 * time.Minute
+	scrollbackSize     = 256 * 1024 // At most dataHighWater, so a replay never blocks
+)
+
+// openSession creates a session owned by a socket. An empty ID is replaced
+// by a generated one.
+func (h *WebSocketHandler) openSession(socket *Socket, id string) (*Session, error) {
+	if id == "" {
+		id = generateSessionID()
+	}
+	if len(id) > maxSessionIDLen {
+		return nil, fmt.Errorf("session ID longer than %d bytes", maxSessionIDLen)
+	}
+
+	session := &Session{
+		ID:          id,
+		stop:        make(chan struct{}),
+		prompts:     make(map[string]chan ws.AuthResponsePayload),
+		detachGrace: defaultDetachGrace,
+		output:      newScrollback(scrollbackSize),
+	}
+
+	// SSH sessions are registered under the same ID
+	if _, exists := h.sshManager.Get(id); exists {
+		return nil, fmt.Errorf("session %s already exists", id)
+	}
+
+	h.mu.Lock()
+	if _, exists := h.sessions[id]; exists {
+		h.mu.Unlock()
+		return nil, fmt.Errorf("session %s already exists", id)
+	}
+	h.sessions[id] = session
+	h.mu.Unlock()
+
+	if _, err := h.subscribe(session, socket, RoleOwner, 0, false); err != nil {
+		h.mu.Lock()
+		delete(h.sessions, id)
+		h.mu.Unlock()
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// subscribe attaches a socket to a session. With replay, the output after
+// offset is queued first, together with an "attached" status; this happens
+// atomically with subscribing so no output is missed or sent twice.
+func (h *WebSocketHandler) subscribe(session *Session, socket *Socket, role string, offset int64, replay bool) (*subscriber, error) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if session.closed {
+		return nil, fmt.Errorf("session closed")
+	}
+
+	session.outMu.Lock()
+	defer session.outMu.Unlock()
+
+	for _, sub := range session.subscribers {
+		if sub.socket == socket {
+			return nil, fmt.Errorf("session already attached to this WebSocket")
+		}
+	}
+
+	sub := &subscriber{
+		session:  session,
+		socket:   socket,
+		queue:    newOutboundQueue(socket.ready),
+		role:     role,
+		encoding: ws.EncodingJSON,
+	}
+	if !socket.add(sub) {
+		return nil, fmt.Errorf("socket closed")
+	}
+	session.subscribers = append(session.subscribers, sub)
+
+	if session.detachTimer != nil {
+		session.detachTimer.Stop()
+		session.detachTimer = nil
+	}
+
+	if replay {
+		data, start := session.output.since(offset)
+		sub.queue.push(messageFrame(ws.MsgTypeStatus, session.ID, ws.StatusPayload{
+			State:   "attached",
+			Message: "Session attached",
+			Offset:  start,
+			Role:    role,
+		}))
+		for len(data) > 0 {
+			n := min(len(data), maxCoalesceSize)
+			sub.queue.pushData(data[:n])
+			data = data[n:]
+		}
+	}
+
+	return sub, nil
+}
+
+// unsubscribe detaches a subscriber from its session. It returns the number
+// of subscribers left, and false if it was already detached.
+func (h *WebSocketHandler) unsubscribe(sub *subscriber) (int, bool) {
+	session := sub.session
+
+	session.outMu.Lock()
+	found := false
+	for i, other := range session.subscribers {
+		if other == sub {
+			session.subscribers = append(session.subscribers[:i], session.subscribers[i+1:]...)
+			found = true
+			break
+		}
+	}
+	remaining := len(session.subscribers)
+	session.outMu.Unlock()
+
+	if !found {
+		return remaining, false
+	}
+	sub.socket.remove(sub)
+	sub.queue.close()
+	return remaining, true
+}
+
+// owner returns the owning subscriber of a session, if one is attached
+func (s *Session) owner() *subscriber {
+	s.outMu.Lock()
+	defer s.outMu.Unlock()
+
+	for _, sub := range s.subscribers {
+		if sub.role == RoleOwner {
+			return sub
+		}
+	}
+	return nil
+}
+
+// handleOpenSession opens another session on the socket
+func (h *WebSocketHandler) handleOpenSession(req *request) {
+	session, err := h.openSession(req.socket, req.sessionID)
+	if err != nil {
+		h.replyError(req, "OPEN_SESSION_FAILED", err.Error())
+		return
+	}
+	req.sub, _ = req.socket.subscription(session.ID)
+
+	log.Printf("[%s] Session opened on WebSocket %s", session.ID, req.socket.ID)
+	h.replyStatus(req, "ready", "Session opened")
+}
+
+// handleAttachSession makes this socket the owner of a session, typically
+// after the WebSocket it was opened on dropped, and replays the output the
+// client missed. The offset param is the number of output bytes the client
+// already has.
+func (h *WebSocketHandler) handleAttachSession(req *request, params ws.AttachSessionParams) {
+	h.mu.RLock()
+	session, exists := h.sessions[req.sessionID]
+	h.mu.RUnlock()
+	if !exists {
+		h.replyError(req, "SESSION_NOT_FOUND", "Session not found or expired")
+		return
+	}
+
+	// Take over from a previous owner that is still attached
+	if previous := session.owner(); previous != nil && previous.socket != req.socket {
+		if _, ok := h.unsubscribe(previous); ok {
+			h.sendSocketMessage(previous.socket, ws.MsgTypeStatus, session.ID, ws.StatusPayload{
+				State:   "detached",
+				Message: "Session attached to another WebSocket",
+			})
+		}
+	}
+
+	h.joinSession(req, session, RoleOwner, params.Offset)
+}
+
+// handleJoinSession attaches this socket to a session alongside its owner,
+// as a writer with input access or as a read-only observer (default)
+func (h *WebSocketHandler) handleJoinSession(req *request, params ws.JoinSessionParams) {
+	h.mu.RLock()
+	session, exists := h.sessions[req.sessionID]
+	h.mu.RUnlock()
+	if !exists {
+		h.replyError(req, "SESSION_NOT_FOUND", "Session not found or expired")
+		return
+	}
+
+	role := RoleObserver
+	if params.Mode == ws.ModeWriter {
+		role = RoleWriter
+	}
+
+	h.joinSession(req, session, role, params.Offset)
+}
+
+// joinSession subscribes the requesting socket with a role, replays the
+// output after offset and announces the new subscriber
+func (h *WebSocketHandler) joinSession(req *request, session *Session, role string, offset int64) {
+	sub, err := h.subscribe(session, req.socket, role, offset, true)
+	if err != nil {
+		h.replyError(req, "ATTACH_FAILED", err.Error())
+		return
+	}
+	req.sub = sub
+
+	log.Printf("[%s] WebSocket %s attached as %s", session.ID, req.socket.ID, role)
+	h.replyStatusPayload(req, ws.StatusPayload{
+		State:      "joined",
+		Message:    fmt.Sprintf("%s joined", role),
+		Subscriber: req.socket.ID,
+		Role:       role,
+	})
+}
+
+// handleCloseSession closes the session when sent by its owner; other
+// subscribers just leave it
+func (h *WebSocketHandler) handleCloseSession(req *request) {
+	sub := req.sub
+	session := sub.session
+
+	if sub.role == RoleOwner {
+		log.Printf("[%s] Session closed", session.ID)
+		h.closeSession(session)
+		return
+	}
+
+	h.leaveSession(sub)
+	req.socket.control.push(replyFrame(ws.MsgTypeStatus, session.ID, req.id, ws.StatusPayload{
+		State:   "closed",
+		Message: "Left session",
+	}))
+}
+
+// leaveSession detaches a subscriber and announces it to the others. A
+// session left without subscribers is detached.
+func (h *WebSocketHandler) leaveSession(sub *subscriber) {
+	remaining, ok := h.unsubscribe(sub)
+	if !ok {
+		return
+	}
+
+	session := sub.session
+	log.Printf("[%s] WebSocket %s (%s) left", session.ID, sub.socket.ID, sub.role)
+	if remaining > 0 {
+		h.sendStatusPayload(session, ws.StatusPayload{
+			State:      "left",
+			Message:    fmt.Sprintf("%s left", sub.role),
+			Subscriber: sub.socket.ID,
+			Role:       sub.role,
+		})
+		return
+	}
+
+	h.detachSession(session)
+}
+
+// detachSession keeps the connection of a session without subscribers open,
+// closing it unless a socket attaches within the grace period. Sessions
+// without a connection are closed right away.
+func (h *WebSocketHandler) detachSession(session *Session) {
+	session.mu.Lock()
+	grace := session.detachGrace
+	connected := session.connType != ""
+	session.mu.Unlock()
+
+	if grace <= 0 || !connected {
+		h.closeSession(session)
+		return
+	}
+
+	session.outMu.Lock()
+	if len(session.subscribers) > 0 {
+		// Attached again meanwhile
+		session.outMu.Unlock()
+		return
+	}
+	if session.detachTimer != nil {
+		session.detachTimer.Stop()
+	}
+	session.detachTimer = time.AfterFunc(grace, func() {
+		h.expireSession(session)
+	})
+	session.outMu.Unlock()
+
+	log.Printf("[%s] Session detached, closing in %s unless reattached", session.ID, grace)
+}
+
+// expireSession closes a session that stayed detached for its grace period
+func (h *WebSocketHandler) expireSession(session *Session) {
+	session.outMu.Lock()
+	detached := len(session.subscribers) == 0
+	session.outMu.Unlock()
+
+	if detached {
+		log.Printf("[%s] Detached session expired", session.ID)
+		h.closeSession(session)
+	}
+}
+
+// setDetachGrace applies the detach_grace param, in seconds; 0 closes the
+// connection as soon as the last WebSocket drops
+func (h *WebSocketHandler) setDetachGrace(session *Session, params ws.DetachParams) {
+	if params.DetachGrace != nil {
+		session.mu.Lock()
+		session.detachGrace = time.Duration(*params.DetachGrace) * time.Second
+		session.mu.Unlock()
+	}
+}
+
+// closeSocket closes the WebSocket connection, leaving its sessions
+func (h *WebSocketHandler) closeSocket(socket *Socket) {
+	for _, sub := range socket.close() {
+		h.leaveSession(sub)
+	}
+	socket.control.close()
+}
+
+// closeSession closes a session and cleans up, telling every subscriber
+func (h *WebSocketHandler) closeSession(session *Session) {
+	session.mu.Lock()
+	if session.closed {
+		session.mu.Unlock()
+		return
+	}
+	session.closed = true
+	close(session.stop)
+
+	if session.port != nil {
+		portName := session.port.GetConfig().Port
+		h.serialManager.Close(portName)
+	}
+	if session.sshClient != nil {
+		h.sshManager.Close(session.ID)
+	}
+	session.mu.Unlock()
+
+	h.mu.Lock()
+	delete(h.sessions, session.ID)
+	h.mu.Unlock()
+
+	session.outMu.Lock()
+	subscribers := session.subscribers
+	session.subscribers = nil
+	if session.detachTimer != nil {
+		session.detachTimer.Stop()
+		session.detachTimer = nil
+	}
+	session.outMu.Unlock()
+
+	h.stopLog(session)
+
+	for _, sub := range subscribers {
+		sub.socket.remove(sub)
+		sub.queue.close()
+		h.sendSocketMessage(sub.socket, ws.MsgTypeStatus, session.ID, ws.StatusPayload{
+			State:   "closed",
+			Message: "Session closed",
+		})
+	}
+}
+
+// queues returns the queues of the session's subscribers
+func (s *Session) queues() []*outboundQueue {
+	s.outMu.Lock()
+	defer s.outMu.Unlock()
+
+	queues := make([]*outboundQueue, len(s.subscribers))
+	for i, sub := range s.subscribers {
+		queues[i] = sub.queue
+	}
+	return queues
+}
+
+// push queues a message for every subscriber. It returns false if none
+// accepted it.
+func (s *Session) push(frame outboundFrame) bool {
+	sent := false
+	for _, queue := range s.queues() {
+		if queue.push(frame) {
+			sent = true
+		}
+	}
+	return sent
+}
+
+// sendData records terminal output and queues it for every subscriber,
+// blocking while the owner or a writer is behind. Observers never block it;
+// see offerObserver. Output of a detached session is only recorded. It
+// returns false once the session is closed.
+func (h *WebSocketHandler) sendData(session *Session, data []byte) bool {
+	session.outMu.Lock()
+	start := session.output.offset()
+	session.output.write(data)
+	logger := session.logger
+	var queues []*outboundQueue
+	for _, sub := range session.subscribers {
+		if sub.canWrite() {
+			queues = append(queues, sub.queue)
+		} else {
+			h.offerObserver(session, sub, data, start)
+		}
+	}
+	session.outMu.Unlock()
+
+	if logger != nil {
+		h.writeLog(session, logger, data)
+	}
+
+	delivered := true
+	for _, queue := range queues {
+		if !queue.pushData(data) {
+			delivered = false
+		}
+	}
+
+	if !delivered {
+		// Either closed, or a subscriber left meanwhile
+		session.mu.Lock()
+		defer session.mu.Unlock()
+		return !session.closed
+	}
+	return true
+}
+
+// offerObserver queues output for an observer without blocking. Output that
+// does not fit is dropped and the observer is marked behind until
+// resyncObserver catches it up. Must be called with session.outMu held,
+// after data, starting at offset start, was recorded.
+func (h *WebSocketHandler) offerObserver(session *Session, sub *subscriber, data []byte, start int64) {
+	if !sub.behind {
+		if sub.queue.offerData(data) {
+			return
+		}
+		sub.behind = true
+		sub.resumeFrom = start
+		log.Printf("[%s] Observer %s fell behind, dropping output", session.ID, sub.socket.ID)
+	}
+	h.resyncObserver(sub)
+}
+
+// resyncObserver replays the output an observer missed from the scrollback
+// once its queue has drained, after a "resync" status giving the offset the
+// replay starts at. Output overwritten in the meantime is lost. Must be
+// called with session.outMu held.
+func (h *WebSocketHandler) resyncObserver(sub *subscriber) {
+	if !sub.behind || sub.queue.Stats().PendingBytes > 0 {
+		return
+	}
+
+	session := sub.session
+	missed, from := session.output.since(sub.resumeFrom)
+	sub.queue.push(messageFrame(ws.MsgTypeStatus, session.ID, ws.StatusPayload{
+		State:   "resync",
+		Message: "Output replayed after falling behind",
+		Offset:  from,
+		Role:    sub.role,
+	}))
+	for len(missed) > 0 {
+		n := min(len(missed), maxCoalesceSize)
+		if !sub.queue.offerData(missed[:n]) {
+			sub.resumeFrom = from
+			return
+		}
+		missed = missed[n:]
+		from += int64(n)
+	}
+	sub.behind = false
+	log.Printf("[%s] Observer %s caught up", session.ID, sub.socket.ID)
+}
@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/yourusername/fluxterm/pkg/protocol/ws"
+)
+
+// serverHello announces what the server supports
+var serverHello = ws.NewHello("fluxterm")
+
+// Subscriber roles
+const (
+	RoleOwner    = "owner"    // Opened or reattached the session
+	RoleWriter   = "writer"   // Joined with input access
+	RoleObserver = "observer" // Joined read-only
+)
+
+// subscriber attaches a session to a socket. Every subscriber receives the
+// session's output through its own queue.
+type subscriber struct {
+	session  *Session
+	socket   *Socket
+	queue    *outboundQueue
+	role     string
+	encoding string // ws.EncodingJSON or ws.EncodingBinary; guarded by session.outMu
+
+	// An observer that falls behind has output dropped instead of pausing
+	// the session, and catches up from the scrollback; guarded by
+	// session.outMu
+	behind     bool
+	resumeFrom int64 // Output offset the observer missed from
+}
+
+// canWrite reports whether the subscriber may send input and control actions
+func (s *subscriber) canWrite() bool {
+	return s.role != RoleObserver
+}
+
+// Socket is a WebSocket connection carrying one or more sessions
+type Socket struct {
+	ID            string
+	conn          *websocket.Conn
+	subscriptions []*subscriber   // Attached sessions, oldest first
+	next          int             // Subscription the writer serves next
+	version       int             // Negotiated protocol version; 0 until the client says hello
+	software      string          // Client software named in its hello
+	caps          ws.HelloPayload // Capabilities both sides listed; the server's until the client says hello
+	control       *outboundQueue  // Messages not tied to an attached session
+	ready         chan struct{}   // Signalled when any of the socket's queues has items
+	stop          chan struct{}
+	closed        bool
+	mu            sync.Mutex
+}
+
+// newSocket wraps an upgraded WebSocket connection
+func newSocket(id string, conn *websocket.Conn) *Socket {
+	ready := make(chan struct{}, 1)
+	return &Socket{
+		ID:      id,
+		conn:    conn,
+		caps:    serverHello,
+		control: newOutboundQueue(ready),
+		ready:   ready,
+		stop:    make(chan struct{}),
+	}
+}
+
+// capabilities returns the capabilities negotiated with the client
+func (s *Socket) capabilities() ws.HelloPayload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.caps
+}
+
+// add registers a subscription, failing once the socket is closed
+func (s *Socket) add(sub *subscriber) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	s.subscriptions = append(s.subscriptions, sub)
+	return true
+}
+
+// remove unregisters a subscription
+func (s *Socket) remove(sub *subscriber) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, other := range s.subscriptions {
+		if other == sub {
+			s.subscriptions = append(s.subscriptions[:i], s.subscriptions[i+1:]...)
+			if s.next > i {
+				s.next--
+			}
+			return
+		}
+	}
+}
+
+// subscription returns the subscription to the session with the given ID,
+// or the oldest one when the ID is empty
+func (s *Socket) subscription(id string) (*subscriber, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sub := range s.subscriptions {
+		if id == "" || sub.session.ID == id {
+			return sub, true
+		}
+	}
+	return nil, false
+}
+
+// close marks the socket closed and returns its remaining subscriptions
+func (s *Socket) close() []*subscriber {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.stop)
+
+	subscriptions := make([]*subscriber, len(s.subscriptions))
+	copy(subscriptions, s.subscriptions)
+	return subscriptions
+}
+
+// take returns the next queued item without waiting. The control queue is
+// served first, then the subscriptions in turn so a busy session can't
+// starve the others. The subscriber is nil for control items.
+func (s *Socket) take() (item *outboundItem, sub *subscriber, closed bool) {
+	item, closed = s.control.take()
+	if closed || item != nil {
+		return item, nil, closed
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(s.subscriptions)
+	for i := 0; i < n; i++ {
+		sub := s.subscriptions[(s.next+i)%n]
+		if item, _ := sub.queue.take(); item != nil {
+			s.next = (s.next + i + 1) % n
+			return item, sub, false
+		}
+	}
+	return nil, nil, false
+}
@@ -1,11 +1,15 @@
 package handler
 
 import (
+	"bytes"
+	"context"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/yourusername/fluxterm/internal/core/ssh"
+	"github.com/yourusername/fluxterm/pkg/protocol/ws"
 )
 
 type SSHHandler struct {
@@ -18,15 +22,77 @@ func NewSSHHandler(manager *ssh.Manager) *SSHHandler {
 	}
 }
 
+// SSHConnectRequest takes keys and certificates inline; paths on the
+// backend's machine only come from the ~/.ssh/config entry of host_alias
 type SSHConnectRequest struct {
-	Host                 string `json:"host" binding:"required"`
-	Port                 int    `json:"port"`
-	Username             string `json:"username" binding:"required"`
-	AuthMethod           string `json:"auth_method"`
-	Password             string `json:"password"`
-	PrivateKey           string `json:"private_key"`
-	PrivateKeyPath       string `json:"private_key_path"`
-	PrivateKeyPassphrase string `json:"private_key_passphrase"`
+	HostAlias            string   `json:"host_alias"` // Host alias from ~/.ssh/config
+	Host                 string   `json:"host"`       // Required unless host_alias is set
+	Port                 int      `json:"port"`
+	Username             string   `json:"username"` // Required unless resolved from host_alias
+	AuthMethod           string   `json:"auth_method"`
+	AuthMethods          []string `json:"auth_methods"` // Tried in order, overrides auth_method
+	Password             string   `json:"password"`
+	PrivateKey           string   `json:"private_key"`
+	PrivateKeyPassphrase string   `json:"private_key_passphrase"`
+	ForwardAgent         bool     `json:"forward_agent"`
+	Certificate          string   `json:"certificate"`
+	HostCertAuthorities  []string `json:"host_cert_authorities"`
+	KeepaliveInterval    int      `json:"keepalive_interval"`  // Seconds, 0 disables keepalives
+	KeepaliveCountMax    int      `json:"keepalive_count_max"` // Missed replies before disconnecting
+
+	// Reconnect with backoff when the connection drops
+	AutoReconnect        bool `json:"auto_reconnect"`
+	ReconnectMaxAttempts int  `json:"reconnect_max_attempts"` // 0 retries until closed
+	ReconnectMaxDelay    int  `json:"reconnect_max_delay"`    // Seconds
+
+	// Jump hosts dialed in order before the target; unset fields are inherited
+	JumpHosts []ws.ConnectSSHParams `json:"jump_hosts"`
+
+	// Port forwards started after connecting; connecting fails if one can't start
+	Forwards []ws.ForwardParams `json:"forwards"`
+
+	// Algorithm preferences; a leading "+", "-" or "^" adjusts the defaults
+	Ciphers           []string `json:"ciphers"`
+	KeyExchanges      []string `json:"key_exchanges"`
+	MACs              []string `json:"macs"`
+	HostKeyAlgorithms []string `json:"host_key_algorithms"`
+
+	// Terminal settings and environment
+	TerminalType  string            `json:"terminal_type"`
+	TerminalModes map[string]uint32 `json:"terminal_modes"` // e.g. {"VERASE": 127}
+	Env           map[string]string `json:"env"`
+}
+
+// params converts the request to the equivalent connect_ssh params
+func (r SSHConnectRequest) params() ws.ConnectSSHParams {
+	return ws.ConnectSSHParams{
+		HostAlias:            r.HostAlias,
+		Host:                 r.Host,
+		Port:                 r.Port,
+		Username:             r.Username,
+		AuthMethod:           r.AuthMethod,
+		AuthMethods:          r.AuthMethods,
+		Password:             r.Password,
+		PrivateKey:           r.PrivateKey,
+		PrivateKeyPassphrase: r.PrivateKeyPassphrase,
+		ForwardAgent:         r.ForwardAgent,
+		Certificate:          r.Certificate,
+		HostCertAuthorities:  r.HostCertAuthorities,
+		JumpHosts:            r.JumpHosts,
+		Forwards:             r.Forwards,
+		Ciphers:              r.Ciphers,
+		KeyExchanges:         r.KeyExchanges,
+		MACs:                 r.MACs,
+		HostKeyAlgorithms:    r.HostKeyAlgorithms,
+		TerminalType:         r.TerminalType,
+		TerminalModes:        r.TerminalModes,
+		Env:                  r.Env,
+		KeepaliveInterval:    r.KeepaliveInterval,
+		KeepaliveCountMax:    r.KeepaliveCountMax,
+		AutoReconnect:        r.AutoReconnect,
+		ReconnectMaxAttempts: r.ReconnectMaxAttempts,
+		ReconnectMaxDelay:    r.ReconnectMaxDelay,
+	}
 }
 
 type SSHSessionResponse struct {
@@ -34,6 +100,46 @@ type SSHSessionResponse struct {
 	Message   string `json:"message"`
 	SessionID string `json:"session_id,omitempty"`
 	Connected bool   `json:"connected"`
+
+	AuthMethod string `json:"auth_method,omitempty"` // Auth method that succeeded
+	State      string `json:"state,omitempty"`       // "connected" | "disconnected"
+	Reason     string `json:"reason,omitempty"`      // Why the connection was lost
+
+	ExitStatus *ssh.ExitStatus `json:"exit_status,omitempty"` // How the remote shell ended
+
+	ConnectionID string `json:"connection_id,omitempty"` // Connection shared by duplicated sessions
+	Channels     int    `json:"channels,omitempty"`      // Sessions open on the connection
+}
+
+type SSHDuplicateRequest struct {
+	Cols int `json:"cols"`
+	Rows int `json:"rows"`
+}
+
+type SSHExecRequest struct {
+	Command string `json:"command" binding:"required"`
+	Timeout int    `json:"timeout"` // Seconds, default: 60
+}
+
+type SSHExecResponse struct {
+	Success    bool            `json:"success"`
+	Message    string          `json:"message"`
+	Stdout     string          `json:"stdout"`
+	Stderr     string          `json:"stderr"`
+	ExitStatus *ssh.ExitStatus `json:"exit_status,omitempty"`
+	Truncated  bool            `json:"truncated,omitempty"` // Output exceeded the capture limit
+}
+
+const (
+	defaultExecTimeout = 60 * time.Second
+	execOutputLimit    = 1 << 20 // Per stream
+)
+
+type SSHForwardResponse struct {
+	Success  bool                `json:"success"`
+	Message  string              `json:"message"`
+	Forward  *ssh.ForwardStatus  `json:"forward,omitempty"`
+	Forwards []ssh.ForwardStatus `json:"forwards,omitempty"`
 }
 
 // Connect creates a persistent SSH session
@@ -47,35 +153,45 @@ func (h *SSHHandler) Connect(c *gin.Context) {
 		return
 	}
 
-	// Set defaults
-	if req.Port == 0 {
-		req.Port = 22
+	// Validated like the connect_ssh params of the WebSocket API
+	params := req.params()
+	if err := params.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, SSHSessionResponse{
+			Success: false,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
 	}
-	if req.AuthMethod == "" {
-		req.AuthMethod = "password"
+
+	// Merge ~/.ssh/config settings; explicit request fields take precedence
+	config, err := ssh.ResolveHostAlias(sshConfigFromParams(params))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, SSHSessionResponse{
+			Success: false,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
 	}
 
-	// Create SSH config
-	config := ssh.SSHConfig{
-		Host:                 req.Host,
-		Port:                 req.Port,
-		Username:             req.Username,
-		AuthMethod:           ssh.AuthMethod(req.AuthMethod),
-		Password:             req.Password,
-		PrivateKey:           req.PrivateKey,
-		PrivateKeyPath:       req.PrivateKeyPath,
-		PrivateKeyPassphrase: req.PrivateKeyPassphrase,
-		TerminalType:         "xterm-256color",
-		Cols:                 80,
-		Rows:                 24,
-		ConnectTimeout:       10,
+	// Set defaults
+	if config.ConnectTimeout == 0 {
+		config.ConnectTimeout = 10
+	}
+	config = config.WithDefaults()
+
+	if config.Username == "" {
+		c.JSON(http.StatusBadRequest, SSHSessionResponse{
+			Success: false,
+			Message: "Invalid request: username required",
+		})
+		return
 	}
 
 	// Create session ID
 	sessionID := generateSessionID()
 
 	// Try to connect
-	_, err := h.manager.Connect(sessionID, config)
+	client, err := h.manager.Connect(sessionID, config)
 	if err != nil {
 		log.Printf("SSH connection failed: %v", err)
 		c.JSON(http.StatusOK, SSHSessionResponse{
@@ -85,13 +201,62 @@ func (h *SSHHandler) Connect(c *gin.Context) {
 		return
 	}
 
-	log.Printf("SSH session created: %s@%s:%d (ID: %s)", config.Username, config.Host, config.Port, sessionID)
+	log.Printf("SSH session created: %s@%s:%d (ID: %s, auth: %s)", config.Username, config.Host, config.Port, sessionID, client.AuthMethodUsed())
 
 	c.JSON(http.StatusOK, SSHSessionResponse{
-		Success:   true,
-		Message:   "SSH session created",
-		SessionID: sessionID,
-		Connected: true,
+		Success:      true,
+		Message:      "SSH session created",
+		SessionID:    sessionID,
+		Connected:    true,
+		AuthMethod:   string(client.AuthMethodUsed()),
+		ConnectionID: client.Connection().ID(),
+	})
+}
+
+// Duplicate handles POST /api/v1/ssh/:session_id/duplicate, opening another
+// shell on the session's connection without authenticating again
+func (h *SSHHandler) Duplicate(c *gin.Context) {
+	sourceID := c.Param("session_id")
+
+	var req SSHDuplicateRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, SSHSessionResponse{
+				Success: false,
+				Message: "Invalid request: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	if _, exists := h.manager.Get(sourceID); !exists {
+		c.JSON(http.StatusNotFound, SSHSessionResponse{
+			Success: false,
+			Message: "Session not found",
+		})
+		return
+	}
+
+	sessionID := generateSessionID()
+	client, err := h.manager.Duplicate(sessionID, sourceID, req.Cols, req.Rows)
+	if err != nil {
+		c.JSON(http.StatusOK, SSHSessionResponse{
+			Success: false,
+			Message: "Failed to duplicate session: " + err.Error(),
+		})
+		return
+	}
+
+	log.Printf("SSH session duplicated: %s -> %s (connection: %s)", sourceID, sessionID, client.Connection().ID())
+
+	c.JSON(http.StatusOK, SSHSessionResponse{
+		Success:      true,
+		Message:      "SSH session duplicated",
+		SessionID:    sessionID,
+		Connected:    true,
+		AuthMethod:   string(client.AuthMethodUsed()),
+		ConnectionID: client.Connection().ID(),
+		Channels:     client.Connection().Channels(),
 	})
 }
 
@@ -134,12 +299,166 @@ func (h *SSHHandler) Status(c *gin.Context) {
 		return
 	}
 
-	_, exists := h.manager.Get(sessionID)
+	client, exists := h.manager.Get(sessionID)
 
-	c.JSON(http.StatusOK, SSHSessionResponse{
+	resp := SSHSessionResponse{
 		Success:   true,
 		Message:   "Session status retrieved",
 		SessionID: sessionID,
 		Connected: exists,
+	}
+	if exists {
+		resp.State, resp.Reason = client.Status()
+		resp.Connected = resp.State == ssh.StateConnected
+		resp.AuthMethod = string(client.AuthMethodUsed())
+		resp.ExitStatus = client.ExitStatus()
+		resp.ConnectionID = client.Connection().ID()
+		resp.Channels = client.Connection().Channels()
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ListForwards handles GET /api/v1/ssh/:session_id/forwards
+func (h *SSHHandler) ListForwards(c *gin.Context) {
+	client, ok := h.getClient(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, SSHForwardResponse{
+		Success:  true,
+		Message:  "Forwards retrieved",
+		Forwards: client.Forwards(),
+	})
+}
+
+// AddForward handles POST /api/v1/ssh/:session_id/forwards
+func (h *SSHHandler) AddForward(c *gin.Context) {
+	client, ok := h.getClient(c)
+	if !ok {
+		return
+	}
+
+	var rule ssh.ForwardRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, SSHForwardResponse{
+			Success: false,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	status, err := client.AddForward(rule)
+	if err != nil {
+		c.JSON(http.StatusOK, SSHForwardResponse{
+			Success: false,
+			Message: "Failed to start forward: " + err.Error(),
+		})
+		return
+	}
+
+	log.Printf("SSH %s forward started: %s -> %s (session: %s)", status.Type, status.BoundAddr, status.TargetAddr, c.Param("session_id"))
+
+	c.JSON(http.StatusOK, SSHForwardResponse{
+		Success: true,
+		Message: "Forward started",
+		Forward: &status,
+	})
+}
+
+// RemoveForward handles DELETE /api/v1/ssh/:session_id/forwards/:forward_id
+func (h *SSHHandler) RemoveForward(c *gin.Context) {
+	client, ok := h.getClient(c)
+	if !ok {
+		return
+	}
+
+	if err := client.RemoveForward(c.Param("forward_id")); err != nil {
+		c.JSON(http.StatusNotFound, SSHForwardResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, SSHForwardResponse{
+		Success: true,
+		Message: "Forward stopped",
 	})
 }
+
+// Exec handles POST /api/v1/ssh/:session_id/exec
+func (h *SSHHandler) Exec(c *gin.Context) {
+	client, ok := h.getClient(c)
+	if !ok {
+		return
+	}
+
+	var req SSHExecRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, SSHExecResponse{
+			Success: false,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	timeout := defaultExecTimeout
+	if req.Timeout > 0 {
+		timeout = time.Duration(req.Timeout) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+
+	stdout := &limitedBuffer{limit: execOutputLimit}
+	stderr := &limitedBuffer{limit: execOutputLimit}
+
+	exit, err := client.Exec(ctx, req.Command, stdout, stderr)
+	resp := SSHExecResponse{
+		Success:    err == nil,
+		Message:    "Command completed",
+		Stdout:     stdout.String(),
+		Stderr:     stderr.String(),
+		ExitStatus: exit,
+		Truncated:  stdout.truncated || stderr.truncated,
+	}
+	if err != nil {
+		resp.Message = "Failed to run command: " + err.Error()
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// limitedBuffer captures output up to a limit and discards the rest
+type limitedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); len(p) > room {
+		b.truncated = true
+		b.Buffer.Write(p[:room])
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// getClient looks up the SSH client for the request's session ID,
+// writing an error response if it does not exist
+func (h *SSHHandler) getClient(c *gin.Context) (*ssh.Client, bool) {
+	sessionID := c.Param("session_id")
+
+	client, exists := h.manager.Get(sessionID)
+	if !exists {
+		c.JSON(http.StatusNotFound, SSHSessionResponse{
+			Success: false,
+			Message: "Session not found",
+		})
+		return nil, false
+	}
+
+	return client, true
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/fluxterm/internal/core/ssh"
+)
+
+func TestConnectValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/connect", NewSSHHandler(ssh.NewManager()).Connect)
+
+	tests := []struct {
+		name, body, message string
+	}{
+		{"no host", `{"username":"u"}`, "host: host or host_alias is required"},
+		{"bad port", `{"host":"h","port":70000}`, "port: must be a port number"},
+		{"bad auth method", `{"host":"h","auth_methods":["password","magic"]}`, "auth_methods.1: must be one of"},
+		{"forward without target", `{"host":"h","forwards":[{"type":"local","listen_addr":"127.0.0.1:0"}]}`, "forwards.0.target_addr: is required"},
+		{"bad forward type", `{"host":"h","forwards":[{"type":"sideways","listen_addr":"127.0.0.1:0"}]}`, "forwards.0.type: must be one of"},
+		{"bad jump host", `{"host":"h","jump_hosts":[{"host":"j","port":-1}]}`, "jump_hosts.0.port: must be a port number"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/connect", strings.NewReader(tt.body)))
+
+			var resp SSHSessionResponse
+			json.Unmarshal(rec.Body.Bytes(), &resp)
+			if rec.Code != http.StatusBadRequest || resp.Success {
+				t.Fatalf("status = %d, success = %v, want a 400 failure", rec.Code, resp.Success)
+			}
+			if !strings.Contains(resp.Message, tt.message) {
+				t.Errorf("message = %q, want it to contain %q", resp.Message, tt.message)
+			}
+		})
+	}
+}
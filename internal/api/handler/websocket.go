@@ -1,21 +1,30 @@
 package handler
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"log"
+	"math/rand/v2"
 	"net/http"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	"github.com/yourusername/fluxterm/internal/core/serial"
+	"github.com/yourusername/fluxterm/internal/core/sessionlog"
 	"github.com/yourusername/fluxterm/internal/core/ssh"
 	"github.com/yourusername/fluxterm/pkg/protocol/ws"
 	"github.com/yourusername/fluxterm/pkg/protocol/xmodem"
 )
 
+// authPromptTimeout is how long a keyboard-interactive prompt waits for the user
+const authPromptTimeout = 2 * time.Minute
+
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true // TODO: implement proper origin checking
@@ -35,20 +44,19 @@ type WebSocketHandler struct {
 	serialManager *serial.Manager
 	sshManager    *ssh.Manager
 	sessions      map[string]*Session
+	logDir        string // Directory session logs are written below
 	mu            sync.RWMutex
 }
 
-// Session represents a WebSocket session
-type Session struct {
-	ID         string
-	conn       *websocket.Conn
-	connType   ConnectionType
-	port       *serial.Port
-	sshClient  *ssh.Client
-	sshSession string // SSH session ID in sshManager
-	send       chan []byte
-	stop       chan struct{}
-	mu         sync.Mutex
+// outboundFrame is a WebSocket frame queued for the writer
+type outboundFrame struct {
+	messageType int // websocket.TextMessage or websocket.BinaryMessage
+	data        []byte
+}
+
+// textFrame wraps a JSON message for the writer
+func textFrame(data []byte) outboundFrame {
+	return outboundFrame{messageType: websocket.TextMessage, data: data}
 }
 
 // NewWebSocketHandler creates a new WebSocket handler
@@ -57,7 +65,88 @@ func NewWebSocketHandler(serialManager *serial.Manager, sshManager *ssh.Manager)
 		serialManager: serialManager,
 		sshManager:    sshManager,
 		sessions:      make(map[string]*Session),
+		logDir:        sessionlog.DefaultDirectory,
+	}
+}
+
+// WSSessionInfo describes a session and the WebSockets attached to it
+type WSSessionInfo struct {
+	SessionID    string             `json:"session_id"`
+	ConnType     ConnectionType     `json:"conn_type,omitempty"`
+	Detached     bool               `json:"detached"`
+	OutputOffset int64              `json:"output_offset"` // Bytes of output so far
+	Subscribers  []WSSubscriberInfo `json:"subscribers"`
+	Log          *sessionlog.Status `json:"log,omitempty"` // Set while the output is logged
+}
+
+// WSSubscriberInfo describes a WebSocket attached to a session and its
+// outbound queue
+type WSSubscriberInfo struct {
+	SocketID        string     `json:"socket_id"`
+	Role            string     `json:"role"`
+	Encoding        string     `json:"encoding"`
+	ProtocolVersion int        `json:"protocol_version,omitempty"` // Zero until the client says hello
+	Client          string     `json:"client,omitempty"`
+	Queue           QueueStats `json:"queue"`
+}
+
+// WSSessionListResponse represents the response for listing WebSocket sessions
+type WSSessionListResponse struct {
+	Success  bool            `json:"success"`
+	Message  string          `json:"message"`
+	Sessions []WSSessionInfo `json:"sessions"`
+}
+
+// ListSessions handles GET /api/v1/ws/sessions
+func (h *WebSocketHandler) ListSessions(c *gin.Context) {
+	h.mu.RLock()
+	sessions := make([]*Session, 0, len(h.sessions))
+	for _, session := range h.sessions {
+		sessions = append(sessions, session)
 	}
+	h.mu.RUnlock()
+
+	infos := make([]WSSessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		session.mu.Lock()
+		info := WSSessionInfo{
+			SessionID: session.ID,
+			ConnType:  session.connType,
+		}
+		session.mu.Unlock()
+
+		session.outMu.Lock()
+		info.Subscribers = make([]WSSubscriberInfo, 0, len(session.subscribers))
+		for _, sub := range session.subscribers {
+			sub.socket.mu.Lock()
+			version, software := sub.socket.version, sub.socket.software
+			sub.socket.mu.Unlock()
+
+			info.Subscribers = append(info.Subscribers, WSSubscriberInfo{
+				SocketID:        sub.socket.ID,
+				Role:            sub.role,
+				Encoding:        sub.encoding,
+				ProtocolVersion: version,
+				Client:          software,
+				Queue:           sub.queue.Stats(),
+			})
+		}
+		info.Detached = len(session.subscribers) == 0
+		info.OutputOffset = session.output.offset()
+		session.outMu.Unlock()
+		info.Log = session.logStatus()
+
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].SessionID < infos[j].SessionID
+	})
+
+	c.JSON(http.StatusOK, WSSessionListResponse{
+		Success:  true,
+		Message:  "Sessions retrieved",
+		Sessions: infos,
+	})
 }
 
 // HandleWebSocket handles WebSocket upgrade and communication
@@ -68,158 +157,376 @@ func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
 		return
 	}
 
-	sessionID := generateSessionID()
-	log.Printf("[%s] WebSocket connection established", sessionID)
-
-	session := &Session{
-		ID:   sessionID,
-		conn: conn,
-		send: make(chan []byte, 256),
-		stop: make(chan struct{}),
+	socket := newSocket(generateSessionID(), conn)
+	session, err := h.openSession(socket, "")
+	if err != nil {
+		log.Printf("Failed to open session: %v", err)
+		conn.Close()
+		return
 	}
+	log.Printf("[%s] WebSocket connection established", session.ID)
 
-	h.mu.Lock()
-	h.sessions[sessionID] = session
-	h.mu.Unlock()
-
-	// Send welcome message
+	// Announce capabilities, then send welcome message
+	h.sendSocketMessage(socket, ws.MsgTypeHello, "", serverHello)
 	h.sendStatus(session, "ready", "WebSocket connection established")
 
 	// Start read/write goroutines
-	go h.readPump(session)
-	go h.writePump(session)
+	go h.readPump(socket)
+	go h.writePump(socket)
 }
 
 // readPump reads messages from the WebSocket connection
-func (h *WebSocketHandler) readPump(session *Session) {
+func (h *WebSocketHandler) readPump(socket *Socket) {
 	defer func() {
-		h.closeSession(session)
+		h.closeSocket(socket)
 	}()
 
-	session.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-	session.conn.SetPongHandler(func(string) error {
-		session.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	socket.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	socket.conn.SetPongHandler(func(string) error {
+		socket.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 		return nil
 	})
 
 	for {
 		select {
-		case <-session.stop:
+		case <-socket.stop:
 			return
 		default:
 		}
 
-		_, message, err := session.conn.ReadMessage()
+		messageType, message, err := socket.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("[%s] WebSocket error: %v", session.ID, err)
+				log.Printf("[%s] WebSocket error: %v", socket.ID, err)
 			}
 			return
 		}
 
-		h.handleMessage(session, message)
+		if messageType == websocket.BinaryMessage {
+			h.handleBinary(socket, message)
+			continue
+		}
+		h.handleMessage(socket, message)
 	}
 }
 
 // writePump writes messages to the WebSocket connection
-func (h *WebSocketHandler) writePump(session *Session) {
+func (h *WebSocketHandler) writePump(socket *Socket) {
 	ticker := time.NewTicker(54 * time.Second)
 	defer func() {
 		ticker.Stop()
-		session.conn.Close()
+		socket.conn.Close()
 	}()
 
 	for {
+		// Keep pinging while output is flowing, so the client's pongs
+		// keep extending the read deadline
 		select {
-		case message, ok := <-session.send:
-			session.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if !ok {
-				session.conn.WriteMessage(websocket.CloseMessage, []byte{})
+		case <-ticker.C:
+			if !h.writeFrame(socket, websocket.PingMessage, nil) {
 				return
 			}
+		default:
+		}
+
+		item, sub, closed := socket.take()
+		if closed {
+			h.writeFrame(socket, websocket.CloseMessage, []byte{})
+			return
+		}
 
-			if err := session.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+		if item != nil {
+			frame := item.frame
+			if item.isData {
+				frame = h.encodeData(sub, item.data)
+			}
+			if !h.writeFrame(socket, frame.messageType, frame.data) {
 				return
 			}
+			if item.isData && !sub.canWrite() {
+				// An observer that fell behind catches up once drained,
+				// even if the session has gone quiet
+				sub.session.outMu.Lock()
+				h.resyncObserver(sub)
+				sub.session.outMu.Unlock()
+			}
+			continue
+		}
 
+		select {
+		case <-socket.ready:
 		case <-ticker.C:
-			session.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if err := session.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			if !h.writeFrame(socket, websocket.PingMessage, nil) {
 				return
 			}
-
-		case <-session.stop:
+		case <-socket.stop:
 			return
 		}
 	}
 }
 
-// handleMessage processes incoming WebSocket messages
-func (h *WebSocketHandler) handleMessage(session *Session, data []byte) {
+// writeFrame writes a single frame, returning false on failure
+func (h *WebSocketHandler) writeFrame(socket *Socket, messageType int, data []byte) bool {
+	socket.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return socket.conn.WriteMessage(messageType, data) == nil
+}
+
+// handleMessage routes incoming WebSocket messages to their session
+func (h *WebSocketHandler) handleMessage(socket *Socket, data []byte) {
 	var msg ws.Message
 	if err := json.Unmarshal(data, &msg); err != nil {
-		h.sendError(session, "INVALID_MESSAGE", "Failed to parse message")
+		h.sendSocketError(socket, "", "INVALID_MESSAGE", "Failed to parse message")
+		return
+	}
+	req := newRequest(socket, msg)
+
+	if msg.Type == ws.MsgTypeHello {
+		h.handleHello(req, msg.Payload)
 		return
 	}
 
+	// Opening, attaching and joining sessions are the actions that don't go
+	// through a session of this socket
+	if msg.Type == ws.MsgTypeControl {
+		var ctrl ws.ControlPayload
+		if err := json.Unmarshal(msg.Payload, &ctrl); err == nil {
+			req.action = ctrl.Action
+			switch ctrl.Action {
+			case ws.ActionOpenSession:
+				if h.checkAction(req, ctrl.Action) {
+					h.handleOpenSession(req)
+				}
+				return
+			case ws.ActionAttachSession:
+				var params ws.AttachSessionParams
+				if h.checkAction(req, ctrl.Action) && h.decodeParams(req, ctrl.Params, &params) {
+					h.handleAttachSession(req, params)
+				}
+				return
+			case ws.ActionJoinSession:
+				var params ws.JoinSessionParams
+				if h.checkAction(req, ctrl.Action) && h.decodeParams(req, ctrl.Params, &params) {
+					h.handleJoinSession(req, params)
+				}
+				return
+			}
+		}
+	}
+
+	sub, ok := socket.subscription(msg.SessionID)
+	if !ok {
+		h.replyError(req, "UNKNOWN_SESSION", "Unknown session ID")
+		return
+	}
+	req.sub = sub
+
 	switch msg.Type {
 	case ws.MsgTypeControl:
-		h.handleControl(session, msg.Payload)
+		h.handleControl(req, msg.Payload)
 	case ws.MsgTypeData:
-		h.handleData(session, msg.Payload)
+		if h.checkWritable(req) {
+			h.handleData(req, msg.Payload)
+		}
+	case ws.MsgTypeAuthResponse:
+		if h.checkWritable(req) {
+			h.handleAuthResponse(req, msg.Payload)
+		}
 	default:
-		h.sendError(session, "UNKNOWN_TYPE", "Unknown message type")
+		h.replyError(req, "UNKNOWN_TYPE", "Unknown message type")
 	}
 }
 
-// handleControl processes control messages
-func (h *WebSocketHandler) handleControl(session *Session, payload json.RawMessage) {
+// checkWritable reports whether the requesting subscriber may send input,
+// telling observers that they can't
+func (h *WebSocketHandler) checkWritable(req *request) bool {
+	if !req.sub.canWrite() {
+		h.replyError(req, "READ_ONLY", "Session is attached read-only")
+		return false
+	}
+	return true
+}
+
+// checkAction reports whether a control action was negotiated with the
+// client, telling it which ones were if not
+func (h *WebSocketHandler) checkAction(req *request, action string) bool {
+	supported := req.socket.capabilities().Actions
+	if slices.Contains(supported, action) {
+		return true
+	}
+
+	log.Printf("[%s] Unsupported control action: %s", req.socket.ID, action)
+	h.replyErrorPayload(req, ws.ErrorPayload{
+		Code:      ws.ErrCodeUnsupportedAction,
+		Message:   "Unsupported control action",
+		Supported: supported,
+	})
+	return false
+}
+
+// handleHello negotiates the protocol version and capabilities with a
+// client's hello
+func (h *WebSocketHandler) handleHello(req *request, payload json.RawMessage) {
+	socket := req.socket
+
+	var hello ws.HelloPayload
+	if err := json.Unmarshal(payload, &hello); err != nil {
+		h.replyError(req, "INVALID_HELLO", "Invalid hello payload")
+		return
+	}
+
+	version, err := ws.Negotiate(hello)
+	if err != nil {
+		h.replyError(req, ws.ErrCodeUnsupportedVersion, err.Error())
+		return
+	}
+
+	socket.mu.Lock()
+	socket.version = version
+	socket.software = hello.Software
+	socket.caps = serverHello.Intersect(hello)
+	binary := slices.Contains(socket.caps.Encodings, ws.EncodingBinary)
+	subs := slices.Clone(socket.subscriptions)
+	socket.mu.Unlock()
+
+	// Fall back to JSON where binary data was picked before the hello
+	if !binary {
+		for _, sub := range subs {
+			sub.session.outMu.Lock()
+			if sub.encoding == ws.EncodingBinary {
+				sub.encoding = ws.EncodingJSON
+			}
+			sub.session.outMu.Unlock()
+		}
+	}
+
+	log.Printf("[%s] Negotiated protocol version %d with %q", socket.ID, version, hello.Software)
+	socket.control.push(replyFrame(ws.MsgTypeStatus, "", req.id, ws.StatusPayload{
+		State:   "negotiated",
+		Message: fmt.Sprintf("Protocol version %d", version),
+	}))
+}
+
+// handleControl processes control messages, decoding the params of each
+// action before handling it
+func (h *WebSocketHandler) handleControl(req *request, payload json.RawMessage) {
+	session := req.session()
+
 	var ctrl ws.ControlPayload
 	if err := json.Unmarshal(payload, &ctrl); err != nil {
-		h.sendError(session, "INVALID_CONTROL", "Invalid control payload")
+		h.replyError(req, "INVALID_CONTROL", "Invalid control payload")
+		return
+	}
+	req.action = ctrl.Action
+	if !h.checkAction(req, ctrl.Action) {
+		return
+	}
+
+	// Observers may only pick their encoding and leave
+	if ctrl.Action != ws.ActionSetEncoding && ctrl.Action != ws.ActionCloseSession && !h.checkWritable(req) {
 		return
 	}
 
 	switch ctrl.Action {
-	case "connect":
-		h.handleConnect(session, ctrl.Params)
-	case "connect_ssh":
-		h.handleConnectSSH(session, ctrl.Params)
-	case "attach_ssh":
-		h.handleAttachSSH(session, ctrl.Params)
-	case "disconnect":
-		h.handleDisconnect(session)
-	case "resize":
-		h.handleResize(session, ctrl.Params)
-	case "send_file":
-		h.handleSendFile(session, ctrl.Params)
-	case "receive_file":
-		h.handleReceiveFile(session, ctrl.Params)
+	case ws.ActionConnect:
+		var params ws.ConnectParams
+		if h.decodeParams(req, ctrl.Params, &params) {
+			h.handleConnect(req, params)
+		}
+	case ws.ActionConnectSSH:
+		var params ws.ConnectSSHParams
+		if h.decodeParams(req, ctrl.Params, &params) {
+			// Runs in the background so auth prompts can be answered meanwhile
+			go h.handleConnectSSH(req, params)
+		}
+	case ws.ActionAttachSSH:
+		var params ws.AttachSSHParams
+		if h.decodeParams(req, ctrl.Params, &params) {
+			h.handleAttachSSH(req, params)
+		}
+	case ws.ActionDuplicateSSH:
+		var params ws.DuplicateSSHParams
+		if h.decodeParams(req, ctrl.Params, &params) {
+			h.handleDuplicateSSH(req, params)
+		}
+	case ws.ActionSetEncoding:
+		var params ws.SetEncodingParams
+		if h.decodeParams(req, ctrl.Params, &params) {
+			h.handleSetEncoding(req, params)
+		}
+	case ws.ActionExecSSH:
+		var params ws.ExecSSHParams
+		if h.decodeParams(req, ctrl.Params, &params) {
+			// Runs in the background so the terminal stays usable meanwhile
+			go h.handleExecSSH(req, params)
+		}
+	case ws.ActionDisconnect:
+		h.handleDisconnect(req)
+	case ws.ActionCloseSession:
+		h.handleCloseSession(req)
+	case ws.ActionResize:
+		var params ws.ResizeParams
+		if h.decodeParams(req, ctrl.Params, &params) {
+			h.handleResize(req, params)
+		}
+	case ws.ActionSendFile:
+		var params ws.SendFileParams
+		if h.decodeParams(req, ctrl.Params, &params) {
+			h.handleSendFile(req, params)
+		}
+	case ws.ActionReceiveFile:
+		var params ws.ReceiveFileParams
+		if h.decodeParams(req, ctrl.Params, &params) {
+			h.handleReceiveFile(req, params)
+		}
+	case ws.ActionStartLog:
+		var params ws.StartLogParams
+		if h.decodeParams(req, ctrl.Params, &params) {
+			h.handleStartLog(req, params)
+		}
+	case ws.ActionStopLog:
+		h.handleStopLog(req)
 	default:
-		log.Printf("[%s] Unknown control action: %s", session.ID, ctrl.Action)
-		h.sendError(session, "UNKNOWN_ACTION", "Unknown control action")
+		log.Printf("[%s] Unsupported control action: %s", session.ID, ctrl.Action)
+		h.replyErrorPayload(req, ws.ErrorPayload{
+			Code:      ws.ErrCodeUnsupportedAction,
+			Message:   "Unsupported control action",
+			Supported: req.socket.capabilities().Actions,
+		})
 	}
 }
 
 // handleConnect handles port connection
-func (h *WebSocketHandler) handleConnect(session *Session, params map[string]interface{}) {
-	// Parse port configuration from params
-	config := serial.DefaultSerialConfig()
+func (h *WebSocketHandler) handleConnect(req *request, params ws.ConnectParams) {
+	session := req.session()
 
-	if port, ok := params["port"].(string); ok {
-		config.Port = port
+	// Apply the given port configuration over the defaults
+	config := serial.DefaultSerialConfig()
+	config.Port = params.Port
+	if params.BaudRate > 0 {
+		config.BaudRate = params.BaudRate
+	}
+	if params.DataBits > 0 {
+		config.DataBits = params.DataBits
 	}
-	if baudRate, ok := params["baud_rate"].(float64); ok {
-		config.BaudRate = int(baudRate)
+	switch params.StopBits {
+	case 1:
+		config.StopBits = serial.StopBits1
+	case 1.5:
+		config.StopBits = serial.StopBits1_5
+	case 2:
+		config.StopBits = serial.StopBits2
 	}
-	if dataBits, ok := params["data_bits"].(float64); ok {
-		config.DataBits = int(dataBits)
+	if params.Parity != "" {
+		config.Parity = serial.Parity(params.Parity)
+	}
+	if params.FlowControl != "" {
+		config.FlowControl = serial.FlowControl(params.FlowControl)
 	}
 
 	// Open port
 	port, err := h.serialManager.Open(config)
 	if err != nil {
-		h.sendError(session, "OPEN_FAILED", err.Error())
+		h.replyError(req, "OPEN_FAILED", err.Error())
 		return
 	}
 
@@ -227,140 +534,373 @@ func (h *WebSocketHandler) handleConnect(session *Session, params map[string]int
 	session.port = port
 	session.connType = ConnTypeSerial
 	session.mu.Unlock()
+	h.setDetachGrace(session, params.DetachParams)
 
-	h.sendStatus(session, "connected", "Port opened successfully")
+	h.replyStatus(req, "connected", "Port opened successfully")
 
 	// Start reading from port
 	go h.readFromPort(session)
 }
 
 // handleConnectSSH handles SSH connection
-func (h *WebSocketHandler) handleConnectSSH(session *Session, params map[string]interface{}) {
-	// Parse SSH configuration from params
-	config := ssh.DefaultSSHConfig()
+func (h *WebSocketHandler) handleConnectSSH(req *request, params ws.ConnectSSHParams) {
+	session := req.session()
 
-	if host, ok := params["host"].(string); ok {
-		config.Host = host
-	}
-	if port, ok := params["port"].(float64); ok {
-		config.Port = int(port)
-	}
-	if username, ok := params["username"].(string); ok {
-		config.Username = username
-	}
-	if password, ok := params["password"].(string); ok {
-		config.Password = password
-	}
-	if authMethod, ok := params["auth_method"].(string); ok {
-		config.AuthMethod = ssh.AuthMethod(authMethod)
-	}
-	if privateKey, ok := params["private_key"].(string); ok {
-		config.PrivateKey = privateKey
-	}
-	if privateKeyPath, ok := params["private_key_path"].(string); ok {
-		config.PrivateKeyPath = privateKeyPath
+	// Connects run outside the read loop; only one may be in flight
+	session.mu.Lock()
+	if session.closed {
+		session.mu.Unlock()
+		h.replyError(req, "SESSION_CLOSED", "Session closed")
+		return
 	}
-	if passphrase, ok := params["private_key_passphrase"].(string); ok {
-		config.PrivateKeyPassphrase = passphrase
+	if session.connecting {
+		session.mu.Unlock()
+		h.replyError(req, "SSH_CONNECT_IN_PROGRESS", "An SSH connect is already in progress")
+		return
 	}
-	if cols, ok := params["cols"].(float64); ok {
-		config.Cols = int(cols)
+	session.connecting = true
+	session.mu.Unlock()
+
+	defer func() {
+		session.mu.Lock()
+		session.connecting = false
+		session.mu.Unlock()
+	}()
+
+	// Defaults are applied after merging ~/.ssh/config so explicit params
+	// take precedence
+	config := sshConfigFromParams(params)
+	config.PromptHandler = func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+		return h.promptUser(session, user, instruction, questions, echos)
 	}
-	if rows, ok := params["rows"].(float64); ok {
-		config.Rows = int(rows)
+
+	config, err := ssh.ResolveHostAlias(config)
+	if err != nil {
+		h.replyError(req, ws.ErrCodeInvalidParams, err.Error())
+		return
 	}
+	config = config.WithDefaults()
 
 	// Connect SSH
 	client, err := h.sshManager.Connect(session.ID, config)
 	if err != nil {
 		log.Printf("[%s] SSH connection failed: %v", session.ID, err)
-		h.sendError(session, "SSH_CONNECT_FAILED", err.Error())
+		h.replyError(req, "SSH_CONNECT_FAILED", err.Error())
 		return
 	}
 
-	log.Printf("[%s] SSH connected: %s@%s:%d", session.ID, config.Username, config.Host, config.Port)
+	h.bindSSHClient(session, client)
 
-	// Set data handler
-	client.SetDataHandler(func(data []byte) {
-		// Send data to WebSocket
-		encoded := base64.StdEncoding.EncodeToString(data)
-		dataPayload := ws.DataPayload{
-			Data:     encoded,
-			Encoding: "base64",
-		}
+	// The session may have closed while connecting, without seeing the client
+	session.mu.Lock()
+	if session.closed {
+		session.mu.Unlock()
+		log.Printf("[%s] Session closed while connecting, dropping SSH connection", session.ID)
+		h.sshManager.Close(session.ID)
+		h.replyError(req, "SESSION_CLOSED", "Session closed")
+		return
+	}
+	session.sshClient = client
+	session.connType = ConnTypeSSH
+	session.mu.Unlock()
 
-		payloadJSON, _ := json.Marshal(dataPayload)
-		msg := ws.Message{
-			Type:      ws.MsgTypeData,
-			SessionID: session.ID,
-			Payload:   payloadJSON,
-			Timestamp: time.Now().UnixMilli(),
+	log.Printf("[%s] SSH connected: %s@%s:%d (auth: %s)", session.ID, config.Username, config.Host, config.Port, client.AuthMethodUsed())
+
+	h.setDetachGrace(session, params.DetachParams)
+
+	h.replyStatus(req, "connected", fmt.Sprintf("SSH connected successfully (auth: %s)", client.AuthMethodUsed()))
+}
+
+// sshConfigFromParams converts connect_ssh params, including those of each
+// jump host, to an SSH configuration
+func sshConfigFromParams(params ws.ConnectSSHParams) ssh.SSHConfig {
+	config := ssh.SSHConfig{
+		HostAlias:            params.HostAlias,
+		Host:                 params.Host,
+		Port:                 params.Port,
+		Username:             params.Username,
+		AuthMethod:           ssh.AuthMethod(params.AuthMethod),
+		Password:             params.Password,
+		PrivateKey:           params.PrivateKey,
+		PrivateKeyPassphrase: params.PrivateKeyPassphrase,
+		ForwardAgent:         params.ForwardAgent,
+		Certificate:          params.Certificate,
+		HostCertAuthorities:  params.HostCertAuthorities,
+		Ciphers:              params.Ciphers,
+		KeyExchanges:         params.KeyExchanges,
+		MACs:                 params.MACs,
+		HostKeyAlgorithms:    params.HostKeyAlgorithms,
+		TerminalType:         params.TerminalType,
+		TerminalModes:        params.TerminalModes,
+		Env:                  params.Env,
+		Cols:                 params.Cols,
+		Rows:                 params.Rows,
+		KeepaliveInterval:    params.KeepaliveInterval,
+		KeepaliveCountMax:    params.KeepaliveCountMax,
+		AutoReconnect:        params.AutoReconnect,
+		ReconnectMaxAttempts: params.ReconnectMaxAttempts,
+		ReconnectMaxDelay:    params.ReconnectMaxDelay,
+	}
+	for _, method := range params.AuthMethods {
+		config.AuthMethods = append(config.AuthMethods, ssh.AuthMethod(method))
+	}
+	for _, forward := range params.Forwards {
+		config.Forwards = append(config.Forwards, ssh.ForwardRule{
+			ID:          forward.ID,
+			Type:        ssh.ForwardType(forward.Type),
+			ListenAddr:  forward.ListenAddr,
+			TargetAddr:  forward.TargetAddr,
+			AllowPublic: forward.AllowPublic,
+		})
+	}
+	for _, jump := range params.JumpHosts {
+		config.JumpHosts = append(config.JumpHosts, sshConfigFromParams(jump))
+	}
+	return config
+}
+
+// promptUser sends a keyboard-interactive challenge to the client and waits for the answers
+func (h *WebSocketHandler) promptUser(session *Session, user, instruction string, questions []string, echos []bool) ([]string, error) {
+	session.mu.Lock()
+	session.promptSeq++
+	promptID := fmt.Sprintf("%s-%d", session.ID, session.promptSeq)
+	responses := make(chan ws.AuthResponsePayload, 1)
+	session.prompts[promptID] = responses
+	session.mu.Unlock()
+
+	defer func() {
+		session.mu.Lock()
+		delete(session.prompts, promptID)
+		session.mu.Unlock()
+	}()
+
+	payload := ws.AuthPromptPayload{
+		PromptID:    promptID,
+		User:        user,
+		Instruction: instruction,
+		Questions:   make([]ws.AuthPromptQuestion, len(questions)),
+		Timeout:     int(authPromptTimeout / time.Second),
+	}
+	for i, question := range questions {
+		payload.Questions[i] = ws.AuthPromptQuestion{
+			Prompt: question,
+			Echo:   i < len(echos) && echos[i],
 		}
+	}
+	payloadJSON, _ := json.Marshal(payload)
 
-		msgJSON, _ := json.Marshal(msg)
-		select {
-		case session.send <- msgJSON:
-		case <-session.stop:
+	msg := ws.Message{
+		Type:      ws.MsgTypeAuthPrompt,
+		SessionID: session.ID,
+		Payload:   payloadJSON,
+		Timestamp: time.Now().UnixMilli(),
+	}
+
+	msgJSON, _ := json.Marshal(msg)
+	if !session.push(textFrame(msgJSON)) {
+		return nil, fmt.Errorf("session closed")
+	}
+
+	timer := time.NewTimer(authPromptTimeout)
+	defer timer.Stop()
+
+	select {
+	case resp := <-responses:
+		if resp.Cancel {
+			return nil, fmt.Errorf("authentication cancelled by user")
 		}
-	})
+		if len(resp.Answers) != len(questions) {
+			return nil, fmt.Errorf("expected %d answers, got %d", len(questions), len(resp.Answers))
+		}
+		return resp.Answers, nil
+	case <-timer.C:
+		return nil, fmt.Errorf("authentication prompt timed out")
+	case <-session.stop:
+		return nil, fmt.Errorf("session closed")
+	}
+}
+
+// handleAuthResponse delivers the client's answers to a pending auth prompt
+func (h *WebSocketHandler) handleAuthResponse(req *request, payload json.RawMessage) {
+	session := req.session()
+
+	var resp ws.AuthResponsePayload
+	if err := json.Unmarshal(payload, &resp); err != nil {
+		h.replyError(req, "INVALID_AUTH_RESPONSE", "Invalid auth response payload")
+		return
+	}
 
 	session.mu.Lock()
-	session.sshClient = client
-	session.connType = ConnTypeSSH
+	responses, exists := session.prompts[resp.PromptID]
 	session.mu.Unlock()
 
-	h.sendStatus(session, "connected", "SSH connected successfully")
+	if !exists {
+		h.replyError(req, "PROMPT_NOT_FOUND", "Auth prompt not found or expired")
+		return
+	}
+
+	select {
+	case responses <- resp:
+	default:
+		// Prompt was already answered
+	}
 }
 
 // handleAttachSSH attaches an existing SSH session to this WebSocket
-func (h *WebSocketHandler) handleAttachSSH(session *Session, params map[string]interface{}) {
-	sshSessionID, ok := params["session_id"].(string)
-	if !ok || sshSessionID == "" {
-		h.sendError(session, "INVALID_SESSION_ID", "SSH session ID required")
-		return
-	}
+func (h *WebSocketHandler) handleAttachSSH(req *request, params ws.AttachSSHParams) {
+	session := req.session()
 
 	// Get SSH client from manager
-	client, exists := h.sshManager.Get(sshSessionID)
+	client, exists := h.sshManager.Get(params.SessionID)
 	if !exists {
-		h.sendError(session, "SSH_SESSION_NOT_FOUND", "SSH session not found")
+		h.replyError(req, "SSH_SESSION_NOT_FOUND", "SSH session not found")
 		return
 	}
 
-	// Set data handler to forward SSH output to WebSocket
+	h.bindSSHClient(session, client)
+
+	session.mu.Lock()
+	session.sshClient = client
+	session.sshSession = params.SessionID
+	session.connType = ConnTypeSSH
+	session.mu.Unlock()
+	h.setDetachGrace(session, params.DetachParams)
+
+	h.replyStatus(req, "connected", "Attached to SSH session")
+}
+
+// handleDuplicateSSH opens another shell on the connection of an existing SSH
+// session, without dialing or authenticating again
+func (h *WebSocketHandler) handleDuplicateSSH(req *request, params ws.DuplicateSSHParams) {
+	session := req.session()
+
+	client, err := h.sshManager.Duplicate(session.ID, params.SessionID, params.Cols, params.Rows)
+	if err != nil {
+		log.Printf("[%s] SSH duplicate of %s failed: %v", session.ID, params.SessionID, err)
+		h.replyError(req, "SSH_DUPLICATE_FAILED", err.Error())
+		return
+	}
+
+	h.bindSSHClient(session, client)
+
+	session.mu.Lock()
+	session.sshClient = client
+	session.connType = ConnTypeSSH
+	session.mu.Unlock()
+	h.setDetachGrace(session, params.DetachParams)
+
+	h.replyStatus(req, "connected", "SSH session duplicated")
+}
+
+// bindSSHClient forwards SSH output and state changes to the WebSocket
+func (h *WebSocketHandler) bindSSHClient(session *Session, client *ssh.Client) {
 	client.SetDataHandler(func(data []byte) {
-		encoded := base64.StdEncoding.EncodeToString(data)
-		dataPayload := ws.DataPayload{
-			Data:     encoded,
-			Encoding: "base64",
-		}
+		h.sendData(session, data)
+	})
 
-		payloadJSON, _ := json.Marshal(dataPayload)
-		msg := ws.Message{
-			Type:      ws.MsgTypeData,
-			SessionID: session.ID,
-			Payload:   payloadJSON,
-			Timestamp: time.Now().UnixMilli(),
+	client.SetStatusHandler(func(state, reason string) {
+		h.sendSSHStatus(session, client, state, reason)
+	})
+}
+
+// handleExecSSH runs a command without a PTY on an SSH connection and streams
+// its output as exec messages
+func (h *WebSocketHandler) handleExecSSH(req *request, params ws.ExecSSHParams) {
+	session := req.session()
+
+	// Use the given SSH session, or the one this WebSocket is connected to
+	session.mu.Lock()
+	client := session.sshClient
+	closed := session.closed
+	session.mu.Unlock()
+	if closed {
+		h.replyError(req, "SESSION_CLOSED", "Session closed")
+		return
+	}
+	if params.SessionID != "" {
+		var exists bool
+		client, exists = h.sshManager.Get(params.SessionID)
+		if !exists {
+			h.replyError(req, "SSH_SESSION_NOT_FOUND", "SSH session not found")
+			return
 		}
+	}
+	if client == nil {
+		h.replyError(req, "NOT_CONNECTED", "Not connected to SSH")
+		return
+	}
+
+	execID := params.ExecID
+	if execID == "" {
+		execID = fmt.Sprintf("exec-%d", time.Now().UnixNano())
+	}
 
-		msgJSON, _ := json.Marshal(msg)
+	timeout := defaultExecTimeout
+	if params.Timeout > 0 {
+		timeout = time.Duration(params.Timeout) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// Abort the command if the WebSocket goes away
+	go func() {
 		select {
-		case session.send <- msgJSON:
 		case <-session.stop:
+			cancel()
+		case <-ctx.Done():
 		}
-	})
+	}()
 
-	session.mu.Lock()
-	session.sshClient = client
-	session.sshSession = sshSessionID
-	session.connType = ConnTypeSSH
-	session.mu.Unlock()
+	stdout := &execWriter{h: h, req: req, execID: execID, stream: "stdout"}
+	stderr := &execWriter{h: h, req: req, execID: execID, stream: "stderr"}
+
+	result := ws.ExecPayload{ExecID: execID, Done: true}
+	exit, err := client.Exec(ctx, params.Command, stdout, stderr)
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.ExitCode = &exit.Code
+		result.ExitSignal = exit.Signal
+	}
+	result.Truncated = stdout.truncated || stderr.truncated
+	h.sendExec(req, result)
+}
+
+// execWriter streams one output stream of an exec command. Exec messages
+// aren't subject to the data high water mark, so like the REST API it stops
+// at execOutputLimit and discards the rest.
+type execWriter struct {
+	h         *WebSocketHandler
+	req       *request
+	execID    string
+	stream    string
+	sent      int
+	truncated bool
+}
+
+func (w *execWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := execOutputLimit - w.sent; len(p) > room {
+		w.truncated = true
+		p = p[:room]
+	}
+	if len(p) == 0 {
+		return n, nil
+	}
+	w.sent += len(p)
 
-	h.sendStatus(session, "connected", "Attached to SSH session")
+	w.h.sendExec(w.req, ws.ExecPayload{
+		ExecID: w.execID,
+		Stream: w.stream,
+		Data:   base64.StdEncoding.EncodeToString(p),
+	})
+	return n, nil
 }
 
 // handleDisconnect handles port/SSH disconnection
-func (h *WebSocketHandler) handleDisconnect(session *Session) {
+func (h *WebSocketHandler) handleDisconnect(req *request) {
+	session := req.session()
+
 	session.mu.Lock()
 	defer session.mu.Unlock()
 
@@ -376,25 +916,19 @@ func (h *WebSocketHandler) handleDisconnect(session *Session) {
 	}
 
 	session.connType = ""
-	h.sendStatus(session, "disconnected", "Connection closed")
+	h.replyStatus(req, "disconnected", "Connection closed")
 }
 
 // handleResize handles terminal resize
-func (h *WebSocketHandler) handleResize(session *Session, params map[string]interface{}) {
-	cols, okCols := params["cols"].(float64)
-	rows, okRows := params["rows"].(float64)
-
-	if !okCols || !okRows {
-		h.sendError(session, "INVALID_PARAMS", "Missing cols or rows")
-		return
-	}
+func (h *WebSocketHandler) handleResize(req *request, params ws.ResizeParams) {
+	session := req.session()
 
 	session.mu.Lock()
 	defer session.mu.Unlock()
 
 	if session.connType == ConnTypeSSH && session.sshClient != nil {
-		if err := session.sshClient.Resize(int(cols), int(rows)); err != nil {
-			h.sendError(session, "RESIZE_FAILED", err.Error())
+		if err := session.sshClient.Resize(params.Cols, params.Rows); err != nil {
+			h.replyError(req, "RESIZE_FAILED", err.Error())
 			return
 		}
 	}
@@ -402,13 +936,64 @@ func (h *WebSocketHandler) handleResize(session *Session, params map[string]inte
 }
 
 // handleData handles data transmission
-func (h *WebSocketHandler) handleData(session *Session, payload json.RawMessage) {
+func (h *WebSocketHandler) handleData(req *request, payload json.RawMessage) {
 	var data ws.DataPayload
 	if err := json.Unmarshal(payload, &data); err != nil {
-		h.sendError(session, "INVALID_DATA", "Invalid data payload")
+		h.replyError(req, "INVALID_DATA", "Invalid data payload")
 		return
 	}
 
+	// Decode data
+	decoded, err := base64.StdEncoding.DecodeString(data.Data)
+	if err != nil {
+		h.replyError(req, "DECODE_ERROR", "Failed to decode data")
+		return
+	}
+
+	h.writeToConnection(req, decoded)
+}
+
+// handleBinary routes incoming binary frames to their session
+func (h *WebSocketHandler) handleBinary(socket *Socket, data []byte) {
+	var frame ws.BinaryFrame
+	if err := frame.UnmarshalBinary(data); err != nil {
+		h.sendSocketError(socket, "", "INVALID_FRAME", err.Error())
+		return
+	}
+	req := &request{sessionID: frame.SessionID, socket: socket}
+
+	// Binary frames are only accepted once binary encoding was negotiated
+	if supported := socket.capabilities().Encodings; !slices.Contains(supported, ws.EncodingBinary) {
+		h.replyErrorPayload(req, ws.ErrorPayload{
+			Code:      ws.ErrCodeUnsupportedEncoding,
+			Message:   "Binary frames were not negotiated",
+			Supported: supported,
+		})
+		return
+	}
+
+	sub, ok := socket.subscription(frame.SessionID)
+	if !ok {
+		h.replyError(req, "UNKNOWN_SESSION", "Unknown session ID in binary frame")
+		return
+	}
+	req.sub = sub
+	if !h.checkWritable(req) {
+		return
+	}
+
+	switch frame.Type {
+	case ws.FrameTypeData:
+		h.writeToConnection(req, frame.Payload)
+	default:
+		h.replyError(req, "UNKNOWN_TYPE", "Unknown binary frame type")
+	}
+}
+
+// writeToConnection writes terminal input to the session's serial port or SSH client
+func (h *WebSocketHandler) writeToConnection(req *request, data []byte) {
+	session := req.session()
+
 	session.mu.Lock()
 	port := session.port
 	sshClient := session.sshClient
@@ -416,31 +1001,50 @@ func (h *WebSocketHandler) handleData(session *Session, payload json.RawMessage)
 	session.mu.Unlock()
 
 	if connType == "" {
-		h.sendError(session, "NOT_CONNECTED", "No connection established")
-		return
-	}
-
-	// Decode data
-	decoded, err := base64.StdEncoding.DecodeString(data.Data)
-	if err != nil {
-		h.sendError(session, "DECODE_ERROR", "Failed to decode data")
+		h.replyError(req, "NOT_CONNECTED", "No connection established")
 		return
 	}
 
 	// Write to appropriate connection
 	if connType == ConnTypeSerial && port != nil {
-		if _, err := port.Write(decoded); err != nil {
-			h.sendError(session, "WRITE_ERROR", err.Error())
+		if _, err := port.Write(data); err != nil {
+			h.replyError(req, "WRITE_ERROR", err.Error())
 			return
 		}
 	} else if connType == ConnTypeSSH && sshClient != nil {
-		if _, err := sshClient.Write(decoded); err != nil {
-			h.sendError(session, "WRITE_ERROR", err.Error())
+		if _, err := sshClient.Write(data); err != nil {
+			h.replyError(req, "WRITE_ERROR", err.Error())
 			return
 		}
 	}
 }
 
+// handleSetEncoding switches how data messages are sent to the requesting client
+func (h *WebSocketHandler) handleSetEncoding(req *request, params ws.SetEncodingParams) {
+	sub := req.sub
+	session := sub.session
+
+	supported := req.socket.capabilities().Encodings
+	if !slices.Contains(supported, params.Encoding) {
+		h.replyErrorPayload(req, ws.ErrorPayload{
+			Code:      ws.ErrCodeUnsupportedEncoding,
+			Message:   "Unsupported data encoding",
+			Field:     "encoding",
+			Supported: supported,
+		})
+		return
+	}
+
+	session.outMu.Lock()
+	sub.encoding = params.Encoding
+	session.outMu.Unlock()
+
+	sub.queue.push(replyFrame(ws.MsgTypeStatus, session.ID, req.id, ws.StatusPayload{
+		State:   "encoding",
+		Message: "Data encoding set to " + params.Encoding,
+	}))
+}
+
 // readFromPort reads data from the serial port and sends to WebSocket
 func (h *WebSocketHandler) readFromPort(session *Session) {
 	buf := make([]byte, 1024)
@@ -466,94 +1070,133 @@ func (h *WebSocketHandler) readFromPort(session *Session) {
 		}
 
 		if n > 0 {
-			// Send data to WebSocket
-			encoded := base64.StdEncoding.EncodeToString(buf[:n])
-			dataPayload := ws.DataPayload{
-				Data:     encoded,
-				Encoding: "base64",
-			}
-
-			payloadJSON, _ := json.Marshal(dataPayload)
-			msg := ws.Message{
-				Type:      ws.MsgTypeData,
-				SessionID: session.ID,
-				Payload:   payloadJSON,
-				Timestamp: time.Now().UnixMilli(),
-			}
-
-			msgJSON, _ := json.Marshal(msg)
-			select {
-			case session.send <- msgJSON:
-			case <-session.stop:
+			if !h.sendData(session, buf[:n]) {
 				return
 			}
 		}
 	}
 }
 
-// sendStatus sends a status message
-func (h *WebSocketHandler) sendStatus(session *Session, state, message string) {
-	payload := ws.StatusPayload{
-		State:   state,
-		Message: message,
+// encodeData builds a data frame in the subscriber's data encoding
+func (h *WebSocketHandler) encodeData(sub *subscriber, data []byte) outboundFrame {
+	session := sub.session
+
+	session.outMu.Lock()
+	encoding := sub.encoding
+	session.outMu.Unlock()
+
+	if encoding == ws.EncodingBinary {
+		binaryFrame := ws.BinaryFrame{
+			Type:      ws.FrameTypeData,
+			SessionID: session.ID,
+			Payload:   data,
+		}
+		frameData, _ := binaryFrame.MarshalBinary()
+		return outboundFrame{messageType: websocket.BinaryMessage, data: frameData}
 	}
-	payloadJSON, _ := json.Marshal(payload)
 
+	dataPayload := ws.DataPayload{
+		Data:     base64.StdEncoding.EncodeToString(data),
+		Encoding: "base64",
+	}
+
+	payloadJSON, _ := json.Marshal(dataPayload)
 	msg := ws.Message{
-		Type:      ws.MsgTypeStatus,
+		Type:      ws.MsgTypeData,
 		SessionID: session.ID,
 		Payload:   payloadJSON,
 		Timestamp: time.Now().UnixMilli(),
 	}
 
 	msgJSON, _ := json.Marshal(msg)
-	select {
-	case session.send <- msgJSON:
-	default:
-	}
+	return textFrame(msgJSON)
 }
 
-// sendError sends an error message
-func (h *WebSocketHandler) sendError(session *Session, code, message string) {
-	payload := ws.ErrorPayload{
-		Code:    code,
+// sendStatus sends a status message
+func (h *WebSocketHandler) sendStatus(session *Session, state, message string) {
+	h.sendStatusWithReason(session, state, message, "")
+}
+
+// sendStatusWithReason sends a status message explaining a state change
+func (h *WebSocketHandler) sendStatusWithReason(session *Session, state, message, reason string) {
+	h.sendStatusPayload(session, ws.StatusPayload{
+		State:   state,
 		Message: message,
-	}
+		Reason:  reason,
+	})
+}
+
+// sendStatusPayload sends a status message
+func (h *WebSocketHandler) sendStatusPayload(session *Session, payload ws.StatusPayload) {
 	payloadJSON, _ := json.Marshal(payload)
 
 	msg := ws.Message{
-		Type:      ws.MsgTypeError,
+		Type:      ws.MsgTypeStatus,
 		SessionID: session.ID,
 		Payload:   payloadJSON,
 		Timestamp: time.Now().UnixMilli(),
 	}
 
 	msgJSON, _ := json.Marshal(msg)
-	select {
-	case session.send <- msgJSON:
-	default:
+	session.push(textFrame(msgJSON))
+}
+
+// sendSSHStatus reports an SSH connection state change, including the exit
+// status once the remote shell has ended
+func (h *WebSocketHandler) sendSSHStatus(session *Session, client *ssh.Client, state, reason string) {
+	payload := ws.StatusPayload{
+		State:   state,
+		Message: "SSH connection lost",
+		Reason:  reason,
+	}
+	switch state {
+	case ssh.StateConnected:
+		payload.Message = "SSH reconnected"
+	case ssh.StateReconnecting:
+		payload.Message = "Reconnecting SSH session"
+	case ssh.StateDisconnected:
+		if exit := client.ExitStatus(); exit != nil {
+			payload.Message = "SSH session ended"
+			payload.ExitCode = &exit.Code
+			payload.ExitSignal = exit.Signal
+		}
 	}
+	h.sendStatusPayload(session, payload)
 }
 
-// closeSession closes a session and cleans up
-func (h *WebSocketHandler) closeSession(session *Session) {
-	close(session.stop)
+// sendSocketMessage sends a message through the socket itself, for sessions
+// that are closed or were never opened
+func (h *WebSocketHandler) sendSocketMessage(socket *Socket, msgType ws.MessageType, sessionID string, payload interface{}) {
+	socket.control.push(messageFrame(msgType, sessionID, payload))
+}
 
-	session.mu.Lock()
-	if session.port != nil {
-		portName := session.port.GetConfig().Port
-		h.serialManager.Close(portName)
-	}
-	if session.sshClient != nil {
-		h.sshManager.Close(session.ID)
+// messageFrame encodes a JSON message for the writer
+func messageFrame(msgType ws.MessageType, sessionID string, payload interface{}) outboundFrame {
+	return replyFrame(msgType, sessionID, "", payload)
+}
+
+// replyFrame encodes a JSON message answering the request with the given ID
+func replyFrame(msgType ws.MessageType, sessionID, requestID string, payload interface{}) outboundFrame {
+	payloadJSON, _ := json.Marshal(payload)
+
+	msg := ws.Message{
+		Type:      msgType,
+		SessionID: sessionID,
+		RequestID: requestID,
+		Payload:   payloadJSON,
+		Timestamp: time.Now().UnixMilli(),
 	}
-	session.mu.Unlock()
 
-	h.mu.Lock()
-	delete(h.sessions, session.ID)
-	h.mu.Unlock()
+	msgJSON, _ := json.Marshal(msg)
+	return textFrame(msgJSON)
+}
 
-	close(session.send)
+// sendSocketError sends an error that can't be delivered through a session
+func (h *WebSocketHandler) sendSocketError(socket *Socket, sessionID, code, message string) {
+	h.sendSocketMessage(socket, ws.MsgTypeError, sessionID, ws.ErrorPayload{
+		Code:    code,
+		Message: message,
+	})
 }
 
 // generateSessionID generates a unique session ID
@@ -565,137 +1208,140 @@ func randomString(n int) string {
 	const letters = "abcdefghijklmnopqrstuvwxyz0123456789"
 	b := make([]byte, n)
 	for i := range b {
-		b[i] = letters[time.Now().UnixNano()%int64(len(letters))]
+		b[i] = letters[rand.IntN(len(letters))]
 	}
 	return string(b)
 }
 
+// checkFileProtocol reports whether a requested file transfer protocol is
+// supported, replying with the supported ones when it isn't
+func (h *WebSocketHandler) checkFileProtocol(req *request, protocol string) bool {
+	supported := []string{ws.FileProtocolXMODEM, ws.FileProtocolXMODEM1K, ws.FileProtocolYMODEM}
+	if protocol != "" && !slices.Contains(supported, protocol) {
+		h.replyErrorPayload(req, ws.ErrorPayload{
+			Code:      ws.ErrCodeUnsupportedProtocol,
+			Message:   "Unsupported file transfer protocol",
+			Field:     "protocol",
+			Supported: supported,
+		})
+		return false
+	}
+	return true
+}
+
 // handleSendFile handles sending a file using XMODEM protocol
-func (h *WebSocketHandler) handleSendFile(session *Session, params map[string]interface{}) {
+func (h *WebSocketHandler) handleSendFile(req *request, params ws.SendFileParams) {
+	session := req.session()
+
 	session.mu.Lock()
 	port := session.port
 	session.mu.Unlock()
 
 	if port == nil {
-		h.sendError(session, "NOT_CONNECTED", "No port connected")
+		h.replyError(req, "NOT_CONNECTED", "No port connected")
 		return
 	}
 
-	// Get file data (base64 encoded)
-	fileDataStr, ok := params["data"].(string)
-	if !ok {
-		h.sendError(session, "INVALID_PARAMS", "Missing or invalid 'data' parameter")
-		return
-	}
-
-	fileName, _ := params["file_name"].(string)
+	fileName := params.FileName
 	if fileName == "" {
 		fileName = "file.bin"
 	}
 
 	// Decode file data
-	fileData, err := base64.StdEncoding.DecodeString(fileDataStr)
+	fileData, err := base64.StdEncoding.DecodeString(params.Data)
 	if err != nil {
-		h.sendError(session, "DECODE_ERROR", "Failed to decode file data")
+		h.replyErrorPayload(req, ws.ErrorPayload{
+			Code:    "DECODE_ERROR",
+			Message: "Failed to decode file data",
+			Field:   "data",
+		})
 		return
 	}
 
 	// Determine protocol (XMODEM-CRC, XMODEM-1K/YMODEM)
+	if !h.checkFileProtocol(req, params.Protocol) {
+		return
+	}
 	useCRC := true
 	use1K := false
-	if protocol, ok := params["protocol"].(string); ok {
-		if protocol == "ymodem" || protocol == "xmodem1k" {
-			use1K = true
-		}
+	if params.Protocol == ws.FileProtocolYMODEM || params.Protocol == ws.FileProtocolXMODEM1K {
+		use1K = true
 	}
 
 	// Send file transfer start notification
-	h.sendFileTransfer(session, "start", fileName, int64(len(fileData)), 0, 0, "Starting file transfer...", "")
+	h.sendFileTransfer(req, "start", fileName, int64(len(fileData)), 0, 0, "Starting file transfer...", "")
 
 	// Create XMODEM sender
 	sender := xmodem.NewSender(port, useCRC, use1K)
 	sender.SetProgressCallback(func(sent, total int64) {
-		h.sendFileTransfer(session, "progress", fileName, total, sent, 0, "", "")
+		h.sendFileTransfer(req, "progress", fileName, total, sent, 0, "", "")
 	})
 
 	// Send file in a goroutine
 	go func() {
 		if err := sender.Send(fileData); err != nil {
-			h.sendFileTransfer(session, "error", fileName, int64(len(fileData)), 0, 0, "", err.Error())
+			h.sendFileTransfer(req, "error", fileName, int64(len(fileData)), 0, 0, "", err.Error())
 		} else {
-			h.sendFileTransfer(session, "complete", fileName, int64(len(fileData)), int64(len(fileData)), 0, "File transfer completed successfully", "")
+			h.sendFileTransfer(req, "complete", fileName, int64(len(fileData)), int64(len(fileData)), 0, "File transfer completed successfully", "")
 		}
 	}()
 }
 
 // handleReceiveFile handles receiving a file using XMODEM protocol
-func (h *WebSocketHandler) handleReceiveFile(session *Session, params map[string]interface{}) {
+func (h *WebSocketHandler) handleReceiveFile(req *request, params ws.ReceiveFileParams) {
+	session := req.session()
+
 	session.mu.Lock()
 	port := session.port
 	session.mu.Unlock()
 
 	if port == nil {
-		h.sendError(session, "NOT_CONNECTED", "No port connected")
+		h.replyError(req, "NOT_CONNECTED", "No port connected")
 		return
 	}
 
-	fileName, _ := params["file_name"].(string)
+	fileName := params.FileName
 	if fileName == "" {
 		fileName = "received_file.bin"
 	}
 
-	useCRC := true
-	if protocol, ok := params["protocol"].(string); ok {
-		if protocol == "xmodem" {
-			useCRC = false
-		}
+	if !h.checkFileProtocol(req, params.Protocol) {
+		return
 	}
+	useCRC := params.Protocol != ws.FileProtocolXMODEM
 
 	// Send file transfer start notification
-	h.sendFileTransfer(session, "start", fileName, 0, 0, 0, "Starting file receive...", "")
+	h.sendFileTransfer(req, "start", fileName, 0, 0, 0, "Starting file receive...", "")
 
 	// Create XMODEM receiver
 	receiver := xmodem.NewReceiver(port, useCRC)
 	receiver.SetProgressCallback(func(received, total int64) {
-		h.sendFileTransfer(session, "progress", fileName, total, 0, received, "", "")
+		h.sendFileTransfer(req, "progress", fileName, total, 0, received, "", "")
 	})
 
 	// Receive file in a goroutine
 	go func() {
 		data, err := receiver.Receive()
 		if err != nil {
-			h.sendFileTransfer(session, "error", fileName, 0, 0, 0, "", err.Error())
+			h.sendFileTransfer(req, "error", fileName, 0, 0, 0, "", err.Error())
 		} else {
 			// Send received file data (base64 encoded)
 			encoded := base64.StdEncoding.EncodeToString(data)
-			payload := ws.FileTransferPayload{
+			session.push(replyFrame(ws.MsgTypeFileTransfer, session.ID, req.id, ws.FileTransferPayload{
 				Action:   "complete",
 				FileName: fileName,
 				FileSize: int64(len(data)),
 				Received: int64(len(data)),
 				Message:  encoded, // Using Message field for file data
-			}
-			payloadJSON, _ := json.Marshal(payload)
-
-			msg := ws.Message{
-				Type:      ws.MsgTypeFileTransfer,
-				SessionID: session.ID,
-				Payload:   payloadJSON,
-				Timestamp: time.Now().UnixMilli(),
-			}
-
-			msgJSON, _ := json.Marshal(msg)
-			select {
-			case session.send <- msgJSON:
-			default:
-			}
+			}))
 		}
 	}()
 }
 
 // sendFileTransfer sends a file transfer progress/status message
-func (h *WebSocketHandler) sendFileTransfer(session *Session, action, fileName string, fileSize, sent, received int64, message, errorMsg string) {
-	payload := ws.FileTransferPayload{
+func (h *WebSocketHandler) sendFileTransfer(req *request, action, fileName string, fileSize, sent, received int64, message, errorMsg string) {
+	session := req.session()
+	session.push(replyFrame(ws.MsgTypeFileTransfer, session.ID, req.id, ws.FileTransferPayload{
 		Action:   action,
 		FileName: fileName,
 		FileSize: fileSize,
@@ -703,19 +1349,11 @@ func (h *WebSocketHandler) sendFileTransfer(session *Session, action, fileName s
 		Received: received,
 		Message:  message,
 		Error:    errorMsg,
-	}
-	payloadJSON, _ := json.Marshal(payload)
-
-	msg := ws.Message{
-		Type:      ws.MsgTypeFileTransfer,
-		SessionID: session.ID,
-		Payload:   payloadJSON,
-		Timestamp: time.Now().UnixMilli(),
-	}
+	}))
+}
 
-	msgJSON, _ := json.Marshal(msg)
-	select {
-	case session.send <- msgJSON:
-	default:
-	}
+// sendExec sends exec output or the final result of an exec command
+func (h *WebSocketHandler) sendExec(req *request, payload ws.ExecPayload) {
+	session := req.session()
+	session.push(replyFrame(ws.MsgTypeExec, session.ID, req.id, payload))
 }
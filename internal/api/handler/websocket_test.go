@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/yourusername/fluxterm/internal/core/serial"
+	"github.com/yourusername/fluxterm/internal/core/ssh"
+	"github.com/yourusername/fluxterm/pkg/protocol/ws"
+)
+
+func TestExecWriterLimit(t *testing.T) {
+	session := &Session{ID: "s"}
+	sub := &subscriber{session: session, socket: &Socket{ID: "w"}, queue: newOutboundQueue(make(chan struct{}, 1))}
+	session.subscribers = []*subscriber{sub}
+	w := &execWriter{h: &WebSocketHandler{}, req: &request{sub: sub}, execID: "e", stream: "stdout"}
+
+	chunk := bytes.Repeat([]byte("a"), 64*1024)
+	for written := 0; written < execOutputLimit+len(chunk)*2; written += len(chunk) {
+		if n, err := w.Write(chunk); n != len(chunk) || err != nil {
+			t.Fatalf("Write = %d, %v", n, err)
+		}
+	}
+	if !w.truncated {
+		t.Error("output beyond the limit not reported as truncated")
+	}
+
+	var sent int
+	for {
+		item, _ := sub.queue.take()
+		if item == nil {
+			break
+		}
+		var msg ws.Message
+		var payload ws.ExecPayload
+		json.Unmarshal(item.frame.data, &msg)
+		json.Unmarshal(msg.Payload, &payload)
+		data, _ := base64.StdEncoding.DecodeString(payload.Data)
+		sent += len(data)
+	}
+	if sent != execOutputLimit {
+		t.Errorf("sent %d bytes, want the %d byte limit", sent, execOutputLimit)
+	}
+}
+
+// testSocket is a raw WebSocket to a handler
+type testSocket struct {
+	t         *testing.T
+	conn      *websocket.Conn
+	sessionID string // Session opened with the socket
+}
+
+// dialTestSocket connects to a new handler and reads its greeting
+func dialTestSocket(t *testing.T) *testSocket {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/ws", NewWebSocketHandler(serial.NewManager(), ssh.NewManager()).HandleWebSocket)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	s := &testSocket{t: t, conn: conn}
+	s.read(ws.MsgTypeHello)
+	s.sessionID = s.read(ws.MsgTypeStatus).SessionID
+	return s
+}
+
+// send writes a JSON message
+func (s *testSocket) send(msgType ws.MessageType, sessionID string, payload interface{}) {
+	s.t.Helper()
+
+	data, _ := json.Marshal(payload)
+	if err := s.conn.WriteJSON(ws.Message{Type: msgType, SessionID: sessionID, Payload: data}); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+// read reads the next message, which must be of msgType
+func (s *testSocket) read(msgType ws.MessageType) ws.Message {
+	s.t.Helper()
+
+	s.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg ws.Message
+	if err := s.conn.ReadJSON(&msg); err != nil {
+		s.t.Fatal(err)
+	}
+	if msg.Type != msgType {
+		s.t.Fatalf("got %s message %s, want %s", msg.Type, msg.Payload, msgType)
+	}
+	return msg
+}
+
+// readError reads an error message
+func (s *testSocket) readError() ws.ErrorPayload {
+	s.t.Helper()
+
+	var payload ws.ErrorPayload
+	json.Unmarshal(s.read(ws.MsgTypeError).Payload, &payload)
+	return payload
+}
+
+func TestNegotiatedCapabilities(t *testing.T) {
+	s := dialTestSocket(t)
+
+	// The client neither takes binary data nor opens further sessions
+	hello := ws.NewHello("test")
+	hello.Encodings = []string{ws.EncodingJSON}
+	hello.Actions = slices.DeleteFunc(slices.Clone(hello.Actions), func(action string) bool {
+		return action == ws.ActionOpenSession
+	})
+	s.send(ws.MsgTypeHello, "", hello)
+	s.read(ws.MsgTypeStatus)
+
+	s.send(ws.MsgTypeControl, s.sessionID, ws.ControlPayload{
+		Action: ws.ActionSetEncoding,
+		Params: json.RawMessage(`{"encoding":"binary"}`),
+	})
+	if err := s.readError(); err.Code != ws.ErrCodeUnsupportedEncoding || !slices.Equal(err.Supported, []string{ws.EncodingJSON}) {
+		t.Errorf("set_encoding binary: %+v", err)
+	}
+
+	frame, _ := ws.BinaryFrame{Type: ws.FrameTypeData, SessionID: s.sessionID, Payload: []byte("x")}.MarshalBinary()
+	if err := s.conn.WriteMessage(websocket.BinaryMessage, frame); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.readError(); err.Code != ws.ErrCodeUnsupportedEncoding {
+		t.Errorf("binary frame: %+v", err)
+	}
+
+	s.send(ws.MsgTypeControl, "", ws.ControlPayload{Action: ws.ActionOpenSession})
+	if err := s.readError(); err.Code != ws.ErrCodeUnsupportedAction || slices.Contains(err.Supported, ws.ActionOpenSession) {
+		t.Errorf("open_session: %+v", err)
+	}
+}
+
+func TestCapabilitiesWithoutHello(t *testing.T) {
+	s := dialTestSocket(t)
+
+	s.send(ws.MsgTypeControl, s.sessionID, ws.ControlPayload{
+		Action: ws.ActionSetEncoding,
+		Params: json.RawMessage(`{"encoding":"binary"}`),
+	})
+	var status ws.StatusPayload
+	json.Unmarshal(s.read(ws.MsgTypeStatus).Payload, &status)
+	if status.State != "encoding" {
+		t.Errorf("status = %+v, want the encoding confirmed", status)
+	}
+}
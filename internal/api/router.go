@@ -4,6 +4,7 @@ import (
 	"embed"
 	"io/fs"
 	"net/http"
+	"os"
 
 	"github.com/gin-gonic/gin"
 	"github.com/yourusername/fluxterm/internal/api/handler"
@@ -15,6 +16,9 @@ import (
 func SetupRouter(serialManager *serial.Manager, webAssets *embed.FS) *gin.Engine {
 	router := gin.Default()
 
+	// Match escaped path params, e.g. port names like %2Fdev%2FttyUSB0
+	router.UseRawPath = true
+
 	// CORS middleware - allow all origins for Wails WebView
 	router.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
@@ -37,6 +41,9 @@ func SetupRouter(serialManager *serial.Manager, webAssets *embed.FS) *gin.Engine
 	serialHandler := handler.NewSerialHandler(serialManager)
 	sshHandler := handler.NewSSHHandler(sshManager)
 	wsHandler := handler.NewWebSocketHandler(serialManager, sshManager)
+	if dir := os.Getenv("FLUXTERM_LOG_DIR"); dir != "" {
+		wsHandler.SetLogDirectory(dir)
+	}
 
 	// Health check
 	router.GET("/health", func(c *gin.Context) {
@@ -70,6 +77,20 @@ func SetupRouter(serialManager *serial.Manager, webAssets *embed.FS) *gin.Engine
 			ssh.POST("/connect", sshHandler.Connect)
 			ssh.DELETE("/:session_id", sshHandler.Disconnect)
 			ssh.GET("/:session_id/status", sshHandler.Status)
+			ssh.POST("/:session_id/exec", sshHandler.Exec)
+			ssh.POST("/:session_id/duplicate", sshHandler.Duplicate)
+			ssh.GET("/:session_id/forwards", sshHandler.ListForwards)
+			ssh.POST("/:session_id/forwards", sshHandler.AddForward)
+			ssh.DELETE("/:session_id/forwards/:forward_id", sshHandler.RemoveForward)
+		}
+
+		// WebSocket sessions
+		wsSessions := api.Group("/ws")
+		{
+			wsSessions.GET("/sessions", wsHandler.ListSessions)
+			wsSessions.GET("/sessions/:session_id/log", wsHandler.GetSessionLog)
+			wsSessions.POST("/sessions/:session_id/log", wsHandler.StartSessionLog)
+			wsSessions.DELETE("/sessions/:session_id/log", wsHandler.StopSessionLog)
 		}
 	}
 
@@ -18,6 +18,10 @@ type Port struct {
 
 // OpenPort opens a serial port with the given configuration
 func OpenPort(config SerialConfig) (*Port, error) {
+	if err := checkFlowControl(config.FlowControl); err != nil {
+		return nil, err
+	}
+
 	mode := &serial.Mode{
 		BaudRate: config.BaudRate,
 		DataBits: config.DataBits,
@@ -117,6 +121,15 @@ func (p *Port) IsClosed() bool {
 	return p.closed
 }
 
+// checkFlowControl rejects flow control other than none, which the serial
+// library can't configure
+func checkFlowControl(flow FlowControl) error {
+	if flow != "" && flow != FlowNone {
+		return fmt.Errorf("flow control %q is not supported, only %q", flow, FlowNone)
+	}
+	return nil
+}
+
 // convertParity converts our Parity type to serial.Parity
 func convertParity(p Parity) serial.Parity {
 	switch p {
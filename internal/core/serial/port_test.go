@@ -0,0 +1,23 @@
+package serial
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOpenPortRejectsFlowControl(t *testing.T) {
+	for _, flow := range []FlowControl{FlowRTSCTS, FlowXONOFF} {
+		config := DefaultSerialConfig()
+		config.Port = "/dev/null"
+		config.FlowControl = flow
+
+		port, err := OpenPort(config)
+		if err == nil {
+			port.Close()
+			t.Fatalf("opened a port with %s flow control", flow)
+		}
+		if !strings.Contains(err.Error(), "flow control") {
+			t.Errorf("%s: error = %v, want a flow control error", flow, err)
+		}
+	}
+}
@@ -33,7 +33,8 @@ const (
 	ParitySpace Parity = "space"
 )
 
-// FlowControl represents the flow control setting
+// FlowControl represents the flow control setting. OpenPort only supports
+// FlowNone.
 type FlowControl string
 
 const (
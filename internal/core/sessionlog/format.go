@@ -0,0 +1,105 @@
+package sessionlog
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// timeFormat is how arrival times are written
+const timeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// hexWidth is the number of bytes per hex dump line
+const hexWidth = 16
+
+// formatter turns session output into log file content. It carries state
+// across writes, since lines and hex offsets span them.
+type formatter struct {
+	format      Format
+	atLineStart bool  // Timestamped: the next byte starts a line
+	offset      int64 // Hex: output offset of the next byte
+}
+
+func newFormatter(format Format) formatter {
+	return formatter{format: format, atLineStart: true}
+}
+
+// render formats output that arrived at t. The returned formatter holds the
+// state after it, so a render can be discarded and redone.
+func (f formatter) render(data []byte, t time.Time) ([]byte, formatter) {
+	switch f.format {
+	case FormatTimestamped:
+		return f.renderTimestamped(data, t)
+	case FormatHex:
+		return f.renderHex(data, t)
+	}
+	return data, f
+}
+
+// renderTimestamped prefixes every line with the arrival time
+func (f formatter) renderTimestamped(data []byte, t time.Time) ([]byte, formatter) {
+	prefix := "[" + t.Format(timeFormat) + "] "
+
+	var out bytes.Buffer
+	for len(data) > 0 {
+		if f.atLineStart {
+			out.WriteString(prefix)
+			f.atLineStart = false
+		}
+
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			out.Write(data)
+			break
+		}
+		out.Write(data[:i+1])
+		data = data[i+1:]
+		f.atLineStart = true
+	}
+	return out.Bytes(), f
+}
+
+// renderHex writes a hex dump line per 16 bytes, e.g.
+//
+//	2006-01-02T15:04:05.000Z 00000010  48 65 6c 6c 6f 0d 0a                              |Hello..|
+func (f formatter) renderHex(data []byte, t time.Time) ([]byte, formatter) {
+	stamp := t.Format(timeFormat)
+
+	var out bytes.Buffer
+	for len(data) > 0 {
+		n := min(len(data), hexWidth)
+		line := data[:n]
+
+		fmt.Fprintf(&out, "%s %08x  ", stamp, f.offset)
+		for i := 0; i < hexWidth; i++ {
+			if i < n {
+				fmt.Fprintf(&out, "%02x ", line[i])
+			} else {
+				out.WriteString("   ")
+			}
+			if i == hexWidth/2-1 {
+				out.WriteByte(' ')
+			}
+		}
+
+		out.WriteString(" |")
+		for _, b := range line {
+			if b < 0x20 || b > 0x7e {
+				b = '.'
+			}
+			out.WriteByte(b)
+		}
+		out.WriteString("|\n")
+
+		f.offset += int64(n)
+		data = data[n:]
+	}
+	return out.Bytes(), f
+}
+
+// reset starts a new file; timestamped lines cut by a rotation get their
+// prefix again
+func (f formatter) reset() formatter {
+	f.atLineStart = true
+	return f
+}
@@ -0,0 +1,237 @@
+// Package sessionlog writes the output of terminal sessions to log files on
+// the backend, so it is captured even while no UI is attached.
+package sessionlog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Logger writes a session's output to rotating log files
+type Logger struct {
+	sessionID string
+	config    Config
+
+	mu        sync.Mutex
+	formatter formatter
+	file      *os.File
+	path      string
+	opened    time.Time
+	size      int64
+	index     int      // Number of files opened
+	files     []string // Files kept, oldest first
+	startedAt time.Time
+	logged    int64
+	err       error // Set once writing failed; the logger stays stopped
+}
+
+// New creates a logger for a session and opens its first log file
+func New(sessionID string, config Config) (*Logger, error) {
+	if config.Directory == "" {
+		config.Directory = DefaultDirectory
+	}
+	if config.FileName == "" {
+		config.FileName = DefaultFileName
+	}
+	if config.Format == "" {
+		config.Format = FormatPlain
+	}
+	switch config.Format {
+	case FormatPlain, FormatTimestamped, FormatHex:
+	default:
+		return nil, fmt.Errorf("unsupported log format %q", config.Format)
+	}
+
+	l := &Logger{
+		sessionID: sessionID,
+		config:    config,
+		formatter: newFormatter(config.Format),
+		startedAt: time.Now(),
+	}
+	if err := l.open(l.startedAt); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Write logs session output. Once a write fails the logger stops and
+// returns the error from then on.
+func (l *Logger) Write(data []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.err != nil {
+		return 0, l.err
+	}
+	if l.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	now := time.Now()
+	if l.config.RotateInterval > 0 && now.Sub(l.opened) >= l.config.RotateInterval {
+		if err := l.rotate(now); err != nil {
+			return 0, l.fail(err)
+		}
+	}
+
+	out, next := l.formatter.render(data, now)
+	if l.config.MaxSize > 0 && l.size > 0 && l.size+int64(len(out)) > l.config.MaxSize {
+		if err := l.rotate(now); err != nil {
+			return 0, l.fail(err)
+		}
+		out, next = l.formatter.render(data, now)
+	}
+
+	n, err := l.file.Write(out)
+	l.size += int64(n)
+	if err != nil {
+		return 0, l.fail(err)
+	}
+	l.formatter = next
+	l.logged += int64(len(data))
+	return len(data), nil
+}
+
+// Close closes the current log file
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// Status reports the logger
+func (l *Logger) Status() Status {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	status := Status{
+		Path:           l.path,
+		Format:         l.config.Format,
+		FileName:       l.config.FileName,
+		MaxSize:        l.config.MaxSize,
+		RotateInterval: int(l.config.RotateInterval / time.Second),
+		MaxFiles:       l.config.MaxFiles,
+		StartedAt:      l.startedAt,
+		BytesLogged:    l.logged,
+		FileSize:       l.size,
+		Files:          l.index,
+	}
+	if l.err != nil {
+		status.Error = l.err.Error()
+	}
+	return status
+}
+
+// fail stops the logger after a write error
+func (l *Logger) fail(err error) error {
+	l.err = err
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+	return err
+}
+
+// rotate closes the current file and continues in a new one
+func (l *Logger) rotate(now time.Time) error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	l.file = nil
+	l.formatter = l.formatter.reset()
+
+	if err := l.open(now); err != nil {
+		return err
+	}
+	l.prune()
+	return nil
+}
+
+// open creates the next log file. A name that is taken, e.g. by a rotation
+// within the same second, gets a numeric suffix.
+func (l *Logger) open(now time.Time) error {
+	name, err := expandFileName(l.config.FileName, l.sessionID, now, l.index+1)
+	if err != nil {
+		return err
+	}
+	base := filepath.Join(l.config.Directory, name)
+	if err := os.MkdirAll(filepath.Dir(base), 0755); err != nil {
+		return err
+	}
+
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	path := base
+	for i := 1; ; i++ {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			if abs, err := filepath.Abs(path); err == nil {
+				path = abs
+			}
+			l.file = file
+			l.path = path
+			l.opened = now
+			l.size = 0
+			l.index++
+			l.files = append(l.files, path)
+			return nil
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+		path = fmt.Sprintf("%s_%d%s", stem, i, ext)
+	}
+}
+
+// prune deletes the oldest files this logger wrote beyond MaxFiles
+func (l *Logger) prune() {
+	if l.config.MaxFiles <= 0 {
+		return
+	}
+	for len(l.files) > l.config.MaxFiles {
+		os.Remove(l.files[0])
+		l.files = l.files[1:]
+	}
+}
+
+// expandFileName fills a filename template. It replaces {session} with the
+// session ID, {date} with YYYY-MM-DD, {time} with HHMMSS and {index} with
+// the number of the file within the logger. The result must stay below the
+// log directory.
+func expandFileName(template, sessionID string, now time.Time, index int) (string, error) {
+	name := strings.NewReplacer(
+		"{session}", sanitize(sessionID),
+		"{date}", now.Format("2006-01-02"),
+		"{time}", now.Format("150405"),
+		"{index}", strconv.Itoa(index),
+	).Replace(template)
+
+	name = filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(name) || filepath.VolumeName(name) != "" || name == "." ||
+		name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("log file name %q must be relative to the log directory", template)
+	}
+	return name, nil
+}
+
+// sanitize makes a session ID safe to use in a file name
+func sanitize(id string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, id)
+}
@@ -0,0 +1,235 @@
+package sessionlog
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpandFileName(t *testing.T) {
+	now := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	tests := []struct {
+		template string
+		session  string
+		want     string
+		wantErr  bool
+	}{
+		{template: DefaultFileName, session: "abc", want: "abc_2026-03-04_050607.log"},
+		{template: "{session}/{index}.log", session: "abc", want: filepath.Join("abc", "3.log")},
+		{template: "{session}.log", session: "../etc/passwd", want: ".._etc_passwd.log"},
+		{template: "a/../b.log", session: "s", want: "b.log"},
+		{template: "plain.log", session: "s", want: "plain.log"},
+		{template: "../escape.log", session: "s", wantErr: true},
+		{template: "a/../../escape.log", session: "s", wantErr: true},
+		{template: "/abs.log", session: "s", wantErr: true},
+		{template: "..", session: "s", wantErr: true},
+		{template: ".", session: "s", wantErr: true},
+		{template: "", session: "s", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := expandFileName(tt.template, tt.session, now, 3)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("expandFileName(%q) error = %v, want error %v", tt.template, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("expandFileName(%q) = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := map[string]string{
+		"abc-123_X.y": "abc-123_X.y",
+		"a/b\\c":      "a_b_c",
+		"with space":  "with_space",
+		"ümlaut":      "_mlaut",
+	}
+	for id, want := range tests {
+		if got := sanitize(id); got != want {
+			t.Errorf("sanitize(%q) = %q, want %q", id, got, want)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	t1 := time.Date(2026, 3, 4, 5, 6, 7, 8_000_000, time.UTC)
+	t2 := t1.Add(time.Second)
+	stamp1, stamp2 := "[2026-03-04T05:06:07.008Z] ", "[2026-03-04T05:06:08.008Z] "
+
+	tests := []struct {
+		name   string
+		format Format
+		writes []string
+		want   string
+	}{
+		{"plain", FormatPlain, []string{"a\r\n", "b"}, "a\r\nb"},
+		{"timestamped lines", FormatTimestamped, []string{"a\nb\n"}, stamp1 + "a\n" + stamp1 + "b\n"},
+		{"timestamped line across writes", FormatTimestamped, []string{"ab", "c\nd"}, stamp1 + "abc\n" + stamp2 + "d"},
+		{"timestamped empty write", FormatTimestamped, []string{"", "a"}, stamp2 + "a"},
+		{"hex", FormatHex, []string{"Hello\r\n"},
+			"2026-03-04T05:06:07.008Z 00000000  48 65 6c 6c 6f 0d 0a                              |Hello..|\n"},
+		{"hex offsets across writes", FormatHex, []string{"0123456789abcdefXY", "Z"},
+			"2026-03-04T05:06:07.008Z 00000000  30 31 32 33 34 35 36 37  38 39 61 62 63 64 65 66  |0123456789abcdef|\n" +
+				"2026-03-04T05:06:07.008Z 00000010  58 59                                             |XY|\n" +
+				"2026-03-04T05:06:08.008Z 00000012  5a                                                |Z|\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFormatter(tt.format)
+			var out strings.Builder
+			for i, w := range tt.writes {
+				at := t1
+				if i > 0 {
+					at = t2
+				}
+				var data []byte
+				data, f = f.render([]byte(w), at)
+				out.Write(data)
+			}
+			if out.String() != tt.want {
+				t.Errorf("render() =\n%q\nwant\n%q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderIsRepeatable(t *testing.T) {
+	f := newFormatter(FormatTimestamped)
+	now := time.Now()
+
+	first, next := f.render([]byte("a\nb"), now)
+	again, _ := f.render([]byte("a\nb"), now)
+	if string(first) != string(again) {
+		t.Errorf("render changed the formatter it was called on: %q, then %q", first, again)
+	}
+
+	// A reset formatter prefixes the continued line again
+	out, _ := next.reset().render([]byte("c\n"), now)
+	if !strings.HasPrefix(string(out), "[") {
+		t.Errorf("render after reset = %q, want a timestamp prefix", out)
+	}
+}
+
+// logFiles lists the files in a log directory, sorted
+func logFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestLoggerRotatesBySize(t *testing.T) {
+	dir := t.TempDir()
+	logger, err := New("s", Config{Directory: dir, FileName: "{index}.log", MaxSize: 10, MaxFiles: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	for _, chunk := range []string{"aaaa", "bbbb", "cccc", "dddddddddddd", "ee"} {
+		if n, err := logger.Write([]byte(chunk)); err != nil || n != len(chunk) {
+			t.Fatalf("Write(%q) = %d, %v", chunk, n, err)
+		}
+	}
+
+	// 1: aaaabbbb, 2: cccc, 3: dddddddddddd (oversized, written alone), 4: ee
+	if got, want := logFiles(t, dir), []string{"3.log", "4.log"}; !slices.Equal(got, want) {
+		t.Fatalf("files = %q, want %q", got, want)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "3.log"))
+	if string(data) != "dddddddddddd" {
+		t.Errorf("3.log = %q", data)
+	}
+
+	status := logger.Status()
+	if status.Files != 4 || status.BytesLogged != 26 || status.FileSize != 2 {
+		t.Errorf("status = %+v, want 4 files, 26 bytes logged, file size 2", status)
+	}
+	if status.Path != filepath.Join(dir, "4.log") {
+		t.Errorf("path = %q", status.Path)
+	}
+}
+
+func TestLoggerRotatesByInterval(t *testing.T) {
+	dir := t.TempDir()
+	logger, err := New("s", Config{Directory: dir, FileName: "{index}.log", RotateInterval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	logger.Write([]byte("a"))
+	time.Sleep(5 * time.Millisecond)
+	logger.Write([]byte("b"))
+
+	if got, want := logFiles(t, dir), []string{"1.log", "2.log"}; !slices.Equal(got, want) {
+		t.Errorf("files = %q, want %q", got, want)
+	}
+}
+
+func TestLoggerAvoidsExistingFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "fixed.log"), []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	logger, err := New("s", Config{Directory: dir, FileName: "fixed.log", MaxSize: 1, MaxFiles: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Write([]byte("a"))
+	logger.Write([]byte("b"))
+	logger.Close()
+
+	if got, want := logFiles(t, dir), []string{"fixed.log", "fixed_1.log", "fixed_2.log"}; !slices.Equal(got, want) {
+		t.Fatalf("files = %q, want %q", got, want)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "fixed.log")); string(data) != "keep" {
+		t.Errorf("existing file overwritten: %q", data)
+	}
+}
+
+func TestLoggerClose(t *testing.T) {
+	logger, err := New("s", Config{Directory: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := logger.Close(); err != nil {
+		t.Errorf("second Close() = %v", err)
+	}
+	if _, err := logger.Write([]byte("a")); err == nil {
+		t.Error("Write after Close succeeded")
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+	}{
+		{"format", Config{Directory: t.TempDir(), Format: "binary"}},
+		{"file name", Config{Directory: t.TempDir(), FileName: "../x.log"}},
+	}
+	for _, tt := range tests {
+		if _, err := New("s", tt.config); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
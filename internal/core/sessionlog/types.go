@@ -0,0 +1,56 @@
+package sessionlog
+
+import "time"
+
+// Format selects how session output is written to a log file
+type Format string
+
+const (
+	FormatPlain       Format = "plain"       // Output as received
+	FormatTimestamped Format = "timestamped" // Each line prefixed with its arrival time
+	FormatHex         Format = "hex"         // Hex dump with offsets and arrival times
+)
+
+// Defaults, from the logging section of the project plan
+const (
+	DefaultDirectory = "logs"
+	DefaultFileName  = "{session}_{date}_{time}.log"
+	DefaultMaxSize   = 10 * 1024 * 1024
+	DefaultMaxFiles  = 5
+)
+
+// Config configures a session logger
+type Config struct {
+	Directory      string        // Log files are created below it
+	FileName       string        // Template; see expandFileName
+	Format         Format        // Default: FormatPlain
+	MaxSize        int64         // Bytes per file before rotating; 0 never rotates
+	RotateInterval time.Duration // Age of a file before rotating; 0 never rotates
+	MaxFiles       int           // Files kept, oldest deleted first; 0 keeps all
+}
+
+// DefaultConfig returns the default logger configuration
+func DefaultConfig() Config {
+	return Config{
+		Directory: DefaultDirectory,
+		FileName:  DefaultFileName,
+		Format:    FormatPlain,
+		MaxSize:   DefaultMaxSize,
+		MaxFiles:  DefaultMaxFiles,
+	}
+}
+
+// Status reports a session logger
+type Status struct {
+	Path           string    `json:"path"` // Current log file
+	Format         Format    `json:"format"`
+	FileName       string    `json:"file_name"` // Template
+	MaxSize        int64     `json:"max_size"`
+	RotateInterval int       `json:"rotate_interval"` // Seconds
+	MaxFiles       int       `json:"max_files"`
+	StartedAt      time.Time `json:"started_at"`
+	BytesLogged    int64     `json:"bytes_logged"` // Session output, before formatting
+	FileSize       int64     `json:"file_size"`
+	Files          int       `json:"files"` // Log files written, including the current one
+	Error          string    `json:"error,omitempty"`
+}
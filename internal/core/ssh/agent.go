@@ -0,0 +1,66 @@
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// agentSocket returns the ssh-agent socket path to use for a configuration
+func agentSocket(config SSHConfig) string {
+	if config.AgentSocket != "" {
+		return config.AgentSocket
+	}
+	return os.Getenv("SSH_AUTH_SOCK")
+}
+
+// dialAgent connects to the ssh-agent and makes sure it holds at least one identity
+func dialAgent(socket string) (net.Conn, agent.ExtendedAgent, error) {
+	if socket == "" {
+		return nil, nil, fmt.Errorf("SSH_AUTH_SOCK is not set and no agent socket configured")
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to ssh-agent: %w", err)
+	}
+
+	agentClient := agent.NewClient(conn)
+
+	keys, err := agentClient.List()
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to list ssh-agent identities: %w", err)
+	}
+	if len(keys) == 0 {
+		conn.Close()
+		return nil, nil, fmt.Errorf("ssh-agent has no identities")
+	}
+
+	return conn, agentClient, nil
+}
+
+// forwardAgent serves the agent channels the remote host opens from the local
+// ssh-agent. The handler can only be registered once per transport, so each
+// session just requests forwarding with requestAgentForwarding.
+func forwardAgent(client *ssh.Client, socket string) error {
+	if socket == "" {
+		return fmt.Errorf("SSH_AUTH_SOCK is not set and no agent socket configured")
+	}
+
+	if err := agent.ForwardToRemote(client, socket); err != nil {
+		return fmt.Errorf("failed to forward agent: %w", err)
+	}
+	return nil
+}
+
+// requestAgentForwarding asks the remote host to forward the agent to a session
+func requestAgentForwarding(session *ssh.Session) error {
+	if err := agent.RequestAgentForwarding(session); err != nil {
+		return fmt.Errorf("failed to request agent forwarding: %w", err)
+	}
+	return nil
+}
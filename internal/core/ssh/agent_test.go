@@ -0,0 +1,85 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// startAgent serves an ssh-agent holding one key on a unix socket
+func startAgent(t *testing.T) string {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+		t.Fatal(err)
+	}
+
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				agent.ServeAgent(keyring, conn)
+				conn.Close()
+			}()
+		}
+	}()
+	return socket
+}
+
+// waitAgentKeys waits for the server to list a forwarded agent
+func waitAgentKeys(t *testing.T, server *testServer) int {
+	t.Helper()
+
+	select {
+	case n := <-server.agentKeys:
+		return n
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the forwarded agent")
+		return 0
+	}
+}
+
+func TestAgentForwardingSharedConnection(t *testing.T) {
+	server := newTestServer(t)
+	config := server.clientConfig()
+	config.ForwardAgent = true
+	config.AgentSocket = startAgent(t)
+
+	manager := NewManager()
+	defer manager.CloseAll()
+
+	if _, err := manager.Connect("s1", config); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	if n := waitAgentKeys(t, server); n != 1 {
+		t.Errorf("first channel listed %d agent keys, want 1", n)
+	}
+
+	// A second shell on the same connection forwards the agent as well
+	if _, err := manager.Duplicate("s2", "s1", 0, 0); err != nil {
+		t.Fatalf("Duplicate: %v", err)
+	}
+	if n := waitAgentKeys(t, server); n != 1 {
+		t.Errorf("second channel listed %d agent keys, want 1", n)
+	}
+}
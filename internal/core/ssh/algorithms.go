@@ -0,0 +1,78 @@
+package ssh
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// applyAlgorithms sets the algorithm preferences of a hop on its client config
+func applyAlgorithms(config *ssh.ClientConfig, hop SSHConfig) error {
+	supported := ssh.SupportedAlgorithms()
+	insecure := ssh.InsecureAlgorithms()
+
+	var err error
+	if config.Ciphers, err = algorithmList("cipher", hop.Ciphers, supported.Ciphers, insecure.Ciphers); err != nil {
+		return err
+	}
+	if config.KeyExchanges, err = algorithmList("key exchange", hop.KeyExchanges, supported.KeyExchanges, insecure.KeyExchanges); err != nil {
+		return err
+	}
+	if config.MACs, err = algorithmList("MAC", hop.MACs, supported.MACs, insecure.MACs); err != nil {
+		return err
+	}
+	if config.HostKeyAlgorithms, err = algorithmList("host key algorithm", hop.HostKeyAlgorithms, supported.HostKeys, insecure.HostKeys); err != nil {
+		return err
+	}
+	return nil
+}
+
+// algorithmList resolves a preference list the way ssh_config does: a
+// leading "+" appends to the defaults, "-" removes from them and "^" puts
+// the algorithms first. Nil keeps the package defaults.
+func algorithmList(kind string, requested, defaults, insecure []string) ([]string, error) {
+	if len(requested) == 0 {
+		return nil, nil
+	}
+
+	var op byte
+	names := slices.Clone(requested)
+	if first := names[0]; first != "" && strings.ContainsRune("+-^", rune(first[0])) {
+		op = first[0]
+		names[0] = first[1:]
+	}
+
+	for _, name := range names {
+		if !slices.Contains(defaults, name) && !slices.Contains(insecure, name) {
+			return nil, fmt.Errorf("unsupported %s %q", kind, name)
+		}
+	}
+
+	switch op {
+	case '+':
+		list := slices.Clone(defaults)
+		for _, name := range names {
+			if !slices.Contains(list, name) {
+				list = append(list, name)
+			}
+		}
+		return list, nil
+	case '-':
+		list := slices.DeleteFunc(slices.Clone(defaults), func(name string) bool {
+			return slices.Contains(names, name)
+		})
+		if len(list) == 0 {
+			return nil, fmt.Errorf("no %s algorithms left", kind)
+		}
+		return list, nil
+	case '^':
+		list := slices.DeleteFunc(slices.Clone(defaults), func(name string) bool {
+			return slices.Contains(names, name)
+		})
+		return append(names, list...), nil
+	default:
+		return names, nil
+	}
+}
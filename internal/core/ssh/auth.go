@@ -0,0 +1,310 @@
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// authMethods returns the configured auth methods in the order they should be tried
+func authMethods(config SSHConfig) []AuthMethod {
+	if len(config.AuthMethods) > 0 {
+		return config.AuthMethods
+	}
+	return []AuthMethod{config.AuthMethod}
+}
+
+// checkAuthOrder rejects orders that put another method between agent and
+// publickey, which are tried together
+func checkAuthOrder(methods []AuthMethod) error {
+	agent := slices.Index(methods, AuthAgent)
+	publicKey := slices.Index(methods, AuthPublicKey)
+	if agent >= 0 && publicKey >= 0 && agent-publicKey != 1 && publicKey-agent != 1 {
+		return fmt.Errorf("auth methods agent and publickey must be adjacent")
+	}
+	return nil
+}
+
+// buildAuthMethods builds the ordered list of SSH auth methods.
+// Agent and public key signers are merged into a single "publickey" method
+// because the SSH client only tries each method name once, so the two must
+// be adjacent in the order.
+//
+// The method whose callback ran last is stored in attempted when it is not
+// nil: the password callback, a signature, or a keyboard-interactive
+// challenge. Methods are only tried after earlier ones failed or partially
+// succeeded, so once the handshake succeeds that is the method that
+// completed authentication. A final step that runs no callback isn't seen,
+// though: a server accepting keyboard-interactive without sending a
+// challenge leaves the method of the step before it, or none.
+func (c *Connection) buildAuthMethods(config SSHConfig, attempted *AuthMethod) ([]ssh.AuthMethod, error) {
+	methods := authMethods(config)
+	if err := checkAuthOrder(methods); err != nil {
+		return nil, err
+	}
+	record := func(method AuthMethod) {
+		if attempted != nil {
+			*attempted = method
+		}
+	}
+
+	var auths []ssh.AuthMethod
+	var signers []ssh.Signer
+	publicKeyIndex := -1
+	var errs []string
+
+	for _, method := range methods {
+		switch method {
+		case AuthPassword:
+			auths = append(auths, ssh.PasswordCallback(func() (string, error) {
+				record(AuthPassword)
+				return config.Password, nil
+			}))
+
+		case AuthPublicKey, AuthAgent:
+			var methodSigners []ssh.Signer
+			var err error
+			if method == AuthAgent {
+				methodSigners, err = c.agentSigners(config)
+			} else {
+				methodSigners, err = privateKeySigners(config)
+			}
+			if err != nil {
+				if len(methods) == 1 {
+					return nil, err
+				}
+				errs = append(errs, fmt.Sprintf("%s: %v", method, err))
+				continue
+			}
+
+			for _, signer := range methodSigners {
+				signers = append(signers, newRecordingSigner(signer, func() {
+					record(method)
+				}))
+			}
+			if publicKeyIndex < 0 {
+				publicKeyIndex = len(auths)
+				auths = append(auths, nil) // Filled in once all signers are known
+			}
+
+		case AuthKeyboardInteractive:
+			// Route challenges to the prompt handler (e.g. the WebSocket client)
+			// and fall back to answering every question with the password
+			auths = append(auths, ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+				record(AuthKeyboardInteractive)
+				if len(questions) == 0 {
+					return []string{}, nil
+				}
+				if config.PromptHandler != nil {
+					return config.PromptHandler(user, instruction, questions, echos)
+				}
+				answers := make([]string, len(questions))
+				for i := range answers {
+					answers[i] = config.Password
+				}
+				return answers, nil
+			}))
+
+		default:
+			return nil, fmt.Errorf("unsupported auth method: %s", method)
+		}
+	}
+
+	if publicKeyIndex >= 0 {
+		auths[publicKeyIndex] = ssh.PublicKeys(signers...)
+	}
+
+	if len(auths) == 0 {
+		return nil, fmt.Errorf("no usable auth methods: %s", strings.Join(errs, "; "))
+	}
+	for _, msg := range errs {
+		log.Printf("[SSH] Skipping auth method %s", msg)
+	}
+
+	return auths, nil
+}
+
+// privateKeySigners loads the configured private key
+func privateKeySigners(config SSHConfig) ([]ssh.Signer, error) {
+	var keyBytes []byte
+	var err error
+
+	// Load private key from file or use provided key
+	if config.PrivateKeyPath != "" {
+		keyBytes, err = os.ReadFile(expandHome(config.PrivateKeyPath))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read private key file: %w", err)
+		}
+	} else if config.PrivateKey != "" {
+		keyBytes = []byte(config.PrivateKey)
+	} else {
+		return nil, fmt.Errorf("no private key provided")
+	}
+
+	// Parse private key
+	var signer ssh.Signer
+	if config.PrivateKeyPassphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(keyBytes, []byte(config.PrivateKeyPassphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(keyBytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	// Present the user certificate first, then the bare key
+	cert, err := loadCertificate(config)
+	if err != nil {
+		return nil, err
+	}
+	if cert != nil {
+		if !keysEqual(cert.Key, signer.PublicKey()) {
+			return nil, fmt.Errorf("certificate does not match private key")
+		}
+		certSigner, err := ssh.NewCertSigner(cert, signer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create certificate signer: %w", err)
+		}
+		return []ssh.Signer{certSigner, signer}, nil
+	}
+
+	return []ssh.Signer{signer}, nil
+}
+
+// agentSigners loads the identities held by the ssh-agent
+func (c *Connection) agentSigners(config SSHConfig) ([]ssh.Signer, error) {
+	conn, agentClient, err := dialAgent(agentSocket(config))
+	if err != nil {
+		return nil, err
+	}
+	c.agentConns = append(c.agentConns, conn)
+
+	signers, err := agentClient.Signers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ssh-agent identities: %w", err)
+	}
+
+	// Pair a configured certificate with its key held by the agent.
+	// Certificates loaded into the agent itself are already included.
+	cert, err := loadCertificate(config)
+	if err != nil {
+		return nil, err
+	}
+	if cert != nil {
+		for _, signer := range signers {
+			if !keysEqual(cert.Key, signer.PublicKey()) {
+				continue
+			}
+			certSigner, err := ssh.NewCertSigner(cert, signer)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create certificate signer: %w", err)
+			}
+			signers = append([]ssh.Signer{certSigner}, signers...)
+			break
+		}
+	}
+
+	return signers, nil
+}
+
+// loadCertificate loads the configured OpenSSH user certificate, if any
+func loadCertificate(config SSHConfig) (*ssh.Certificate, error) {
+	var certBytes []byte
+	if config.CertificatePath != "" {
+		data, err := os.ReadFile(expandHome(config.CertificatePath))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read certificate file: %w", err)
+		}
+		certBytes = data
+	} else if config.Certificate != "" {
+		certBytes = []byte(config.Certificate)
+	} else {
+		return nil, nil
+	}
+
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(certBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("not an SSH certificate")
+	}
+	if cert.CertType != ssh.UserCert {
+		return nil, fmt.Errorf("certificate is not a user certificate")
+	}
+
+	return cert, nil
+}
+
+// expandHome expands a leading "~/" to the user's home directory
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[2:])
+}
+
+// newRecordingSigner wraps a signer so that onSign is called when the server
+// accepts its key, preserving the algorithm capabilities of the original signer
+func newRecordingSigner(signer ssh.Signer, onSign func()) ssh.Signer {
+	switch s := signer.(type) {
+	case ssh.MultiAlgorithmSigner:
+		return &recordingMultiAlgorithmSigner{MultiAlgorithmSigner: s, onSign: onSign}
+	case ssh.AlgorithmSigner:
+		return &recordingAlgorithmSigner{AlgorithmSigner: s, onSign: onSign}
+	default:
+		return &recordingPlainSigner{Signer: s, onSign: onSign}
+	}
+}
+
+type recordingPlainSigner struct {
+	ssh.Signer
+	onSign func()
+}
+
+func (s *recordingPlainSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	s.onSign()
+	return s.Signer.Sign(rand, data)
+}
+
+type recordingAlgorithmSigner struct {
+	ssh.AlgorithmSigner
+	onSign func()
+}
+
+func (s *recordingAlgorithmSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	s.onSign()
+	return s.AlgorithmSigner.Sign(rand, data)
+}
+
+func (s *recordingAlgorithmSigner) SignWithAlgorithm(rand io.Reader, data []byte, algorithm string) (*ssh.Signature, error) {
+	s.onSign()
+	return s.AlgorithmSigner.SignWithAlgorithm(rand, data, algorithm)
+}
+
+type recordingMultiAlgorithmSigner struct {
+	ssh.MultiAlgorithmSigner
+	onSign func()
+}
+
+func (s *recordingMultiAlgorithmSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	s.onSign()
+	return s.MultiAlgorithmSigner.Sign(rand, data)
+}
+
+func (s *recordingMultiAlgorithmSigner) SignWithAlgorithm(rand io.Reader, data []byte, algorithm string) (*ssh.Signature, error) {
+	s.onSign()
+	return s.MultiAlgorithmSigner.SignWithAlgorithm(rand, data, algorithm)
+}
@@ -0,0 +1,153 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// newPrivateKey returns a new ed25519 private key in PEM format
+func newPrivateKey(t *testing.T) string {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(block))
+}
+
+// checkPassword accepts testPassword
+func checkPassword(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+	if string(password) == testPassword {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("wrong password")
+}
+
+func TestAuthMethodUsed(t *testing.T) {
+	authorizedKey := newPrivateKey(t)
+	signer, err := ssh.ParsePrivateKey([]byte(authorizedKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkKey := func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+		if bytes.Equal(key.Marshal(), signer.PublicKey().Marshal()) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unknown key")
+	}
+	challenge := func(conn ssh.ConnMetadata, client ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+		answers, err := client("", "", []string{"Password: "}, []bool{false})
+		if err != nil {
+			return nil, err
+		}
+		return checkPassword(conn, []byte(answers[0]))
+	}
+
+	tests := []struct {
+		name       string
+		configure  func(*ssh.ServerConfig)
+		methods    []AuthMethod
+		privateKey string
+		want       AuthMethod
+	}{
+		{
+			name: "password",
+			configure: func(config *ssh.ServerConfig) {
+				config.PasswordCallback = checkPassword
+			},
+			methods: []AuthMethod{AuthPassword},
+			want:    AuthPassword,
+		},
+		{
+			name: "rejected key falls back to password",
+			configure: func(config *ssh.ServerConfig) {
+				config.PublicKeyCallback = checkKey
+				config.PasswordCallback = checkPassword
+			},
+			methods:    []AuthMethod{AuthPublicKey, AuthPassword},
+			privateKey: newPrivateKey(t),
+			want:       AuthPassword,
+		},
+		{
+			name: "public key before password",
+			configure: func(config *ssh.ServerConfig) {
+				config.PublicKeyCallback = checkKey
+				config.PasswordCallback = checkPassword
+			},
+			methods:    []AuthMethod{AuthPublicKey, AuthPassword},
+			privateKey: authorizedKey,
+			want:       AuthPublicKey,
+		},
+		{
+			name: "partial success",
+			configure: func(config *ssh.ServerConfig) {
+				config.PasswordCallback = func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+					if _, err := checkPassword(conn, password); err != nil {
+						return nil, err
+					}
+					return nil, &ssh.PartialSuccessError{Next: ssh.ServerAuthCallbacks{
+						KeyboardInteractiveCallback: challenge,
+					}}
+				}
+			},
+			methods: []AuthMethod{AuthPassword, AuthKeyboardInteractive},
+			want:    AuthKeyboardInteractive,
+		},
+		{
+			// Documented limit: no callback runs in the final step, so the
+			// partially successful step before it is reported
+			name: "partial success without a challenge",
+			configure: func(config *ssh.ServerConfig) {
+				config.PasswordCallback = func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+					return nil, &ssh.PartialSuccessError{Next: ssh.ServerAuthCallbacks{
+						KeyboardInteractiveCallback: func(ssh.ConnMetadata, ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+							return nil, nil
+						},
+					}}
+				}
+			},
+			methods: []AuthMethod{AuthPassword, AuthKeyboardInteractive},
+			want:    AuthPassword,
+		},
+		{
+			name: "empty challenge before password",
+			configure: func(config *ssh.ServerConfig) {
+				config.KeyboardInteractiveCallback = func(conn ssh.ConnMetadata, client ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+					client("", "Welcome", nil, nil)
+					return nil, fmt.Errorf("no keyboard-interactive for you")
+				}
+				config.PasswordCallback = checkPassword
+			},
+			methods: []AuthMethod{AuthKeyboardInteractive, AuthPassword},
+			want:    AuthPassword,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t, func(config *ssh.ServerConfig) {
+				config.PasswordCallback = nil
+				tt.configure(config)
+			})
+			config := server.clientConfig()
+			config.AuthMethods = tt.methods
+			config.PrivateKey = tt.privateKey
+
+			client := connectTestClient(t, config)
+			if got := client.AuthMethodUsed(); got != tt.want {
+				t.Errorf("AuthMethodUsed = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,38 +1,48 @@
 package ssh
 
 import (
+	"context"
 	"fmt"
 	"io"
-	"os"
 	"sync"
-	"time"
 
 	"golang.org/x/crypto/ssh"
 )
 
-// Client represents an SSH client connection
+// Client represents an interactive shell channel on an SSH connection
 type Client struct {
-	config     SSHConfig
-	client     *ssh.Client
-	session    *ssh.Session
-	stdin      io.WriteCloser
-	stdout     io.Reader
-	stderr     io.Reader
-	mu         sync.Mutex
-	connected  bool
-	onData     func([]byte)
-	stopReader chan struct{}
+	conn      *Connection
+	config    SSHConfig // Terminal settings of this channel
+	session   *ssh.Session
+	stdin     io.WriteCloser
+	stdout    io.Reader
+	stderr    io.Reader
+	mu        sync.Mutex
+	connected bool
+	closed    bool        // Closed by the user; not reopened on reconnect
+	state     string      // Reported by Status
+	reason    string      // Why the channel was closed
+	exit      *ExitStatus // How the remote shell ended, if it did
+	onData    func([]byte)
+	onStatus  func(state, reason string)
+	stop      chan struct{}
 }
 
-// NewClient creates a new SSH client
+// NewClient creates a new SSH client on its own connection
 func NewClient(config SSHConfig) *Client {
+	return newChannel(newConnection("", config), config)
+}
+
+// newChannel creates a shell channel on a connection
+func newChannel(conn *Connection, config SSHConfig) *Client {
 	return &Client{
-		config:     config,
-		stopReader: make(chan struct{}),
+		conn:   conn,
+		config: config,
+		state:  StateDisconnected,
 	}
 }
 
-// Connect establishes SSH connection
+// Connect establishes the SSH connection if needed and opens the shell
 func (c *Client) Connect() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -40,174 +50,160 @@ func (c *Client) Connect() error {
 	if c.connected {
 		return fmt.Errorf("already connected")
 	}
+	if c.closed {
+		return fmt.Errorf("client closed")
+	}
 
-	// Build SSH client config
-	sshConfig, err := c.buildSSHConfig()
-	if err != nil {
-		return fmt.Errorf("failed to build SSH config: %w", err)
+	if err := c.conn.connect(); err != nil {
+		return err
 	}
 
-	// Connect to SSH server
-	addr := fmt.Sprintf("%s:%d", c.config.Host, c.config.Port)
-	client, err := ssh.Dial("tcp", addr, sshConfig)
+	return c.open()
+}
+
+// open opens the shell on the connection, releasing the connection again
+// on failure. Must be called with c.mu held.
+func (c *Client) open() error {
+	if err := c.openShell(); err != nil {
+		c.conn.detach(c)
+		return err
+	}
+	return nil
+}
+
+// openShell opens a session with a PTY and starts the shell.
+// Must be called with c.mu held.
+func (c *Client) openShell() error {
+	client, err := c.conn.attach(c)
 	if err != nil {
-		return fmt.Errorf("failed to connect to SSH server: %w", err)
+		return err
 	}
-	c.client = client
 
 	// Create session
 	session, err := client.NewSession()
 	if err != nil {
-		client.Close()
 		return fmt.Errorf("failed to create SSH session: %w", err)
 	}
-	c.session = session
+
+	// Forward the local ssh-agent if requested
+	if c.conn.config.ForwardAgent {
+		if err := requestAgentForwarding(session); err != nil {
+			session.Close()
+			return err
+		}
+	}
 
 	// Set up terminal modes
-	modes := ssh.TerminalModes{
-		ssh.ECHO:          1,     // Enable echo
-		ssh.TTY_OP_ISPEED: 14400, // Input speed = 14.4kbaud
-		ssh.TTY_OP_OSPEED: 14400, // Output speed = 14.4kbaud
+	modes, err := terminalModes(c.config)
+	if err != nil {
+		session.Close()
+		return err
 	}
 
 	// Request pseudo terminal
 	if err := session.RequestPty(c.config.TerminalType, c.config.Rows, c.config.Cols, modes); err != nil {
 		session.Close()
-		client.Close()
 		return fmt.Errorf("failed to request PTY: %w", err)
 	}
 
+	setEnv(session, c.config.Env)
+
 	// Set up I/O
 	stdin, err := session.StdinPipe()
 	if err != nil {
 		session.Close()
-		client.Close()
 		return fmt.Errorf("failed to create stdin pipe: %w", err)
 	}
-	c.stdin = stdin
 
 	stdout, err := session.StdoutPipe()
 	if err != nil {
 		session.Close()
-		client.Close()
 		return fmt.Errorf("failed to create stdout pipe: %w", err)
 	}
-	c.stdout = stdout
 
 	stderr, err := session.StderrPipe()
 	if err != nil {
 		session.Close()
-		client.Close()
 		return fmt.Errorf("failed to create stderr pipe: %w", err)
 	}
-	c.stderr = stderr
 
 	// Start shell
 	if err := session.Shell(); err != nil {
 		session.Close()
-		client.Close()
 		return fmt.Errorf("failed to start shell: %w", err)
 	}
 
+	c.session = session
+	c.stdin = stdin
+	c.stdout = stdout
+	c.stderr = stderr
 	c.connected = true
+	c.state = StateConnected
+	c.reason = ""
+	c.exit = nil
+	c.stop = make(chan struct{})
 
 	// Start reading output
-	go c.readOutput()
+	go c.readOutput(client, session, c.stop)
 
 	return nil
 }
 
-// buildSSHConfig builds golang.org/x/crypto/ssh config
-func (c *Client) buildSSHConfig() (*ssh.ClientConfig, error) {
-	config := &ssh.ClientConfig{
-		User:            c.config.Username,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(), // TODO: Implement proper host key verification
-		Timeout:         time.Duration(c.config.ConnectTimeout) * time.Second,
+// reopen opens a new shell after the connection was re-established. A
+// channel that fails to reopen is closed, as it was already released from
+// the connection.
+func (c *Client) reopen() error {
+	c.mu.Lock()
+	if c.closed || c.connected {
+		c.mu.Unlock()
+		return nil
 	}
+	err := c.open()
+	if err != nil {
+		c.closed = true
+	}
+	c.mu.Unlock()
 
-	switch c.config.AuthMethod {
-	case AuthPassword:
-		config.Auth = []ssh.AuthMethod{
-			ssh.Password(c.config.Password),
-		}
-
-	case AuthPublicKey:
-		var keyBytes []byte
-		var err error
-
-		// Load private key from file or use provided key
-		if c.config.PrivateKeyPath != "" {
-			keyBytes, err = os.ReadFile(c.config.PrivateKeyPath)
-			if err != nil {
-				return nil, fmt.Errorf("failed to read private key file: %w", err)
-			}
-		} else if c.config.PrivateKey != "" {
-			keyBytes = []byte(c.config.PrivateKey)
-		} else {
-			return nil, fmt.Errorf("no private key provided")
-		}
-
-		// Parse private key
-		var signer ssh.Signer
-		if c.config.PrivateKeyPassphrase != "" {
-			signer, err = ssh.ParsePrivateKeyWithPassphrase(keyBytes, []byte(c.config.PrivateKeyPassphrase))
-		} else {
-			signer, err = ssh.ParsePrivateKey(keyBytes)
-		}
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse private key: %w", err)
-		}
-
-		config.Auth = []ssh.AuthMethod{
-			ssh.PublicKeys(signer),
-		}
-
-	case AuthKeyboardInteractive:
-		// For keyboard-interactive, we'll use a simple callback
-		// In a real implementation, this should prompt the user
-		config.Auth = []ssh.AuthMethod{
-			ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
-				// For now, just return the password for all questions
-				answers := make([]string, len(questions))
-				for i := range answers {
-					answers[i] = c.config.Password
-				}
-				return answers, nil
-			}),
-		}
-
-	default:
-		return nil, fmt.Errorf("unsupported auth method: %s", c.config.AuthMethod)
+	if err != nil {
+		c.emitStatus(StateDisconnected, fmt.Sprintf("failed to reopen shell: %v", err))
 	}
+	return err
+}
+
+// readOutput streams stdout and stderr to the data handler until the session
+// ends, then reports how it ended
+func (c *Client) readOutput(client *ssh.Client, session *ssh.Session, stop chan struct{}) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go c.readStream(c.stdout, stop, &wg)
+	go c.readStream(c.stderr, stop, &wg)
+	wg.Wait()
 
-	return config, nil
+	c.sessionEnded(client, session)
 }
 
-// readOutput reads from stdout and stderr
-func (c *Client) readOutput() {
+// readStream reads one output stream until it is closed
+func (c *Client) readStream(r io.Reader, stop chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+
 	buf := make([]byte, 32*1024) // 32KB buffer
 
 	for {
 		select {
-		case <-c.stopReader:
+		case <-stop:
 			return
 		default:
 		}
 
-		// Read from stdout
-		n, err := c.stdout.Read(buf)
-		if err != nil {
-			if err != io.EOF {
-				// Connection closed or error
-			}
-			return
-		}
-
+		n, err := r.Read(buf)
 		if n > 0 && c.onData != nil {
 			data := make([]byte, n)
 			copy(data, buf[:n])
 			c.onData(data)
 		}
+		if err != nil {
+			return
+		}
 	}
 }
 
@@ -245,29 +241,94 @@ func (c *Client) SetDataHandler(handler func([]byte)) {
 	c.onData = handler
 }
 
-// Close closes the SSH connection
+// Close closes the shell channel, and the connection if no other channels
+// use it
 func (c *Client) Close() error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	if !c.connected {
+	if c.closed {
+		c.mu.Unlock()
 		return nil
 	}
+	c.closed = true
+
+	if c.connected {
+		c.shutdown()
+		c.state = StateDisconnected
+		c.reason = "closed by user"
+	}
+	c.mu.Unlock()
+
+	c.conn.detach(c)
+	return nil
+}
 
-	close(c.stopReader)
+// shutdown stops reading and closes the session.
+// Must be called with c.mu held while connected.
+func (c *Client) shutdown() {
+	close(c.stop)
 
 	if c.session != nil {
 		c.session.Close()
 		c.session = nil
 	}
 
-	if c.client != nil {
-		c.client.Close()
-		c.client = nil
+	c.connected = false
+}
+
+// lost marks the channel disconnected after its connection was lost
+func (c *Client) lost(reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.connected {
+		c.shutdown()
+		c.state = StateDisconnected
+		c.reason = reason
+	}
+}
+
+// ended closes the channel after the remote shell ended, releasing the
+// connection
+func (c *Client) ended(session *ssh.Session, reason string, exit *ExitStatus) {
+	c.mu.Lock()
+	if !c.connected || c.session != session {
+		// Already closed, or reported by a previous session
+		c.mu.Unlock()
+		return
 	}
+	c.shutdown()
+	c.exit = exit
+	c.mu.Unlock()
 
-	c.connected = false
-	return nil
+	c.conn.detach(c)
+	c.emitStatus(StateDisconnected, reason)
+}
+
+// SetStatusHandler sets the handler notified when the connection state changes
+func (c *Client) SetStatusHandler(handler func(state, reason string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onStatus = handler
+}
+
+// Status returns the connection state and, when not connected, the reason
+func (c *Client) Status() (string, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state, c.reason
+}
+
+// emitStatus records a state change and notifies the status handler
+func (c *Client) emitStatus(state, reason string) {
+	c.mu.Lock()
+	c.state = state
+	c.reason = reason
+	handler := c.onStatus
+	c.mu.Unlock()
+
+	if handler != nil {
+		handler(state, reason)
+	}
 }
 
 // IsConnected returns connection status
@@ -277,7 +338,47 @@ func (c *Client) IsConnected() bool {
 	return c.connected
 }
 
+// AuthMethodUsed returns the auth method that succeeded on the last connect
+func (c *Client) AuthMethodUsed() AuthMethod {
+	return c.conn.AuthMethodUsed()
+}
+
+// ExitStatus returns how the remote shell ended, or nil if it has not
+// exited or the exit status is unknown
+func (c *Client) ExitStatus() *ExitStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.exit
+}
+
+// Connection returns the SSH connection the channel runs on
+func (c *Client) Connection() *Connection {
+	return c.conn
+}
+
+// AddForward starts a port forward on the client's connection
+func (c *Client) AddForward(rule ForwardRule) (ForwardStatus, error) {
+	return c.conn.AddForward(rule)
+}
+
+// RemoveForward stops a port forward on the client's connection
+func (c *Client) RemoveForward(id string) error {
+	return c.conn.RemoveForward(id)
+}
+
+// Forwards returns the port forwards of the client's connection
+func (c *Client) Forwards() []ForwardStatus {
+	return c.conn.Forwards()
+}
+
+// Exec runs a command on a new channel of the client's connection
+func (c *Client) Exec(ctx context.Context, command string, stdout, stderr io.Writer) (*ExitStatus, error) {
+	return c.conn.Exec(ctx, command, stdout, stderr)
+}
+
 // GetConfig returns the SSH configuration
 func (c *Client) GetConfig() SSHConfig {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.config
 }
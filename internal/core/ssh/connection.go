@@ -0,0 +1,468 @@
+package ssh
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Connection is an authenticated SSH connection carrying one or more shell
+// channels. It is closed when its last channel closes.
+type Connection struct {
+	id          string
+	config      SSHConfig
+	client      *ssh.Client
+	jumpClients []*ssh.Client // Jump host connections, outermost first
+	agentConns  []net.Conn    // Only used while dialing
+	authUsed    AuthMethod    // Auth method that succeeded
+	mu          sync.Mutex
+	connected   bool
+	closed      bool          // No further channels or reconnects
+	done        chan struct{} // Closed together with closed
+	stop        chan struct{} // Stops keepalives of the current transport
+	channels    map[*Client]struct{}
+	onLost      func(reason string) // Takes over lost connections, e.g. to reconnect
+	onClose     func()
+	forwards    map[string]*forward
+	forwardSeq  int
+	restore     []ForwardRule // Forwards to re-establish on reconnect
+}
+
+// newConnection creates an unconnected SSH connection
+func newConnection(id string, config SSHConfig) *Connection {
+	return &Connection{
+		id:       id,
+		config:   config,
+		done:     make(chan struct{}),
+		channels: make(map[*Client]struct{}),
+		forwards: make(map[string]*forward),
+	}
+}
+
+// ID returns the connection ID
+func (c *Connection) ID() string {
+	return c.id
+}
+
+// connect dials the server unless already connected. Dialing runs without
+// c.mu held since authentication may wait for the user; the lock is only
+// taken to install the new transport.
+func (c *Connection) connect() error {
+	c.mu.Lock()
+	connected, closed := c.connected, c.closed
+	c.mu.Unlock()
+	if connected {
+		return nil
+	}
+	if closed {
+		return fmt.Errorf("connection closed")
+	}
+
+	// Connect to SSH server, hopping through any jump hosts
+	client, jumpClients, authUsed, err := c.dial()
+	if err != nil {
+		return err
+	}
+
+	// Serve the local ssh-agent to the shell channels that request it
+	if c.config.ForwardAgent {
+		if err := forwardAgent(client, agentSocket(c.config)); err != nil {
+			closeClients(append(jumpClients, client))
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		// Closed while dialing
+		closeClients(append(jumpClients, client))
+		return fmt.Errorf("connection closed")
+	}
+	c.client = client
+	c.jumpClients = jumpClients
+	c.authUsed = authUsed
+	c.connected = true
+	c.stop = make(chan struct{})
+
+	// Start configured port forwards, which must all succeed, or restore the
+	// ones active before a reconnect as far as possible
+	rules, restoring := c.config.Forwards, c.restore != nil
+	if restoring {
+		rules = c.restore
+		c.restore = nil
+	}
+	for _, rule := range rules {
+		if _, err := c.startForward(rule); err != nil {
+			if !restoring {
+				c.shutdown()
+				return fmt.Errorf("failed to start %s forward %s: %w", rule.Type, rule.ListenAddr, err)
+			}
+			log.Printf("[SSH] Failed to restore %s forward %s: %v", rule.Type, rule.ListenAddr, err)
+		}
+	}
+
+	// Watch the connection
+	go c.watchConnection(client)
+	if c.config.KeepaliveInterval > 0 {
+		go c.keepaliveLoop(client, c.stop)
+	}
+
+	return nil
+}
+
+// dial connects to the SSH server through the configured jump hosts. It
+// returns the jump host connections, outermost first, and the auth method
+// that succeeded.
+func (c *Connection) dial() (*ssh.Client, []*ssh.Client, AuthMethod, error) {
+	defer c.closeAgent() // Only needed during authentication
+
+	var jumpClients []*ssh.Client
+	var via *ssh.Client
+	for _, jump := range c.config.JumpHosts {
+		jump = c.jumpHostConfig(jump)
+		addr := hostPort(jump.Host, jump.Port)
+
+		sshConfig, err := c.buildSSHConfig(jump, nil)
+		if err != nil {
+			closeClients(jumpClients)
+			return nil, nil, "", fmt.Errorf("failed to build SSH config for jump host %s: %w", addr, err)
+		}
+
+		hop, err := dialVia(via, addr, sshConfig)
+		if err != nil {
+			closeClients(jumpClients)
+			return nil, nil, "", fmt.Errorf("failed to connect to jump host %s: %w", addr, err)
+		}
+		jumpClients = append(jumpClients, hop)
+		via = hop
+	}
+
+	// Build SSH client config
+	var attempted AuthMethod
+	sshConfig, err := c.buildSSHConfig(c.config, &attempted)
+	if err != nil {
+		closeClients(jumpClients)
+		return nil, nil, "", fmt.Errorf("failed to build SSH config: %w", err)
+	}
+
+	client, err := dialVia(via, hostPort(c.config.Host, c.config.Port), sshConfig)
+	if err != nil {
+		closeClients(jumpClients)
+		return nil, nil, "", fmt.Errorf("failed to connect to SSH server: %w", err)
+	}
+
+	// The method of the last authentication step, see buildAuthMethods
+	return client, jumpClients, attempted, nil
+}
+
+// dialVia connects to addr directly, or through a direct-tcpip channel of an
+// existing connection
+func dialVia(via *ssh.Client, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	var conn net.Conn
+	var err error
+	if via == nil {
+		conn, err = net.DialTimeout("tcp", addr, config.Timeout)
+	} else {
+		conn, err = dialChannel(via, addr, config.Timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ncc, chans, reqs, err := handshake(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return ssh.NewClient(ncc, chans, reqs), nil
+}
+
+// dialChannel opens a direct-tcpip channel to addr. The jump host may never
+// answer the channel open, so it is abandoned after timeout; a channel that
+// opens later is closed again.
+func dialChannel(via *ssh.Client, addr string, timeout time.Duration) (net.Conn, error) {
+	if timeout <= 0 {
+		return via.Dial("tcp", addr)
+	}
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		conn, err := via.Dial("tcp", addr)
+		done <- result{conn, err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case r := <-done:
+		return r.conn, r.err
+	case <-timer.C:
+		go func() {
+			if r := <-done; r.conn != nil {
+				r.conn.Close()
+			}
+		}()
+		return nil, fmt.Errorf("opening channel to %s timed out after %s", addr, timeout)
+	}
+}
+
+// handshake runs the SSH handshake on conn. config.Timeout only limits
+// dialing, so the key exchange is limited here as well: the conn is closed
+// if the host key hasn't arrived in time. Authentication isn't limited since
+// it may wait for the user.
+func handshake(conn net.Conn, addr string, config *ssh.ClientConfig) (ssh.Conn, <-chan ssh.NewChannel, <-chan *ssh.Request, error) {
+	if config.Timeout <= 0 {
+		return ssh.NewClientConn(conn, addr, config)
+	}
+
+	var timedOut atomic.Bool
+	timer := time.AfterFunc(config.Timeout, func() {
+		timedOut.Store(true)
+		conn.Close()
+	})
+	defer timer.Stop()
+
+	limited := *config
+	limited.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		timer.Stop()
+		return config.HostKeyCallback(hostname, remote, key)
+	}
+
+	ncc, chans, reqs, err := ssh.NewClientConn(conn, addr, &limited)
+	if err != nil && timedOut.Load() {
+		return nil, nil, nil, fmt.Errorf("ssh handshake with %s timed out after %s", addr, config.Timeout)
+	}
+	return ncc, chans, reqs, err
+}
+
+// jumpHostConfig fills in unset jump host settings from the target configuration
+func (c *Connection) jumpHostConfig(jump SSHConfig) SSHConfig {
+	if jump.Port == 0 {
+		jump.Port = 22
+	}
+	if jump.Username == "" {
+		jump.Username = c.config.Username
+	}
+	if jump.AuthMethod == "" && len(jump.AuthMethods) == 0 {
+		jump.AuthMethod = c.config.AuthMethod
+		jump.AuthMethods = c.config.AuthMethods
+		jump.Password = c.config.Password
+		jump.PrivateKey = c.config.PrivateKey
+		jump.PrivateKeyPath = c.config.PrivateKeyPath
+		jump.PrivateKeyPassphrase = c.config.PrivateKeyPassphrase
+		jump.Certificate = c.config.Certificate
+		jump.CertificatePath = c.config.CertificatePath
+		jump.AgentSocket = c.config.AgentSocket
+	}
+	if jump.PromptHandler == nil {
+		jump.PromptHandler = c.config.PromptHandler
+	}
+	if len(jump.KnownHostsFiles) == 0 {
+		jump.KnownHostsFiles = c.config.KnownHostsFiles
+	}
+	if len(jump.HostCertAuthorities) == 0 {
+		jump.HostCertAuthorities = c.config.HostCertAuthorities
+	}
+	if jump.ConnectTimeout == 0 {
+		jump.ConnectTimeout = c.config.ConnectTimeout
+	}
+	return jump
+}
+
+// buildSSHConfig builds golang.org/x/crypto/ssh config for a hop. The auth
+// method that completed authentication is stored in attempted when it is
+// not nil.
+func (c *Connection) buildSSHConfig(hop SSHConfig, attempted *AuthMethod) (*ssh.ClientConfig, error) {
+	hostKeyCallback, err := buildHostKeyCallback(hop)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &ssh.ClientConfig{
+		User:            hop.Username,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         time.Duration(hop.ConnectTimeout) * time.Second,
+	}
+	if err := applyAlgorithms(config, hop); err != nil {
+		return nil, err
+	}
+
+	auths, err := c.buildAuthMethods(hop, attempted)
+	if err != nil {
+		return nil, err
+	}
+	config.Auth = auths
+
+	return config, nil
+}
+
+// attach registers a channel and returns the transport to open it on
+func (c *Connection) attach(channel *Client) (*ssh.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil, fmt.Errorf("connection closed")
+	}
+	if !c.connected {
+		return nil, fmt.Errorf("not connected")
+	}
+
+	c.channels[channel] = struct{}{}
+	return c.client, nil
+}
+
+// detach unregisters a channel, closing the connection if it was the last
+func (c *Connection) detach(channel *Client) {
+	c.mu.Lock()
+	delete(c.channels, channel)
+	last := len(c.channels) == 0
+	c.mu.Unlock()
+
+	if last {
+		c.Close()
+	}
+}
+
+// channelList returns the registered channels
+func (c *Connection) channelList() []*Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	channels := make([]*Client, 0, len(c.channels))
+	for channel := range c.channels {
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+// Channels returns the number of open channels
+func (c *Connection) Channels() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.channels)
+}
+
+// reconnect re-establishes a lost connection and reopens its channels.
+// Channels that fail to reopen are closed and report why.
+func (c *Connection) reconnect() error {
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	for _, channel := range c.channelList() {
+		if err := channel.reopen(); err != nil {
+			log.Printf("[SSH] Failed to reopen channel on connection %s: %v", c.id, err)
+		}
+	}
+	return nil
+}
+
+// emitStatus notifies every channel of a connection state change
+func (c *Connection) emitStatus(state, reason string) {
+	for _, channel := range c.channelList() {
+		channel.emitStatus(state, reason)
+	}
+}
+
+// Close closes the connection together with any channels still open on it
+func (c *Connection) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	c.restore = nil
+	if c.connected {
+		c.shutdown()
+	}
+	onClose := c.onClose
+	c.mu.Unlock()
+
+	if onClose != nil {
+		onClose()
+	}
+	return nil
+}
+
+// shutdown stops background work and closes the transport.
+// Must be called with c.mu held while connected.
+func (c *Connection) shutdown() {
+	close(c.stop)
+
+	c.closeForwards()
+	c.closeTransport()
+
+	c.connected = false
+}
+
+// closeTransport closes the SSH connection and any jump host connections
+func (c *Connection) closeTransport() {
+	if c.client != nil {
+		c.client.Close()
+		c.client = nil
+	}
+	c.closeJumpHosts()
+}
+
+// closeJumpHosts closes jump host connections, innermost first
+func (c *Connection) closeJumpHosts() {
+	closeClients(c.jumpClients)
+	c.jumpClients = nil
+}
+
+// closeClients closes chained SSH connections, innermost first
+func closeClients(clients []*ssh.Client) {
+	for i := len(clients) - 1; i >= 0; i-- {
+		clients[i].Close()
+	}
+}
+
+// closeAgent closes the ssh-agent connections used for authentication
+func (c *Connection) closeAgent() {
+	for _, conn := range c.agentConns {
+		conn.Close()
+	}
+	c.agentConns = nil
+}
+
+// IsConnected returns connection status
+func (c *Connection) IsConnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected
+}
+
+// AuthMethodUsed returns the auth method that succeeded on the last connect.
+// It is empty if the server accepted the user without any challenge.
+func (c *Connection) AuthMethodUsed() AuthMethod {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.authUsed
+}
+
+// GetConfig returns the SSH configuration
+func (c *Connection) GetConfig() SSHConfig {
+	return c.config
+}
+
+// hostPort joins a host and port into a dialable address
+func hostPort(host string, port int) string {
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
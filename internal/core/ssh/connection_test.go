@@ -0,0 +1,45 @@
+package ssh
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJumpHost(t *testing.T) {
+	jump := newTestServer(t)
+	target := newTestServer(t)
+
+	config := target.clientConfig()
+	config.JumpHosts = []SSHConfig{{Host: "127.0.0.1", Port: jump.clientConfig().Port}}
+	client := connectTestClient(t, config)
+
+	if !client.IsConnected() {
+		t.Error("not connected through the jump host")
+	}
+	if target.shells.Load() != 1 || jump.shells.Load() != 0 {
+		t.Errorf("shells on target/jump host = %d/%d, want 1/0", target.shells.Load(), jump.shells.Load())
+	}
+}
+
+func TestJumpHostDialTimeout(t *testing.T) {
+	jump := newTestServer(t)
+	jump.stallDial.Store(true)
+	target := newTestServer(t)
+
+	config := target.clientConfig()
+	config.ConnectTimeout = 1
+	config.JumpHosts = []SSHConfig{{Host: "127.0.0.1", Port: jump.clientConfig().Port}}
+
+	start := time.Now()
+	err := NewClient(config).Connect()
+	if err == nil {
+		t.Fatal("connected although the jump host never opened the channel")
+	}
+	if !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("error = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("gave up after %s, want about the connect timeout", elapsed)
+	}
+}
@@ -0,0 +1,69 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Exec runs a command on a new channel of the connection, without a PTY,
+// writing its output to stdout and stderr. Cancelling ctx kills the command.
+func (c *Connection) Exec(ctx context.Context, command string, stdout, stderr io.Writer) (*ExitStatus, error) {
+	c.mu.Lock()
+	if !c.connected || c.client == nil {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("not connected")
+	}
+	client := c.client
+	c.mu.Unlock()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	setEnv(session, c.config.Env)
+	session.Stdout = stdout
+	session.Stderr = stderr
+
+	if err := session.Start(command); err != nil {
+		return nil, fmt.Errorf("failed to start command: %w", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// Not every server honours signals; closing the channel always ends it
+		session.Signal(ssh.SIGKILL)
+		session.Close()
+		<-done
+		return nil, ctx.Err()
+	}
+
+	if exit, ok := exitStatus(err); ok {
+		return exit, nil
+	}
+	return nil, fmt.Errorf("command failed: %w", err)
+}
+
+// exitStatus extracts the exit status from the result of session.Wait
+func exitStatus(err error) (*ExitStatus, bool) {
+	if err == nil {
+		return &ExitStatus{Code: 0}, true
+	}
+
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return &ExitStatus{Code: exitErr.ExitStatus(), Signal: exitErr.Signal()}, true
+	}
+	return nil, false
+}
@@ -0,0 +1,337 @@
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// forward is an active port forward on a connection
+type forward struct {
+	rule     ForwardRule
+	conn     *Connection
+	listener net.Listener
+	dial     func(addr string) (net.Conn, error) // Connects accepted connections to the target
+
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+	total    atomic.Int64
+
+	mu      sync.Mutex
+	conns   map[string]*forwardConn
+	connSeq int
+	closed  bool
+}
+
+// forwardConn is a single connection carried by a forward
+type forwardConn struct {
+	id         string
+	remoteAddr string
+	targetAddr string
+	startedAt  time.Time
+	bytesIn    atomic.Int64
+	bytesOut   atomic.Int64
+	local      net.Conn
+	remote     net.Conn
+}
+
+// AddForward starts a port forward on the connection
+func (c *Connection) AddForward(rule ForwardRule) (ForwardStatus, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.connected {
+		return ForwardStatus{}, fmt.Errorf("not connected")
+	}
+
+	return c.startForward(rule)
+}
+
+// startForward starts a port forward. Must be called with c.mu held.
+func (c *Connection) startForward(rule ForwardRule) (ForwardStatus, error) {
+	if rule.ID == "" {
+		c.forwardSeq++
+		rule.ID = fmt.Sprintf("fwd-%d", c.forwardSeq)
+	}
+	if _, exists := c.forwards[rule.ID]; exists {
+		return ForwardStatus{}, fmt.Errorf("forward %s already exists", rule.ID)
+	}
+
+	f := &forward{
+		rule:  rule,
+		conn:  c,
+		conns: make(map[string]*forwardConn),
+	}
+
+	switch rule.Type {
+	case ForwardLocal:
+		if rule.TargetAddr == "" {
+			return ForwardStatus{}, fmt.Errorf("target address required for local forward")
+		}
+		listener, err := net.Listen("tcp", rule.ListenAddr)
+		if err != nil {
+			return ForwardStatus{}, fmt.Errorf("failed to listen on %s: %w", rule.ListenAddr, err)
+		}
+		f.listener = listener
+		f.dial = c.dialRemote
+
+	case ForwardRemote:
+		if rule.TargetAddr == "" {
+			return ForwardStatus{}, fmt.Errorf("target address required for remote forward")
+		}
+		listener, err := c.client.Listen("tcp", rule.ListenAddr)
+		if err != nil {
+			return ForwardStatus{}, fmt.Errorf("failed to listen on remote %s: %w", rule.ListenAddr, err)
+		}
+		f.listener = listener
+		f.dial = dialLocal
+
+	case ForwardDynamic:
+		addr, err := socksListenAddr(rule)
+		if err != nil {
+			return ForwardStatus{}, err
+		}
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			return ForwardStatus{}, fmt.Errorf("failed to listen on %s: %w", rule.ListenAddr, err)
+		}
+		f.listener = listener
+		f.dial = c.dialRemote
+
+	default:
+		return ForwardStatus{}, fmt.Errorf("unsupported forward type: %s", rule.Type)
+	}
+
+	c.forwards[rule.ID] = f
+	go f.acceptLoop()
+
+	return f.status(), nil
+}
+
+// RemoveForward stops a port forward and closes its connections
+func (c *Connection) RemoveForward(id string) error {
+	c.mu.Lock()
+	f, exists := c.forwards[id]
+	delete(c.forwards, id)
+	c.mu.Unlock()
+
+	if !exists {
+		return fmt.Errorf("forward %s not found", id)
+	}
+
+	f.close()
+	return nil
+}
+
+// Forwards returns the status of all port forwards
+func (c *Connection) Forwards() []ForwardStatus {
+	c.mu.Lock()
+	forwards := make([]*forward, 0, len(c.forwards))
+	for _, f := range c.forwards {
+		forwards = append(forwards, f)
+	}
+	c.mu.Unlock()
+
+	statuses := make([]ForwardStatus, 0, len(forwards))
+	for _, f := range forwards {
+		statuses = append(statuses, f.status())
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].ID < statuses[j].ID
+	})
+
+	return statuses
+}
+
+// closeForwards stops all port forwards. Must be called with c.mu held.
+func (c *Connection) closeForwards() {
+	for id, f := range c.forwards {
+		f.close()
+		delete(c.forwards, id)
+	}
+}
+
+// dialRemote opens a direct-tcpip channel to addr through the SSH connection
+func (c *Connection) dialRemote(addr string) (net.Conn, error) {
+	c.mu.Lock()
+	client := c.client
+	c.mu.Unlock()
+
+	if client == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+	return client.Dial("tcp", addr)
+}
+
+// dialLocal connects to a target reachable from this machine
+func dialLocal(addr string) (net.Conn, error) {
+	return net.DialTimeout("tcp", addr, 10*time.Second)
+}
+
+// acceptLoop accepts connections on the forward's listener
+func (f *forward) acceptLoop() {
+	for {
+		local, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go f.handle(local)
+	}
+}
+
+// handle connects an accepted connection to the forward target
+func (f *forward) handle(local net.Conn) {
+	if f.rule.Type == ForwardDynamic {
+		f.handleSOCKS(local)
+		return
+	}
+
+	remote, err := f.dial(f.rule.TargetAddr)
+	if err != nil {
+		log.Printf("[SSH Forward %s] Failed to connect to %s: %v", f.rule.ID, f.rule.TargetAddr, err)
+		local.Close()
+		return
+	}
+
+	f.pipe(local, remote, f.rule.TargetAddr)
+}
+
+// pipe copies data between both ends of a forwarded connection until either closes
+func (f *forward) pipe(local, remote net.Conn, target string) {
+	conn := f.track(local, remote, target)
+	if conn == nil {
+		local.Close()
+		remote.Close()
+		return
+	}
+	defer f.untrack(conn)
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(&countingWriter{w: remote, counters: []*atomic.Int64{&conn.bytesOut, &f.bytesOut}}, local)
+		closeWrite(remote)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(&countingWriter{w: local, counters: []*atomic.Int64{&conn.bytesIn, &f.bytesIn}}, remote)
+		closeWrite(local)
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+
+	local.Close()
+	remote.Close()
+}
+
+// track registers an active connection, returning nil if the forward is closed
+func (f *forward) track(local, remote net.Conn, target string) *forwardConn {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return nil
+	}
+
+	f.connSeq++
+	conn := &forwardConn{
+		id:         fmt.Sprintf("%s-%d", f.rule.ID, f.connSeq),
+		remoteAddr: local.RemoteAddr().String(),
+		targetAddr: target,
+		startedAt:  time.Now(),
+		local:      local,
+		remote:     remote,
+	}
+	f.conns[conn.id] = conn
+	f.total.Add(1)
+
+	return conn
+}
+
+// untrack removes a finished connection
+func (f *forward) untrack(conn *forwardConn) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.conns, conn.id)
+}
+
+// close stops the listener and closes all active connections
+func (f *forward) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return
+	}
+	f.closed = true
+
+	if f.listener != nil {
+		f.listener.Close()
+	}
+	for _, conn := range f.conns {
+		conn.local.Close()
+		conn.remote.Close()
+	}
+}
+
+// status returns a snapshot of the forward's state
+func (f *forward) status() ForwardStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	status := ForwardStatus{
+		ForwardRule:       f.rule,
+		BytesIn:           f.bytesIn.Load(),
+		BytesOut:          f.bytesOut.Load(),
+		TotalConnections:  f.total.Load(),
+		ActiveConnections: make([]ForwardConnection, 0, len(f.conns)),
+	}
+	if f.listener != nil {
+		status.BoundAddr = f.listener.Addr().String()
+	}
+
+	for _, conn := range f.conns {
+		status.ActiveConnections = append(status.ActiveConnections, ForwardConnection{
+			ID:         conn.id,
+			RemoteAddr: conn.remoteAddr,
+			TargetAddr: conn.targetAddr,
+			StartedAt:  conn.startedAt,
+			BytesIn:    conn.bytesIn.Load(),
+			BytesOut:   conn.bytesOut.Load(),
+		})
+	}
+	sort.Slice(status.ActiveConnections, func(i, j int) bool {
+		return status.ActiveConnections[i].StartedAt.Before(status.ActiveConnections[j].StartedAt)
+	})
+
+	return status
+}
+
+// countingWriter counts bytes written into a set of counters
+type countingWriter struct {
+	w        io.Writer
+	counters []*atomic.Int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	for _, counter := range cw.counters {
+		counter.Add(int64(n))
+	}
+	return n, err
+}
+
+// closeWrite half-closes a connection when supported
+func closeWrite(conn net.Conn) {
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+		return
+	}
+	conn.Close()
+}
@@ -0,0 +1,130 @@
+package ssh
+
+import (
+	"net"
+	"testing"
+)
+
+// connectTestClient connects a client to the test server
+func connectTestClient(t *testing.T, config SSHConfig) *Client {
+	t.Helper()
+
+	client := NewClient(config)
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestLocalForward(t *testing.T) {
+	server := newTestServer(t)
+	target := startEchoServer(t)
+	client := connectTestClient(t, server.clientConfig())
+
+	status, err := client.AddForward(ForwardRule{
+		Type:       ForwardLocal,
+		ListenAddr: "127.0.0.1:0",
+		TargetAddr: target,
+	})
+	if err != nil {
+		t.Fatalf("AddForward: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", status.BoundAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := roundTrip(t, conn, "ping"); got != "ping" {
+		t.Errorf("read %q through the forward, want %q", got, "ping")
+	}
+	conn.Close()
+
+	waitFor(t, "forward counters", func() bool {
+		forwards := client.Forwards()
+		return len(forwards) == 1 && forwards[0].TotalConnections == 1 &&
+			forwards[0].BytesIn == 4 && forwards[0].BytesOut == 4 &&
+			len(forwards[0].ActiveConnections) == 0
+	})
+
+	if err := client.RemoveForward(status.ID); err != nil {
+		t.Fatalf("RemoveForward: %v", err)
+	}
+	if len(client.Forwards()) != 0 {
+		t.Error("forward still listed after removal")
+	}
+	if conn, err := net.Dial("tcp", status.BoundAddr); err == nil {
+		conn.Close()
+		t.Error("listener still accepting after removal")
+	}
+}
+
+func TestLocalForwardRejectsDuplicateID(t *testing.T) {
+	server := newTestServer(t)
+	client := connectTestClient(t, server.clientConfig())
+
+	rule := ForwardRule{ID: "web", Type: ForwardLocal, ListenAddr: "127.0.0.1:0", TargetAddr: "127.0.0.1:80"}
+	if _, err := client.AddForward(rule); err != nil {
+		t.Fatalf("AddForward: %v", err)
+	}
+	if _, err := client.AddForward(rule); err == nil {
+		t.Error("second forward with the same ID was accepted")
+	}
+}
+
+func TestRemoteForward(t *testing.T) {
+	server := newTestServer(t)
+	target := startEchoServer(t)
+	client := connectTestClient(t, server.clientConfig())
+
+	status, err := client.AddForward(ForwardRule{
+		Type:       ForwardRemote,
+		ListenAddr: "127.0.0.1:0",
+		TargetAddr: target,
+	})
+	if err != nil {
+		t.Fatalf("AddForward: %v", err)
+	}
+	if _, port, _ := net.SplitHostPort(status.BoundAddr); port == "0" || port == "" {
+		t.Fatalf("BoundAddr = %q, want the port the server bound", status.BoundAddr)
+	}
+
+	// The test server listens on this machine, so the remote listener can
+	// be dialed directly
+	conn, err := net.Dial("tcp", status.BoundAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if got := roundTrip(t, conn, "pong"); got != "pong" {
+		t.Errorf("read %q through the forward, want %q", got, "pong")
+	}
+
+	waitFor(t, "forward counters", func() bool {
+		forwards := client.Forwards()
+		return len(forwards) == 1 && forwards[0].BytesIn == 4 && forwards[0].BytesOut == 4
+	})
+}
+
+func TestConfiguredForwardFailure(t *testing.T) {
+	server := newTestServer(t)
+
+	// Occupy the listen address so the forward can't start
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	config := server.clientConfig()
+	config.Forwards = []ForwardRule{{Type: ForwardLocal, ListenAddr: taken.Addr().String(), TargetAddr: "127.0.0.1:80"}}
+
+	client := NewClient(config)
+	if err := client.Connect(); err == nil {
+		client.Close()
+		t.Fatal("connected although a configured forward failed to start")
+	}
+	if client.IsConnected() || client.Connection().IsConnected() {
+		t.Error("connection left open after the forward failed")
+	}
+}
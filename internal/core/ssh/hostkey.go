@@ -0,0 +1,186 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// certAuthority is a trusted host certificate authority
+type certAuthority struct {
+	patterns []string
+	key      ssh.PublicKey
+}
+
+// buildHostKeyCallback builds the host key verification callback.
+// Host certificates are verified against the configured @cert-authority
+// entries; other host keys are checked against the known_hosts files. Once
+// authorities are configured, keys are never accepted unverified.
+func buildHostKeyCallback(config SSHConfig) (ssh.HostKeyCallback, error) {
+	fallback := ssh.InsecureIgnoreHostKey() // TODO: Prompt for unknown host keys
+	if len(config.KnownHostsFiles) > 0 {
+		files := make([]string, len(config.KnownHostsFiles))
+		for i, file := range config.KnownHostsFiles {
+			files[i] = expandHome(file)
+		}
+
+		callback, err := knownhosts.New(files...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load known_hosts: %w", err)
+		}
+		fallback = callback
+	}
+
+	if len(config.HostCertAuthorities) == 0 {
+		return fallback, nil
+	}
+
+	authorities := make([]certAuthority, 0, len(config.HostCertAuthorities))
+	for _, entry := range config.HostCertAuthorities {
+		authority, err := parseCertAuthority(entry)
+		if err != nil {
+			return nil, err
+		}
+		authorities = append(authorities, authority)
+	}
+
+	// Without known_hosts only certificates can be verified
+	if len(config.KnownHostsFiles) == 0 {
+		fallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			return fmt.Errorf("host key of %s is not signed by a trusted CA and no known_hosts files are configured", hostname)
+		}
+	}
+
+	checker := &ssh.CertChecker{
+		IsHostAuthority: func(auth ssh.PublicKey, address string) bool {
+			for _, authority := range authorities {
+				if authority.matches(address) && keysEqual(authority.key, auth) {
+					return true
+				}
+			}
+			return false
+		},
+		HostKeyFallback: fallback,
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		// Hosts covered by a configured CA must present a valid certificate
+		for _, authority := range authorities {
+			if authority.matches(hostname) {
+				if _, ok := key.(*ssh.Certificate); ok {
+					return checker.CheckHostKey(hostname, remote, key)
+				}
+				// Plain host keys are only accepted when listed in known_hosts
+				if len(config.KnownHostsFiles) > 0 {
+					return fallback(hostname, remote, key)
+				}
+				return fmt.Errorf("host %s must present a certificate signed by a trusted CA", hostname)
+			}
+		}
+		return fallback(hostname, remote, key)
+	}, nil
+}
+
+// parseCertAuthority parses a known_hosts style "@cert-authority <patterns> <key>"
+// line, or a bare public key trusted for all hosts
+func parseCertAuthority(entry string) (certAuthority, error) {
+	entry = strings.TrimSpace(entry)
+
+	if !strings.HasPrefix(entry, "@") {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(entry))
+		if err != nil {
+			return certAuthority{}, fmt.Errorf("invalid host certificate authority: %w", err)
+		}
+		return certAuthority{patterns: []string{"*"}, key: key}, nil
+	}
+
+	marker, hosts, key, _, _, err := ssh.ParseKnownHosts([]byte(entry))
+	if err != nil {
+		return certAuthority{}, fmt.Errorf("invalid host certificate authority: %w", err)
+	}
+	if marker != "cert-authority" {
+		return certAuthority{}, fmt.Errorf("invalid host certificate authority: unexpected marker @%s", marker)
+	}
+
+	return certAuthority{patterns: hosts, key: key}, nil
+}
+
+// matches reports whether the authority applies to a "host:port" address
+func (a certAuthority) matches(address string) bool {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		host, port = address, "22"
+	}
+
+	if matchHostPatterns(a.patterns, host) {
+		return true
+	}
+	if port != "22" {
+		return matchHostPatterns(a.patterns, "["+host+"]:"+port)
+	}
+	return false
+}
+
+// matchHostPatterns matches a host against OpenSSH style patterns.
+// Patterns support "*" and "?" wildcards and "!" negation; a negated
+// match always wins.
+func matchHostPatterns(patterns []string, host string) bool {
+	host = strings.ToLower(host)
+	matched := false
+
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+
+		negate := strings.HasPrefix(pattern, "!")
+		if negate {
+			pattern = pattern[1:]
+		}
+
+		if wildcardMatch(pattern, host) {
+			if negate {
+				return false
+			}
+			matched = true
+		}
+	}
+
+	return matched
+}
+
+// wildcardMatch matches a string against a pattern with "*" and "?" wildcards
+func wildcardMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if wildcardMatch(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		default:
+			if len(s) == 0 || pattern[0] != s[0] {
+				return false
+			}
+		}
+		pattern = pattern[1:]
+		s = s[1:]
+	}
+	return len(s) == 0
+}
+
+// keysEqual compares two public keys
+func keysEqual(a, b ssh.PublicKey) bool {
+	return bytes.Equal(a.Marshal(), b.Marshal())
+}
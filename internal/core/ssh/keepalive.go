@@ -0,0 +1,119 @@
+package ssh
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// defaultKeepaliveCountMax matches OpenSSH's ServerAliveCountMax default
+const defaultKeepaliveCountMax = 3
+
+// keepaliveLoop sends keepalive@openssh.com requests and disconnects after
+// too many consecutive replies are missed
+func (c *Connection) keepaliveLoop(client *ssh.Client, stop chan struct{}) {
+	interval := time.Duration(c.config.KeepaliveInterval) * time.Second
+	countMax := c.config.KeepaliveCountMax
+	if countMax <= 0 {
+		countMax = defaultKeepaliveCountMax
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	missed := 0
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+
+		reply := make(chan error, 1)
+		go func() {
+			// Any reply, even a failure, proves the server is alive
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			reply <- err
+		}()
+
+		timer := time.NewTimer(interval)
+		select {
+		case err := <-reply:
+			timer.Stop()
+			if err != nil {
+				c.markLost(client, fmt.Sprintf("keepalive failed: %v", err))
+				return
+			}
+			missed = 0
+		case <-timer.C:
+			missed++
+			if missed >= countMax {
+				c.markLost(client, fmt.Sprintf("no keepalive reply after %d attempts", missed))
+				return
+			}
+		case <-stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// watchConnection reports a disconnect when the SSH transport closes
+func (c *Connection) watchConnection(client *ssh.Client) {
+	err := client.Wait()
+
+	reason := "connection closed by remote host"
+	if err != nil {
+		reason = fmt.Sprintf("connection lost: %v", err)
+	}
+	c.markLost(client, reason)
+}
+
+// sessionEnded waits for the remote shell to exit and reports its exit
+// status, or a disconnect when the transport died underneath it
+func (c *Client) sessionEnded(client *ssh.Client, session *ssh.Session) {
+	if exit, ok := exitStatus(session.Wait()); ok {
+		c.ended(session, exit.String(), exit)
+		return
+	}
+
+	// No exit status: a dead transport fails the request right away; a live
+	// one means the shell closed without reporting one
+	if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+		c.conn.markLost(client, fmt.Sprintf("connection lost: %v", err))
+		return
+	}
+	c.ended(session, "remote session closed", nil)
+}
+
+// markLost tears down a connection that was lost and disconnects its
+// channels, then notifies them or hands the connection to the onLost hook
+func (c *Connection) markLost(client *ssh.Client, reason string) {
+	c.mu.Lock()
+	if !c.connected || c.client != client {
+		// Already handled, or reported by a previous connection
+		c.mu.Unlock()
+		return
+	}
+
+	// Remember active forwards so a reconnect can restore them
+	c.restore = make([]ForwardRule, 0, len(c.forwards))
+	for _, f := range c.forwards {
+		c.restore = append(c.restore, f.rule)
+	}
+
+	c.shutdown()
+	onLost := c.onLost
+	c.mu.Unlock()
+
+	for _, channel := range c.channelList() {
+		channel.lost(reason)
+	}
+
+	if onLost != nil {
+		onLost(reason)
+		return
+	}
+	c.emitStatus(StateDisconnected, reason)
+}
@@ -0,0 +1,90 @@
+package ssh
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// status is a state change reported to a status handler
+type status struct {
+	state  string
+	reason string
+}
+
+// recordStatus collects the state changes a client reports
+func recordStatus(client *Client) <-chan status {
+	statuses := make(chan status, 16)
+	client.SetStatusHandler(func(state, reason string) {
+		statuses <- status{state, reason}
+	})
+	return statuses
+}
+
+// waitStatus waits for the client to report state, skipping other states,
+// and returns the reason
+func waitStatus(t *testing.T, statuses <-chan status, state string) string {
+	t.Helper()
+
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case s := <-statuses:
+			if s.state == state {
+				return s.reason
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s status", state)
+		}
+	}
+}
+
+func TestKeepaliveLoss(t *testing.T) {
+	server := newTestServer(t)
+	config := server.clientConfig()
+	config.KeepaliveInterval = 1
+	config.KeepaliveCountMax = 2
+	client := connectTestClient(t, config)
+	statuses := recordStatus(client)
+
+	server.blackhole.Store(true)
+
+	reason := waitStatus(t, statuses, StateDisconnected)
+	if reason != "no keepalive reply after 2 attempts" {
+		t.Errorf("reason = %q", reason)
+	}
+	if client.IsConnected() {
+		t.Error("client still connected after missing keepalives")
+	}
+}
+
+func TestKeepaliveAnswered(t *testing.T) {
+	server := newTestServer(t)
+	config := server.clientConfig()
+	config.KeepaliveInterval = 1
+	config.KeepaliveCountMax = 1
+	client := connectTestClient(t, config)
+	statuses := recordStatus(client)
+
+	select {
+	case s := <-statuses:
+		t.Fatalf("reported %s (%s) while keepalives were answered", s.state, s.reason)
+	case <-time.After(3 * time.Second):
+	}
+	if !client.IsConnected() {
+		t.Error("client disconnected while keepalives were answered")
+	}
+}
+
+func TestConnectionDropped(t *testing.T) {
+	server := newTestServer(t)
+	client := connectTestClient(t, server.clientConfig())
+	statuses := recordStatus(client)
+
+	server.dropConnections()
+
+	reason := waitStatus(t, statuses, StateDisconnected)
+	if !strings.HasPrefix(reason, "connection ") {
+		t.Errorf("reason = %q, want a lost connection", reason)
+	}
+}
@@ -2,46 +2,176 @@ package ssh
 
 import (
 	"fmt"
+	"log"
 	"sync"
+	"time"
 )
 
-// Manager manages SSH connections
+const (
+	reconnectInitialDelay = 1 * time.Second
+	reconnectMaxDelay     = 30 * time.Second
+)
+
+// Manager manages SSH connections and the shell channels open on them
 type Manager struct {
-	clients map[string]*Client
-	mu      sync.RWMutex
+	clients     map[string]*Client     // Shell channels by session ID
+	connections map[string]*Connection // Connections by connection ID
+	connSeq     int
+	mu          sync.RWMutex
 }
 
 // NewManager creates a new SSH manager
 func NewManager() *Manager {
 	return &Manager{
-		clients: make(map[string]*Client),
+		clients:     make(map[string]*Client),
+		connections: make(map[string]*Connection),
 	}
 }
 
-// Connect creates and connects an SSH client
+// Connect creates a new SSH connection and opens a shell channel on it
 func (m *Manager) Connect(id string, config SSHConfig) (*Client, error) {
+	m.mu.Lock()
+	m.connSeq++
+	conn := newConnection(fmt.Sprintf("conn-%d", m.connSeq), config)
+	m.mu.Unlock()
+
+	conn.onClose = func() {
+		go m.removeConnection(conn)
+	}
+	if config.AutoReconnect {
+		conn.onLost = func(reason string) {
+			go m.reconnect(conn, reason)
+		}
+	}
+
+	// Connect without holding the lock; authentication may wait for the user
+	client := newChannel(conn, config)
+	if err := client.Connect(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	m.connections[conn.id] = conn
+	m.mu.Unlock()
+
+	m.store(id, client)
+	return client, nil
+}
+
+// Duplicate opens another shell channel on the connection of an existing
+// session, without dialing or authenticating again. Cols and rows override
+// the terminal size of the source session when set.
+func (m *Manager) Duplicate(id, sourceID string, cols, rows int) (*Client, error) {
+	source, exists := m.Get(sourceID)
+	if !exists {
+		return nil, fmt.Errorf("client with ID %s not found", sourceID)
+	}
+
+	config := source.GetConfig()
+	if cols > 0 && rows > 0 {
+		config.Cols = cols
+		config.Rows = rows
+	}
+
+	client := newChannel(source.conn, config)
+	client.mu.Lock()
+	err := client.open()
+	client.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	m.store(id, client)
+	return client, nil
+}
+
+// store registers a client, closing any existing client with the same ID
+func (m *Manager) store(id string, client *Client) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// Check if client already exists and close it first
 	if existingClient, exists := m.clients[id]; exists {
-		fmt.Printf("[SSH Manager] Client with ID %s already exists, closing existing connection\n", id)
+		log.Printf("[SSH Manager] Client with ID %s already exists, closing existing connection", id)
 		existingClient.Close()
-		delete(m.clients, id)
 	}
+	m.clients[id] = client
+}
 
-	// Create new client
-	client := NewClient(config)
+// removeConnection forgets a closed connection
+func (m *Manager) removeConnection(conn *Connection) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	// Connect
-	if err := client.Connect(); err != nil {
-		return nil, err
+	if m.connections[conn.id] == conn {
+		delete(m.connections, conn.id)
 	}
+}
 
-	// Store client
-	m.clients[id] = client
+// reconnect re-establishes a lost connection with exponential backoff,
+// keeping the same clients so attached handlers continue transparently
+func (m *Manager) reconnect(conn *Connection, reason string) {
+	config := conn.GetConfig()
 
-	return client, nil
+	maxDelay := reconnectMaxDelay
+	if config.ReconnectMaxDelay > 0 {
+		maxDelay = time.Duration(config.ReconnectMaxDelay) * time.Second
+	}
+
+	delay := reconnectInitialDelay
+	for attempt := 1; config.ReconnectMaxAttempts == 0 || attempt <= config.ReconnectMaxAttempts; attempt++ {
+		conn.emitStatus(StateReconnecting, fmt.Sprintf("%s (attempt %d)", reason, attempt))
+
+		select {
+		case <-time.After(delay):
+		case <-conn.done:
+			return
+		}
+
+		err := conn.reconnect()
+		if err == nil && conn.Channels() == 0 {
+			// Every channel failed to reopen and released the connection
+			log.Printf("[SSH Manager] Connection %s reconnected, but no channel could be reopened", conn.id)
+			return
+		}
+		if err == nil {
+			log.Printf("[SSH Manager] Connection %s reconnected after %d attempt(s)", conn.id, attempt)
+			conn.emitStatus(StateConnected, "reconnected")
+			return
+		}
+
+		log.Printf("[SSH Manager] Reconnect attempt %d for connection %s failed: %v", attempt, conn.id, err)
+		reason = err.Error()
+
+		delay *= 2
+		if delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+
+	conn.emitStatus(StateDisconnected, fmt.Sprintf("reconnect failed: %s", reason))
+
+	// Give up on the connection, releasing it as an explicit disconnect would
+	log.Printf("[SSH Manager] Giving up on connection %s", conn.id)
+	m.closeConnection(conn)
+}
+
+// closeConnection closes and removes the clients of a connection, and the
+// connection itself
+func (m *Manager) closeConnection(conn *Connection) {
+	m.mu.Lock()
+	var clients []*Client
+	for id, client := range m.clients {
+		if client.conn == conn {
+			clients = append(clients, client)
+			delete(m.clients, id)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, client := range clients {
+		client.Close()
+	}
+	conn.Close()
 }
 
 // Get retrieves an SSH client by ID
@@ -53,6 +183,15 @@ func (m *Manager) Get(id string) (*Client, bool) {
 	return client, exists
 }
 
+// GetConnection retrieves an SSH connection by ID
+func (m *Manager) GetConnection(id string) (*Connection, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	conn, exists := m.connections[id]
+	return conn, exists
+}
+
 // Close closes and removes an SSH client
 func (m *Manager) Close(id string) error {
 	m.mu.Lock()
@@ -87,7 +226,20 @@ func (m *Manager) List() []string {
 	return ids
 }
 
-// CloseAll closes all SSH clients
+// ListConnections returns all connection IDs
+func (m *Manager) ListConnections() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ids := make([]string, 0, len(m.connections))
+	for id := range m.connections {
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+// CloseAll closes all SSH clients and their connections
 func (m *Manager) CloseAll() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -96,4 +248,8 @@ func (m *Manager) CloseAll() {
 		client.Close()
 		delete(m.clients, id)
 	}
+	for id, conn := range m.connections {
+		conn.Close()
+		delete(m.connections, id)
+	}
 }
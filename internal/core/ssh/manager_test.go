@@ -0,0 +1,174 @@
+package ssh
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// echoed collects the output of a client's shell
+func echoed(client *Client) func() string {
+	output := make(chan []byte, 64)
+	client.SetDataHandler(func(data []byte) {
+		output <- data
+	})
+
+	var received []byte
+	return func() string {
+		for {
+			select {
+			case data := <-output:
+				received = append(received, data...)
+			default:
+				return string(received)
+			}
+		}
+	}
+}
+
+func TestAutoReconnect(t *testing.T) {
+	server := newTestServer(t)
+	config := server.clientConfig()
+	config.AutoReconnect = true
+	config.ReconnectMaxAttempts = 3
+
+	manager := NewManager()
+	defer manager.CloseAll()
+
+	client, err := manager.Connect("s1", config)
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	statuses := recordStatus(client)
+	output := echoed(client)
+
+	server.dropConnections()
+
+	reason := waitStatus(t, statuses, StateReconnecting)
+	if !strings.HasSuffix(reason, "(attempt 1)") {
+		t.Errorf("reconnecting reason = %q", reason)
+	}
+	if reason := waitStatus(t, statuses, StateConnected); reason != "reconnected" {
+		t.Errorf("connected reason = %q", reason)
+	}
+
+	// The same client carries on with a new shell
+	if _, err := client.Write([]byte("again\n")); err != nil {
+		t.Fatalf("Write after reconnect: %v", err)
+	}
+	waitFor(t, "echo after reconnect", func() bool {
+		return strings.Contains(output(), "again")
+	})
+	if server.shells.Load() != 2 {
+		t.Errorf("server started %d shells, want 2", server.shells.Load())
+	}
+}
+
+func TestAutoReconnectGivesUp(t *testing.T) {
+	server := newTestServer(t)
+	config := server.clientConfig()
+	config.AutoReconnect = true
+	config.ReconnectMaxAttempts = 1
+
+	manager := NewManager()
+	defer manager.CloseAll()
+
+	client, err := manager.Connect("s1", config)
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	statuses := recordStatus(client)
+
+	// Refuse the reconnect
+	server.listener.Close()
+	server.dropConnections()
+
+	waitStatus(t, statuses, StateReconnecting)
+	reason := waitStatus(t, statuses, StateDisconnected)
+	if !strings.HasPrefix(reason, "reconnect failed: ") {
+		t.Errorf("reason = %q", reason)
+	}
+}
+
+func TestAutoReconnectReopenFails(t *testing.T) {
+	server := newTestServer(t)
+	config := server.clientConfig()
+	config.AutoReconnect = true
+	config.ReconnectMaxAttempts = 3
+
+	manager := NewManager()
+	defer manager.CloseAll()
+
+	client, err := manager.Connect("s1", config)
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	statuses := recordStatus(client)
+
+	// The reconnect succeeds, but the new shell is refused
+	server.refuseShell.Store(true)
+	server.dropConnections()
+
+	reason := waitStatus(t, statuses, StateDisconnected)
+	if !strings.HasPrefix(reason, "failed to reopen shell: ") {
+		t.Errorf("reason = %q", reason)
+	}
+	if state, got := client.Status(); state != StateDisconnected || got != reason {
+		t.Errorf("Status = %s %q, want disconnected %q", state, got, reason)
+	}
+	waitFor(t, "connection release", func() bool {
+		_, exists := manager.GetConnection(client.Connection().ID())
+		return !exists
+	})
+	if _, err := client.Write([]byte("x")); err == nil {
+		t.Error("write to a channel that failed to reopen succeeded")
+	}
+}
+
+func TestReconnectReleasesLock(t *testing.T) {
+	var logins atomic.Int64
+	release := make(chan struct{})
+	server := newTestServer(t, func(config *ssh.ServerConfig) {
+		check := config.PasswordCallback
+		config.PasswordCallback = func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if logins.Add(1) > 1 {
+				<-release // Hold up authentication of the reconnect
+			}
+			return check(conn, password)
+		}
+	})
+	config := server.clientConfig()
+	config.AutoReconnect = true
+
+	manager := NewManager()
+	defer manager.CloseAll()
+
+	client, err := manager.Connect("s1", config)
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	statuses := recordStatus(client)
+
+	server.dropConnections()
+	waitStatus(t, statuses, StateReconnecting)
+	waitFor(t, "reconnect authentication", func() bool { return logins.Load() > 1 })
+
+	// The connection stays usable while the reconnect authenticates
+	done := make(chan struct{})
+	go func() {
+		client.Connection().IsConnected()
+		client.Forwards()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("connection locked while reconnecting")
+	}
+
+	close(release)
+	waitStatus(t, statuses, StateConnected)
+}
@@ -0,0 +1,406 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+const (
+	testUser     = "test"
+	testPassword = "secret"
+)
+
+// testServer is an in-process SSH server. Shells echo their input, exec
+// requests print the command, and direct-tcpip and tcpip-forward connect
+// to the local network.
+type testServer struct {
+	t        *testing.T
+	listener net.Listener
+	config   *ssh.ServerConfig
+
+	blackhole   atomic.Bool // Leave keepalives unanswered
+	stallDial   atomic.Bool // Leave direct-tcpip channel opens unanswered
+	refuseShell atomic.Bool // Fail shell requests
+	shells      atomic.Int64
+	agentKeys   chan int // Keys listed through each forwarded agent
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+// newTestServer starts a test server accepting testUser with testPassword.
+// The configure functions may replace its auth callbacks.
+func newTestServer(t *testing.T, configure ...func(*ssh.ServerConfig)) *testServer {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &testServer{
+		t:         t,
+		listener:  listener,
+		agentKeys: make(chan int, 8),
+		config: &ssh.ServerConfig{
+			PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+				if conn.User() == testUser && string(password) == testPassword {
+					return nil, nil
+				}
+				return nil, fmt.Errorf("password rejected for %s", conn.User())
+			},
+		},
+	}
+	s.config.AddHostKey(signer)
+	for _, fn := range configure {
+		fn(s.config)
+	}
+
+	go s.serve()
+	t.Cleanup(func() {
+		listener.Close()
+		s.dropConnections()
+	})
+	return s
+}
+
+// clientConfig returns a configuration that logs in to the server
+func (s *testServer) clientConfig() SSHConfig {
+	config := DefaultSSHConfig()
+	config.Host = "127.0.0.1"
+	config.Port = s.listener.Addr().(*net.TCPAddr).Port
+	config.Username = testUser
+	config.Password = testPassword
+	config.ConnectTimeout = 5
+	return config
+}
+
+// dropConnections closes every client connection without an SSH disconnect
+func (s *testServer) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *testServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		s.mu.Unlock()
+
+		go s.handle(conn)
+	}
+}
+
+func (s *testServer) handle(conn net.Conn) {
+	sshConn, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer sshConn.Close()
+
+	go s.handleGlobalRequests(sshConn, reqs)
+
+	for newChannel := range chans {
+		switch newChannel.ChannelType() {
+		case "session":
+			go s.handleSession(sshConn, newChannel)
+		case "direct-tcpip":
+			go s.handleDirectTCPIP(newChannel)
+		default:
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+		}
+	}
+}
+
+// handleGlobalRequests answers keepalives and serves remote forwards
+func (s *testServer) handleGlobalRequests(sshConn *ssh.ServerConn, reqs <-chan *ssh.Request) {
+	listeners := make(map[string]net.Listener)
+	defer func() {
+		for _, listener := range listeners {
+			listener.Close()
+		}
+	}()
+
+	for req := range reqs {
+		switch req.Type {
+		case "keepalive@openssh.com":
+			if !s.blackhole.Load() {
+				req.Reply(true, nil)
+			}
+
+		case "tcpip-forward":
+			var msg struct {
+				Addr string
+				Port uint32
+			}
+			if err := ssh.Unmarshal(req.Payload, &msg); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			listener, err := net.Listen("tcp", net.JoinHostPort(msg.Addr, strconv.Itoa(int(msg.Port))))
+			if err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			port := uint32(listener.Addr().(*net.TCPAddr).Port)
+			listeners[net.JoinHostPort(msg.Addr, strconv.Itoa(int(port)))] = listener
+			go s.acceptForwarded(sshConn, listener, msg.Addr, port)
+
+			reply := make([]byte, 4)
+			binary.BigEndian.PutUint32(reply, port)
+			req.Reply(true, reply)
+
+		case "cancel-tcpip-forward":
+			var msg struct {
+				Addr string
+				Port uint32
+			}
+			ssh.Unmarshal(req.Payload, &msg)
+			key := net.JoinHostPort(msg.Addr, strconv.Itoa(int(msg.Port)))
+			if listener, ok := listeners[key]; ok {
+				listener.Close()
+				delete(listeners, key)
+			}
+			req.Reply(true, nil)
+
+		default:
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+		}
+	}
+}
+
+// acceptForwarded opens a forwarded-tcpip channel for every connection to a
+// remote forward's listener
+func (s *testServer) acceptForwarded(sshConn *ssh.ServerConn, listener net.Listener, addr string, port uint32) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		origin := conn.RemoteAddr().(*net.TCPAddr)
+		payload := ssh.Marshal(struct {
+			Addr       string
+			Port       uint32
+			OriginAddr string
+			OriginPort uint32
+		}{addr, port, origin.IP.String(), uint32(origin.Port)})
+
+		go func() {
+			channel, reqs, err := sshConn.OpenChannel("forwarded-tcpip", payload)
+			if err != nil {
+				conn.Close()
+				return
+			}
+			go ssh.DiscardRequests(reqs)
+			proxy(conn, channel)
+		}()
+	}
+}
+
+// handleDirectTCPIP connects a direct-tcpip channel to its destination
+func (s *testServer) handleDirectTCPIP(newChannel ssh.NewChannel) {
+	if s.stallDial.Load() {
+		return
+	}
+
+	var msg struct {
+		Addr       string
+		Port       uint32
+		OriginAddr string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &msg); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(msg.Addr, strconv.Itoa(int(msg.Port))), 5*time.Second)
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+
+	channel, reqs, err := newChannel.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	proxy(conn, channel)
+}
+
+// handleSession serves a session channel: an echoing shell, or an exec
+// request printing its command. A forwarded agent is listed right away.
+func (s *testServer) handleSession(sshConn *ssh.ServerConn, newChannel ssh.NewChannel) {
+	channel, reqs, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+
+	for req := range reqs {
+		switch req.Type {
+		case "pty-req", "env", "window-change":
+			if req.WantReply {
+				req.Reply(true, nil)
+			}
+
+		case "shell":
+			if s.refuseShell.Load() {
+				req.Reply(false, nil)
+				continue
+			}
+			s.shells.Add(1)
+			req.Reply(true, nil)
+			go func() {
+				io.Copy(channel, channel)
+				channel.Close()
+			}()
+
+		case "auth-agent-req@openssh.com":
+			req.Reply(true, nil)
+			go s.listAgent(sshConn)
+
+		case "exec":
+			var msg struct{ Command string }
+			ssh.Unmarshal(req.Payload, &msg)
+			req.Reply(true, nil)
+			fmt.Fprintf(channel, "exec: %s\n", msg.Command)
+			channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+			return
+
+		default:
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+		}
+	}
+}
+
+// listAgent lists the keys of the agent forwarded over a connection
+func (s *testServer) listAgent(sshConn *ssh.ServerConn) {
+	channel, reqs, err := sshConn.OpenChannel("auth-agent@openssh.com", nil)
+	if err != nil {
+		s.agentKeys <- -1
+		return
+	}
+	defer channel.Close()
+	go ssh.DiscardRequests(reqs)
+
+	keys, err := agent.NewClient(channel).List()
+	if err != nil {
+		s.agentKeys <- -1
+		return
+	}
+	s.agentKeys <- len(keys)
+}
+
+// proxy copies data both ways between a connection and a channel
+func proxy(conn net.Conn, channel ssh.Channel) {
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(channel, conn)
+		channel.CloseWrite()
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, channel)
+		if tcp, ok := conn.(*net.TCPConn); ok {
+			tcp.CloseWrite()
+		}
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+
+	conn.Close()
+	channel.Close()
+}
+
+// startEchoServer starts a TCP server echoing everything it receives
+func startEchoServer(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// roundTrip writes msg to conn and reads the same number of bytes back
+func roundTrip(t *testing.T, conn net.Conn, msg string) string {
+	t.Helper()
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	return string(buf)
+}
+
+// waitFor polls cond until it holds, failing the test after a timeout
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
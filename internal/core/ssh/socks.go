@@ -0,0 +1,185 @@
+package ssh
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SOCKS5 protocol constants (RFC 1928)
+const (
+	socksVersion5 = 0x05
+
+	socksAuthNone         = 0x00
+	socksAuthNoAcceptable = 0xFF
+
+	socksCmdConnect = 0x01
+
+	socksAddrIPv4   = 0x01
+	socksAddrDomain = 0x03
+	socksAddrIPv6   = 0x04
+
+	socksRepSucceeded        = 0x00
+	socksRepGeneralFailure   = 0x01
+	socksRepHostUnreachable  = 0x04
+	socksRepCmdNotSupported  = 0x07
+	socksRepAddrNotSupported = 0x08
+	socksHandshakeTimeout    = 30 * time.Second
+)
+
+// socksError is a handshake failure with the reply code to send to the client
+type socksError struct {
+	reply byte
+	err   error
+}
+
+func (e *socksError) Error() string {
+	return e.err.Error()
+}
+
+// handleSOCKS serves a SOCKS5 CONNECT request, dialing the requested
+// destination through the SSH connection
+func (f *forward) handleSOCKS(local net.Conn) {
+	local.SetDeadline(time.Now().Add(socksHandshakeTimeout))
+
+	target, err := readSOCKSRequest(local)
+	if err != nil {
+		if serr, ok := err.(*socksError); ok {
+			writeSOCKSReply(local, serr.reply)
+		}
+		log.Printf("[SSH Forward %s] SOCKS handshake failed: %v", f.rule.ID, err)
+		local.Close()
+		return
+	}
+
+	remote, err := f.dial(target)
+	if err != nil {
+		log.Printf("[SSH Forward %s] Failed to connect to %s: %v", f.rule.ID, target, err)
+		writeSOCKSReply(local, socksRepHostUnreachable)
+		local.Close()
+		return
+	}
+
+	if err := writeSOCKSReply(local, socksRepSucceeded); err != nil {
+		local.Close()
+		remote.Close()
+		return
+	}
+	local.SetDeadline(time.Time{})
+
+	f.pipe(local, remote, target)
+}
+
+// readSOCKSRequest performs the SOCKS5 greeting and returns the CONNECT destination
+func readSOCKSRequest(conn net.Conn) (string, error) {
+	// Greeting: VER NMETHODS METHODS...
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", fmt.Errorf("failed to read greeting: %w", err)
+	}
+	if header[0] != socksVersion5 {
+		return "", fmt.Errorf("unsupported SOCKS version %d", header[0])
+	}
+
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", fmt.Errorf("failed to read auth methods: %w", err)
+	}
+
+	method := byte(socksAuthNoAcceptable)
+	for _, m := range methods {
+		if m == socksAuthNone {
+			method = socksAuthNone
+			break
+		}
+	}
+	if _, err := conn.Write([]byte{socksVersion5, method}); err != nil {
+		return "", err
+	}
+	if method == socksAuthNoAcceptable {
+		return "", fmt.Errorf("no acceptable auth method")
+	}
+
+	// Request: VER CMD RSV ATYP DST.ADDR DST.PORT
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return "", fmt.Errorf("failed to read request: %w", err)
+	}
+	if request[0] != socksVersion5 {
+		return "", &socksError{socksRepGeneralFailure, fmt.Errorf("unsupported SOCKS version %d in request", request[0])}
+	}
+	if request[1] != socksCmdConnect {
+		return "", &socksError{socksRepCmdNotSupported, fmt.Errorf("unsupported command %d", request[1])}
+	}
+
+	var host string
+	switch request[3] {
+	case socksAddrIPv4, socksAddrIPv6:
+		size := net.IPv4len
+		if request[3] == socksAddrIPv6 {
+			size = net.IPv6len
+		}
+		ip := make([]byte, size)
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", fmt.Errorf("failed to read address: %w", err)
+		}
+		host = net.IP(ip).String()
+
+	case socksAddrDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return "", fmt.Errorf("failed to read address: %w", err)
+		}
+		domain := make([]byte, length[0])
+		if _, err := io.ReadFull(conn, domain); err != nil {
+			return "", fmt.Errorf("failed to read address: %w", err)
+		}
+		host = string(domain)
+
+	default:
+		return "", &socksError{socksRepAddrNotSupported, fmt.Errorf("unsupported address type %d", request[3])}
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return "", &socksError{socksRepGeneralFailure, fmt.Errorf("failed to read port: %w", err)}
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+// socksListenAddr returns the address a SOCKS proxy listens on. The proxy is
+// unauthenticated, so it binds to loopback unless the rule allows otherwise.
+func socksListenAddr(rule ForwardRule) (string, error) {
+	addr := rule.ListenAddr
+	if !strings.Contains(addr, ":") {
+		addr = ":" + addr // Just a port
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid listen address %s: %w", rule.ListenAddr, err)
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	}
+
+	ip := net.ParseIP(host)
+	if host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		if !rule.AllowPublic {
+			return "", fmt.Errorf("SOCKS proxy on non-loopback address %s requires allow_public", rule.ListenAddr)
+		}
+		log.Printf("[SSH Forward %s] Warning: unauthenticated SOCKS proxy listening on %s", rule.ID, host)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// writeSOCKSReply sends a SOCKS5 reply with an unspecified bound address
+func writeSOCKSReply(conn net.Conn, reply byte) error {
+	_, err := conn.Write([]byte{socksVersion5, reply, 0x00, socksAddrIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
@@ -0,0 +1,104 @@
+package ssh
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// socksConnect performs a SOCKS5 CONNECT to an IPv4 target and returns the
+// reply code
+func socksConnect(t *testing.T, conn net.Conn, target string) byte {
+	t.Helper()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := conn.Write([]byte{socksVersion5, 1, socksAuthNone}); err != nil {
+		t.Fatal(err)
+	}
+	method := make([]byte, 2)
+	if _, err := io.ReadFull(conn, method); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(method, []byte{socksVersion5, socksAuthNone}) {
+		t.Fatalf("method selection = %v", method)
+	}
+
+	addr, err := net.ResolveTCPAddr("tcp", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := []byte{socksVersion5, socksCmdConnect, 0x00, socksAddrIPv4}
+	req = append(req, addr.IP.To4()...)
+	req = binary.BigEndian.AppendUint16(req, uint16(addr.Port))
+	if _, err := conn.Write(req); err != nil {
+		t.Fatal(err)
+	}
+
+	reply := make([]byte, 10)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Time{})
+	return reply[1]
+}
+
+func TestDynamicForward(t *testing.T) {
+	server := newTestServer(t)
+	target := startEchoServer(t)
+	client := connectTestClient(t, server.clientConfig())
+
+	status, err := client.AddForward(ForwardRule{Type: ForwardDynamic, ListenAddr: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatalf("AddForward: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", status.BoundAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if reply := socksConnect(t, conn, target); reply != socksRepSucceeded {
+		t.Fatalf("CONNECT reply = %#x, want success", reply)
+	}
+	if got := roundTrip(t, conn, "hello"); got != "hello" {
+		t.Errorf("read %q through the proxy, want %q", got, "hello")
+	}
+
+	waitFor(t, "active connection", func() bool {
+		forwards := client.Forwards()
+		return len(forwards) == 1 && len(forwards[0].ActiveConnections) == 1 &&
+			forwards[0].ActiveConnections[0].TargetAddr == target
+	})
+}
+
+func TestDynamicForwardUnreachable(t *testing.T) {
+	server := newTestServer(t)
+	client := connectTestClient(t, server.clientConfig())
+
+	// Nothing listens on a port that was just released
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := listener.Addr().String()
+	listener.Close()
+
+	status, err := client.AddForward(ForwardRule{Type: ForwardDynamic, ListenAddr: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatalf("AddForward: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", status.BoundAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if reply := socksConnect(t, conn, target); reply != socksRepHostUnreachable {
+		t.Errorf("CONNECT reply = %#x, want host unreachable", reply)
+	}
+}
@@ -0,0 +1,561 @@
+package ssh
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// maxIncludeDepth limits nested Include directives
+const maxIncludeDepth = 16
+
+// maxJumpDepth limits nested ProxyJump resolution
+const maxJumpDepth = 8
+
+// DefaultSSHConfigFile returns the path of the user's ssh_config file
+func DefaultSSHConfigFile() string {
+	return expandHome("~/.ssh/config")
+}
+
+// SSHConfigFile is a parsed OpenSSH client configuration file
+type SSHConfigFile struct {
+	blocks []*configBlock
+}
+
+// configBlock is a Host or Match block with its directives
+type configBlock struct {
+	hostPatterns []string // Host block patterns
+	match        []string // Match block criteria, nil for Host blocks
+	directives   []configDirective
+}
+
+// configDirective is a single "Keyword arguments" line
+type configDirective struct {
+	keyword string // Lower case
+	args    []string
+}
+
+// HostSettings holds the values resolved for a host from ssh_config
+type HostSettings struct {
+	HostName            string
+	User                string
+	Port                int
+	IdentityFiles       []string
+	CertificateFiles    []string
+	IdentityAgent       string
+	ForwardAgent        bool
+	ProxyJump           string
+	ServerAliveInterval int
+	ServerAliveCountMax int
+	ConnectTimeout      int
+	UserKnownHostsFiles []string
+	Forwards            []ForwardRule
+	Ciphers             []string
+	KexAlgorithms       []string
+	MACs                []string
+	HostKeyAlgorithms   []string
+	SetEnv              map[string]string
+}
+
+// LoadSSHConfigFile parses an ssh_config file, following Include directives.
+// A missing file yields an empty configuration.
+func LoadSSHConfigFile(path string) (*SSHConfigFile, error) {
+	file := &SSHConfigFile{}
+	global := &configBlock{hostPatterns: []string{"*"}}
+	file.blocks = append(file.blocks, global)
+
+	if _, err := file.parse(path, global, 0); err != nil {
+		if os.IsNotExist(err) {
+			return file, nil
+		}
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// parse reads a config file into blocks, starting in the given block.
+// It returns the block that is current at the end of the file.
+func (f *SSHConfigFile) parse(path string, current *configBlock, depth int) (*configBlock, error) {
+	if depth > maxIncludeDepth {
+		return nil, fmt.Errorf("too many nested includes in %s", path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		keyword, args, err := parseConfigLine(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNum, err)
+		}
+		if keyword == "" {
+			continue
+		}
+
+		switch keyword {
+		case "host":
+			current = &configBlock{hostPatterns: args}
+			f.blocks = append(f.blocks, current)
+
+		case "match":
+			if len(args) == 0 {
+				return nil, fmt.Errorf("%s:%d: Match requires criteria", path, lineNum)
+			}
+			current = &configBlock{match: args}
+			f.blocks = append(f.blocks, current)
+
+		case "include":
+			parent := current
+			for _, pattern := range args {
+				pattern = expandHome(pattern)
+				if !filepath.IsAbs(pattern) {
+					pattern = filepath.Join(expandHome("~/.ssh"), pattern)
+				}
+				matches, err := filepath.Glob(pattern)
+				if err != nil {
+					return nil, fmt.Errorf("%s:%d: invalid Include pattern: %w", path, lineNum, err)
+				}
+				for _, match := range matches {
+					if _, err := f.parse(match, parent, depth+1); err != nil {
+						return nil, err
+					}
+				}
+			}
+			// Lines after the Include continue in the enclosing block
+			current = &configBlock{hostPatterns: parent.hostPatterns, match: parent.match}
+			f.blocks = append(f.blocks, current)
+
+		default:
+			current.directives = append(current.directives, configDirective{keyword: keyword, args: args})
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return current, nil
+}
+
+// parseConfigLine splits a line into a lower case keyword and its arguments
+func parseConfigLine(line string) (string, []string, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", nil, nil
+	}
+
+	// Keyword and arguments may be separated by whitespace or a single "="
+	end := strings.IndexAny(line, " \t=")
+	if end < 0 {
+		return strings.ToLower(line), nil, nil
+	}
+	keyword := strings.ToLower(line[:end])
+	rest := strings.TrimSpace(line[end:])
+	rest = strings.TrimSpace(strings.TrimPrefix(rest, "="))
+
+	var args []string
+	for rest != "" {
+		var arg string
+		if rest[0] == '"' {
+			closing := strings.IndexByte(rest[1:], '"')
+			if closing < 0 {
+				return "", nil, fmt.Errorf("unterminated quote")
+			}
+			arg = rest[1 : closing+1]
+			rest = rest[closing+2:]
+		} else {
+			end := strings.IndexAny(rest, " \t")
+			if end < 0 {
+				end = len(rest)
+			}
+			arg = rest[:end]
+			rest = rest[end:]
+		}
+		if strings.HasPrefix(arg, "#") {
+			break // Trailing comment
+		}
+		args = append(args, arg)
+		rest = strings.TrimSpace(rest)
+	}
+
+	return keyword, args, nil
+}
+
+// Resolve returns the settings that apply to a host alias. As in OpenSSH,
+// the first value obtained for each setting wins.
+func (f *SSHConfigFile) Resolve(alias string) HostSettings {
+	settings := HostSettings{}
+	seen := make(map[string]bool)
+
+	for _, block := range f.blocks {
+		if !block.matches(alias, settings) {
+			continue
+		}
+
+		for _, d := range block.directives {
+			if len(d.args) == 0 {
+				continue
+			}
+
+			// Settings that accumulate over all matching blocks
+			switch d.keyword {
+			case "identityfile":
+				settings.IdentityFiles = append(settings.IdentityFiles, d.args[0])
+				continue
+			case "certificatefile":
+				settings.CertificateFiles = append(settings.CertificateFiles, d.args[0])
+				continue
+			case "localforward", "remoteforward", "dynamicforward":
+				if rule, ok := parseForwardDirective(d.keyword, d.args); ok {
+					settings.Forwards = append(settings.Forwards, rule)
+				}
+				continue
+			}
+
+			if seen[d.keyword] {
+				continue
+			}
+			seen[d.keyword] = true
+
+			switch d.keyword {
+			case "hostname":
+				settings.HostName = d.args[0]
+			case "user":
+				settings.User = d.args[0]
+			case "port":
+				settings.Port, _ = strconv.Atoi(d.args[0])
+			case "identityagent":
+				settings.IdentityAgent = d.args[0]
+			case "forwardagent":
+				settings.ForwardAgent = strings.EqualFold(d.args[0], "yes")
+			case "proxyjump":
+				settings.ProxyJump = d.args[0]
+			case "serveraliveinterval":
+				settings.ServerAliveInterval, _ = strconv.Atoi(d.args[0])
+			case "serveralivecountmax":
+				settings.ServerAliveCountMax, _ = strconv.Atoi(d.args[0])
+			case "connecttimeout":
+				settings.ConnectTimeout, _ = strconv.Atoi(d.args[0])
+			case "userknownhostsfile":
+				settings.UserKnownHostsFiles = d.args
+			case "ciphers":
+				settings.Ciphers = strings.Split(d.args[0], ",")
+			case "kexalgorithms":
+				settings.KexAlgorithms = strings.Split(d.args[0], ",")
+			case "macs":
+				settings.MACs = strings.Split(d.args[0], ",")
+			case "hostkeyalgorithms":
+				settings.HostKeyAlgorithms = strings.Split(d.args[0], ",")
+			case "setenv":
+				settings.SetEnv = make(map[string]string)
+				for _, arg := range d.args {
+					if name, value, ok := strings.Cut(arg, "="); ok {
+						settings.SetEnv[name] = value
+					}
+				}
+			}
+		}
+	}
+
+	if settings.HostName == "" {
+		settings.HostName = alias
+	} else {
+		settings.HostName = strings.ReplaceAll(settings.HostName, "%h", alias)
+	}
+
+	return settings
+}
+
+// matches reports whether a block applies to the host alias
+func (b *configBlock) matches(alias string, settings HostSettings) bool {
+	if b.match == nil {
+		return matchHostPatterns(b.hostPatterns, alias)
+	}
+
+	host := alias
+	if settings.HostName != "" {
+		host = strings.ReplaceAll(settings.HostName, "%h", alias)
+	}
+
+	criteria := b.match
+	for i := 0; i < len(criteria); i++ {
+		criterion := strings.ToLower(criteria[i])
+		negate := strings.HasPrefix(criterion, "!")
+		criterion = strings.TrimPrefix(criterion, "!")
+
+		var result bool
+		switch criterion {
+		case "all":
+			result = true
+		case "final":
+			result = true // Config is only evaluated once
+		case "canonical":
+			result = false // Hostname canonicalization is not supported
+		case "host", "originalhost", "user", "localuser", "exec":
+			if i+1 >= len(criteria) {
+				return false
+			}
+			i++
+			patterns := strings.Split(criteria[i], ",")
+			switch criterion {
+			case "host":
+				result = matchHostPatterns(patterns, host)
+			case "originalhost":
+				result = matchHostPatterns(patterns, alias)
+			case "user":
+				result = settings.User != "" && matchHostPatterns(patterns, settings.User)
+			case "localuser":
+				result = matchHostPatterns(patterns, localUsername())
+			case "exec":
+				result = false // Running commands is not supported
+			}
+		default:
+			return false
+		}
+
+		if result == negate {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseForwardDirective converts LocalForward/RemoteForward/DynamicForward arguments to a rule
+func parseForwardDirective(keyword string, args []string) (ForwardRule, bool) {
+	listen := args[0]
+	if !strings.Contains(listen, ":") {
+		listen = "127.0.0.1:" + listen
+	}
+
+	switch keyword {
+	case "dynamicforward":
+		return ForwardRule{Type: ForwardDynamic, ListenAddr: listen}, true
+	case "localforward":
+		if len(args) < 2 {
+			return ForwardRule{}, false
+		}
+		return ForwardRule{Type: ForwardLocal, ListenAddr: listen, TargetAddr: args[1]}, true
+	case "remoteforward":
+		if len(args) < 2 {
+			return ForwardRule{}, false
+		}
+		return ForwardRule{Type: ForwardRemote, ListenAddr: listen, TargetAddr: args[1]}, true
+	}
+
+	return ForwardRule{}, false
+}
+
+// ResolveHostAlias merges the ssh_config settings for config.HostAlias into
+// config. Fields already set in config take precedence.
+func ResolveHostAlias(config SSHConfig) (SSHConfig, error) {
+	if config.HostAlias == "" {
+		return config, nil
+	}
+
+	path := config.ConfigFile
+	if path == "" {
+		path = DefaultSSHConfigFile()
+	}
+
+	file, err := LoadSSHConfigFile(expandHome(path))
+	if err != nil {
+		return config, fmt.Errorf("failed to load ssh config: %w", err)
+	}
+
+	return file.apply(config, 0)
+}
+
+// apply merges the settings for config.HostAlias into config
+func (f *SSHConfigFile) apply(config SSHConfig, depth int) (SSHConfig, error) {
+	settings := f.Resolve(config.HostAlias)
+
+	if config.Host == "" {
+		config.Host = settings.HostName
+	}
+	if config.Port == 0 {
+		config.Port = settings.Port
+	}
+	if config.Port == 0 {
+		config.Port = 22
+	}
+	if config.Username == "" {
+		config.Username = settings.User
+	}
+	if config.Username == "" {
+		config.Username = localUsername()
+	}
+	if config.ConnectTimeout == 0 {
+		config.ConnectTimeout = settings.ConnectTimeout
+	}
+	if config.KeepaliveInterval == 0 {
+		config.KeepaliveInterval = settings.ServerAliveInterval
+	}
+	if config.KeepaliveCountMax == 0 {
+		config.KeepaliveCountMax = settings.ServerAliveCountMax
+	}
+	if !config.ForwardAgent {
+		config.ForwardAgent = settings.ForwardAgent
+	}
+	if len(config.Forwards) == 0 {
+		config.Forwards = settings.Forwards
+	}
+	if len(config.Ciphers) == 0 {
+		config.Ciphers = settings.Ciphers
+	}
+	if len(config.KeyExchanges) == 0 {
+		config.KeyExchanges = settings.KexAlgorithms
+	}
+	if len(config.MACs) == 0 {
+		config.MACs = settings.MACs
+	}
+	if len(config.HostKeyAlgorithms) == 0 {
+		config.HostKeyAlgorithms = settings.HostKeyAlgorithms
+	}
+	for name, value := range settings.SetEnv {
+		if _, exists := config.Env[name]; !exists {
+			if config.Env == nil {
+				config.Env = make(map[string]string)
+			}
+			config.Env[name] = value
+		}
+	}
+
+	expand := func(path string) string {
+		return expandTokens(path, config)
+	}
+
+	if len(config.KnownHostsFiles) == 0 {
+		for _, file := range settings.UserKnownHostsFiles {
+			if file != "none" {
+				config.KnownHostsFiles = append(config.KnownHostsFiles, expand(file))
+			}
+		}
+	}
+	if config.AgentSocket == "" && settings.IdentityAgent != "" && settings.IdentityAgent != "none" {
+		socket := settings.IdentityAgent
+		if socket == "SSH_AUTH_SOCK" {
+			socket = os.Getenv("SSH_AUTH_SOCK")
+		} else if strings.HasPrefix(socket, "$") {
+			socket = os.Getenv(strings.TrimPrefix(socket, "$"))
+		}
+		config.AgentSocket = expand(socket)
+	}
+	if config.PrivateKeyPath == "" && config.PrivateKey == "" {
+		for _, file := range settings.IdentityFiles {
+			path := expand(file)
+			if _, err := os.Stat(path); err == nil {
+				config.PrivateKeyPath = path
+				break
+			}
+		}
+	}
+	if config.CertificatePath == "" && config.Certificate == "" {
+		for _, file := range settings.CertificateFiles {
+			path := expand(file)
+			if _, err := os.Stat(path); err == nil {
+				config.CertificatePath = path
+				break
+			}
+		}
+	}
+
+	// Pick auth methods from what the host config provides
+	if config.AuthMethod == "" && len(config.AuthMethods) == 0 {
+		if settings.IdentityAgent != "none" && agentSocket(config) != "" {
+			config.AuthMethods = append(config.AuthMethods, AuthAgent)
+		}
+		if config.PrivateKeyPath != "" || config.PrivateKey != "" {
+			config.AuthMethods = append(config.AuthMethods, AuthPublicKey)
+		}
+		if config.Password != "" || config.PromptHandler != nil {
+			config.AuthMethods = append(config.AuthMethods, AuthKeyboardInteractive)
+		}
+		if config.Password != "" {
+			config.AuthMethods = append(config.AuthMethods, AuthPassword)
+		}
+	}
+
+	// Resolve ProxyJump hosts through the same config file
+	if len(config.JumpHosts) == 0 && settings.ProxyJump != "" && settings.ProxyJump != "none" {
+		if depth >= maxJumpDepth {
+			return config, fmt.Errorf("too many nested ProxyJump hosts for %s", config.HostAlias)
+		}
+
+		for _, spec := range strings.Split(settings.ProxyJump, ",") {
+			jump := parseJumpSpec(spec)
+			jump.ConfigFile = config.ConfigFile
+
+			resolved, err := f.apply(jump, depth+1)
+			if err != nil {
+				return config, err
+			}
+
+			// A jump host's own ProxyJump hops come before it
+			hops := resolved.JumpHosts
+			resolved.JumpHosts = nil
+			resolved.Forwards = nil
+			config.JumpHosts = append(config.JumpHosts, hops...)
+			config.JumpHosts = append(config.JumpHosts, resolved)
+		}
+	}
+
+	return config, nil
+}
+
+// parseJumpSpec parses a "[user@]host[:port]" ProxyJump entry
+func parseJumpSpec(spec string) SSHConfig {
+	spec = strings.TrimPrefix(strings.TrimSpace(spec), "ssh://")
+	jump := SSHConfig{}
+
+	if at := strings.LastIndex(spec, "@"); at >= 0 {
+		jump.Username = spec[:at]
+		spec = spec[at+1:]
+	}
+
+	// Bare IPv6 addresses have no port; bracketed ones may
+	bareIPv6 := strings.Count(spec, ":") > 1 && !strings.HasPrefix(spec, "[")
+	if colon := strings.LastIndex(spec, ":"); colon >= 0 && !bareIPv6 && !strings.HasSuffix(spec, "]") {
+		if port, err := strconv.Atoi(spec[colon+1:]); err == nil {
+			jump.Port = port
+			spec = spec[:colon]
+		}
+	}
+
+	jump.HostAlias = strings.Trim(spec, "[]")
+	return jump
+}
+
+// expandTokens expands "~" and the %d, %h, %p, %r, %u, %n and %% tokens in a path
+func expandTokens(path string, config SSHConfig) string {
+	home, _ := os.UserHomeDir()
+	replacer := strings.NewReplacer(
+		"%%", "%",
+		"%d", home,
+		"%h", config.Host,
+		"%p", strconv.Itoa(config.Port),
+		"%r", config.Username,
+		"%u", localUsername(),
+		"%n", config.HostAlias,
+	)
+	return expandHome(replacer.Replace(path))
+}
+
+// localUsername returns the name of the user running FluxTerm
+func localUsername() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
@@ -0,0 +1,367 @@
+package ssh
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeConfig writes an ssh_config file into a temporary directory and
+// returns its path
+func writeConfig(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// loadConfig parses an ssh_config given as a string
+func loadConfig(t *testing.T, content string) *SSHConfigFile {
+	t.Helper()
+	file, err := LoadSSHConfigFile(writeConfig(t, t.TempDir(), "config", content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestParseConfigLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		keyword string
+		args    []string
+		wantErr bool
+	}{
+		{line: "", keyword: ""},
+		{line: "   # comment", keyword: ""},
+		{line: "HostName example.com", keyword: "hostname", args: []string{"example.com"}},
+		{line: "\tPort=2222", keyword: "port", args: []string{"2222"}},
+		{line: "Port = 2222", keyword: "port", args: []string{"2222"}},
+		{line: "Host a b  c", keyword: "host", args: []string{"a", "b", "c"}},
+		{line: `IdentityFile "~/my keys/id"`, keyword: "identityfile", args: []string{"~/my keys/id"}},
+		{line: "User bob # trailing comment", keyword: "user", args: []string{"bob"}},
+		{line: "Compression", keyword: "compression"},
+		{line: `IdentityFile "unterminated`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		keyword, args, err := parseConfigLine(tt.line)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseConfigLine(%q) error = %v, want error %v", tt.line, err, tt.wantErr)
+			continue
+		}
+		if keyword != tt.keyword || !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("parseConfigLine(%q) = %q, %q, want %q, %q", tt.line, keyword, args, tt.keyword, tt.args)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	file := loadConfig(t, `
+User global
+
+Host web
+  HostName web.internal
+  Port 2222
+  IdentityFile ~/.ssh/web
+
+Host *.example.com !secret.example.com
+  User example
+
+Host web *
+  User fallback
+  Port 22
+  IdentityFile ~/.ssh/default
+  ServerAliveInterval 15
+  LocalForward 8080 localhost:80
+  DynamicForward 1080
+  Ciphers aes128-ctr,aes256-ctr
+  SetEnv LANG=C FOO=bar
+
+Match originalhost db user glob*
+  HostName db.internal
+`)
+
+	tests := []struct {
+		alias string
+		check func(t *testing.T, s HostSettings)
+	}{
+		{"web", func(t *testing.T, s HostSettings) {
+			if s.HostName != "web.internal" || s.Port != 2222 {
+				t.Errorf("host = %s:%d, want web.internal:2222", s.HostName, s.Port)
+			}
+			// The global User at the top of the file wins over later blocks
+			if s.User != "global" {
+				t.Errorf("user = %q", s.User)
+			}
+			if want := []string{"~/.ssh/web", "~/.ssh/default"}; !reflect.DeepEqual(s.IdentityFiles, want) {
+				t.Errorf("identity files = %q, want %q", s.IdentityFiles, want)
+			}
+		}},
+		{"a.example.com", func(t *testing.T, s HostSettings) {
+			if s.HostName != "a.example.com" {
+				t.Errorf("host name = %q, want the alias", s.HostName)
+			}
+			if s.ServerAliveInterval != 15 {
+				t.Errorf("server alive interval = %d, want 15", s.ServerAliveInterval)
+			}
+			if want := []string{"aes128-ctr", "aes256-ctr"}; !reflect.DeepEqual(s.Ciphers, want) {
+				t.Errorf("ciphers = %q, want %q", s.Ciphers, want)
+			}
+			if want := map[string]string{"LANG": "C", "FOO": "bar"}; !reflect.DeepEqual(s.SetEnv, want) {
+				t.Errorf("env = %v, want %v", s.SetEnv, want)
+			}
+			want := []ForwardRule{
+				{Type: ForwardLocal, ListenAddr: "127.0.0.1:8080", TargetAddr: "localhost:80"},
+				{Type: ForwardDynamic, ListenAddr: "127.0.0.1:1080"},
+			}
+			if !reflect.DeepEqual(s.Forwards, want) {
+				t.Errorf("forwards = %+v, want %+v", s.Forwards, want)
+			}
+		}},
+		{"db", func(t *testing.T, s HostSettings) {
+			// Match sees the User resolved by the blocks before it
+			if s.HostName != "db.internal" {
+				t.Errorf("host name = %q, want db.internal", s.HostName)
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.alias, func(t *testing.T) {
+			tt.check(t, file.Resolve(tt.alias))
+		})
+	}
+}
+
+func TestResolveMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		alias  string
+		want   string // Resolved HostName
+	}{
+		{"all", "Match all\n  HostName matched\n", "x", "matched"},
+		{"host uses hostname", "Host x\n  HostName real\nMatch host real\n  User u\n  HostName ignored\n", "x", "real"},
+		{"originalhost", "Match originalhost x,y\n  HostName matched\n", "y", "matched"},
+		{"negated", "Match !originalhost x\n  HostName matched\n", "x", "x"},
+		{"canonical never matches", "Match canonical\n  HostName matched\n", "x", "x"},
+		{"exec never matches", "Match exec true\n  HostName matched\n", "x", "x"},
+		{"unknown criterion", "Match bogus\n  HostName matched\n", "x", "x"},
+		{"missing argument", "Match host\n  HostName matched\n", "x", "x"},
+		{"hostname token", "Host x\n  HostName %h.internal\n", "x", "x.internal"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := loadConfig(t, tt.config).Resolve(tt.alias).HostName; got != tt.want {
+				t.Errorf("host name = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadSSHConfigFileInclude(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "included.conf", "HostName included\nPort 2200\n")
+	main := writeConfig(t, dir, "config", strings.Join([]string{
+		"Host inc",
+		"  Include " + filepath.Join(dir, "*.conf"),
+		"  User after-include",
+		"Host other",
+		"  HostName other.internal",
+	}, "\n"))
+
+	file, err := LoadSSHConfigFile(main)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := file.Resolve("inc")
+	if s.HostName != "included" || s.Port != 2200 || s.User != "after-include" {
+		t.Errorf("inc = %s@%s:%d, want after-include@included:2200", s.User, s.HostName, s.Port)
+	}
+	// Included directives stay within the Host block that included them
+	if s := file.Resolve("other"); s.Port != 0 || s.HostName != "other.internal" {
+		t.Errorf("other = %s:%d, want other.internal:0", s.HostName, s.Port)
+	}
+}
+
+func TestLoadSSHConfigFileErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	// A missing file is an empty configuration
+	file, err := LoadSSHConfigFile(filepath.Join(dir, "missing"))
+	if err != nil {
+		t.Fatalf("missing file: %v", err)
+	}
+	if s := file.Resolve("x"); s.HostName != "x" {
+		t.Errorf("missing file resolves host name %q", s.HostName)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"match without criteria", "Match\n"},
+		{"unterminated quote", "User \"bob\n"},
+		{"include-loop", "Include " + filepath.Join(dir, "include-loop") + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, dir, tt.name, tt.content)
+			if _, err := LoadSSHConfigFile(path); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestParseJumpSpec(t *testing.T) {
+	tests := []struct {
+		spec string
+		want SSHConfig
+	}{
+		{"bastion", SSHConfig{HostAlias: "bastion"}},
+		{"alice@bastion", SSHConfig{HostAlias: "bastion", Username: "alice"}},
+		{"alice@bastion:2222", SSHConfig{HostAlias: "bastion", Username: "alice", Port: 2222}},
+		{"ssh://bastion:22", SSHConfig{HostAlias: "bastion", Port: 22}},
+		{" a@b@bastion ", SSHConfig{HostAlias: "bastion", Username: "a@b"}},
+		{"[2001:db8::1]:2222", SSHConfig{HostAlias: "2001:db8::1", Port: 2222}},
+		{"[2001:db8::1]", SSHConfig{HostAlias: "2001:db8::1"}},
+		{"2001:db8::1", SSHConfig{HostAlias: "2001:db8::1"}},
+	}
+
+	for _, tt := range tests {
+		if got := parseJumpSpec(tt.spec); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseJumpSpec(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParseForwardDirective(t *testing.T) {
+	tests := []struct {
+		keyword string
+		args    []string
+		want    ForwardRule
+		ok      bool
+	}{
+		{"dynamicforward", []string{"1080"}, ForwardRule{Type: ForwardDynamic, ListenAddr: "127.0.0.1:1080"}, true},
+		{"localforward", []string{"0.0.0.0:80", "web:80"}, ForwardRule{Type: ForwardLocal, ListenAddr: "0.0.0.0:80", TargetAddr: "web:80"}, true},
+		{"remoteforward", []string{"9000", "localhost:9000"}, ForwardRule{Type: ForwardRemote, ListenAddr: "127.0.0.1:9000", TargetAddr: "localhost:9000"}, true},
+		{"localforward", []string{"8080"}, ForwardRule{}, false},
+		{"remoteforward", []string{"8080"}, ForwardRule{}, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseForwardDirective(tt.keyword, tt.args)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseForwardDirective(%s, %q) = %+v, %v, want %+v, %v", tt.keyword, tt.args, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestExpandTokens(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+	config := SSHConfig{Host: "web.internal", Port: 2222, Username: "alice", HostAlias: "web"}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/keys/%r@%h:%p", "/keys/alice@web.internal:2222"},
+		{"/keys/%n", "/keys/web"},
+		{"/keys/100%%", "/keys/100%"},
+		{"%d/known_hosts", home + "/known_hosts"},
+		{"~/.ssh/%n", filepath.Join(home, ".ssh/web")},
+		{"/keys/%u", "/keys/" + localUsername()},
+	}
+
+	for _, tt := range tests {
+		if got := expandTokens(tt.path, config); got != tt.want {
+			t.Errorf("expandTokens(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	dir := t.TempDir()
+	key := writeConfig(t, dir, "id_target", "not a real key")
+	file := loadConfig(t, strings.Join([]string{
+		"Host target",
+		"  HostName target.internal",
+		"  User bob",
+		"  Port 2022",
+		"  ProxyJump inner",
+		"  IdentityFile " + filepath.Join(dir, "missing"),
+		"  IdentityFile " + filepath.Join(dir, "id_%n"),
+		"  UserKnownHostsFile none " + filepath.Join(dir, "known_%n"),
+		"  SetEnv LANG=C",
+		"Host inner",
+		"  HostName inner.internal",
+		"  ProxyJump outer:2200",
+		"Host loop",
+		"  ProxyJump loop",
+	}, "\n"))
+
+	t.Run("target", func(t *testing.T) {
+		config, err := file.apply(SSHConfig{HostAlias: "target", Env: map[string]string{"LANG": "en_US"}}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Host != "target.internal" || config.Port != 2022 || config.Username != "bob" {
+			t.Errorf("target = %s@%s:%d", config.Username, config.Host, config.Port)
+		}
+		if config.PrivateKeyPath != key {
+			t.Errorf("private key = %q, want the first existing identity file %q", config.PrivateKeyPath, key)
+		}
+		if want := []string{filepath.Join(dir, "known_target")}; !reflect.DeepEqual(config.KnownHostsFiles, want) {
+			t.Errorf("known hosts = %q, want %q", config.KnownHostsFiles, want)
+		}
+		if want := []AuthMethod{AuthPublicKey}; !reflect.DeepEqual(config.AuthMethods, want) {
+			t.Errorf("auth methods = %q, want %q", config.AuthMethods, want)
+		}
+		if config.Env["LANG"] != "en_US" {
+			t.Errorf("explicit env overridden: %v", config.Env)
+		}
+
+		// Outer jump hosts come first
+		var hops []string
+		for _, jump := range config.JumpHosts {
+			hops = append(hops, jump.Host)
+		}
+		if want := []string{"outer", "inner.internal"}; !reflect.DeepEqual(hops, want) {
+			t.Errorf("jump hosts = %q, want %q", hops, want)
+		}
+		if config.JumpHosts[0].Port != 2200 {
+			t.Errorf("outer port = %d, want 2200", config.JumpHosts[0].Port)
+		}
+	})
+
+	t.Run("explicit fields win", func(t *testing.T) {
+		config, err := file.apply(SSHConfig{HostAlias: "target", Host: "override", Port: 22, Username: "carol", AuthMethod: AuthPassword}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Host != "override" || config.Port != 22 || config.Username != "carol" {
+			t.Errorf("target = %s@%s:%d", config.Username, config.Host, config.Port)
+		}
+		if len(config.AuthMethods) != 0 {
+			t.Errorf("auth methods = %q, want none with an explicit auth method", config.AuthMethods)
+		}
+	})
+
+	t.Run("jump loop", func(t *testing.T) {
+		if _, err := file.apply(SSHConfig{HostAlias: "loop"}, 0); err == nil {
+			t.Error("expected an error for a ProxyJump loop")
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package ssh
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// terminalModeOpcodes maps RFC 4254 terminal mode names to their opcodes
+var terminalModeOpcodes = map[string]uint8{
+	// Special characters
+	"VINTR":    ssh.VINTR,
+	"VQUIT":    ssh.VQUIT,
+	"VERASE":   ssh.VERASE,
+	"VKILL":    ssh.VKILL,
+	"VEOF":     ssh.VEOF,
+	"VEOL":     ssh.VEOL,
+	"VEOL2":    ssh.VEOL2,
+	"VSTART":   ssh.VSTART,
+	"VSTOP":    ssh.VSTOP,
+	"VSUSP":    ssh.VSUSP,
+	"VDSUSP":   ssh.VDSUSP,
+	"VREPRINT": ssh.VREPRINT,
+	"VWERASE":  ssh.VWERASE,
+	"VLNEXT":   ssh.VLNEXT,
+	"VFLUSH":   ssh.VFLUSH,
+	"VSWTCH":   ssh.VSWTCH,
+	"VSTATUS":  ssh.VSTATUS,
+	"VDISCARD": ssh.VDISCARD,
+
+	// Input modes
+	"IGNPAR":  ssh.IGNPAR,
+	"PARMRK":  ssh.PARMRK,
+	"INPCK":   ssh.INPCK,
+	"ISTRIP":  ssh.ISTRIP,
+	"INLCR":   ssh.INLCR,
+	"IGNCR":   ssh.IGNCR,
+	"ICRNL":   ssh.ICRNL,
+	"IUCLC":   ssh.IUCLC,
+	"IXON":    ssh.IXON,
+	"IXANY":   ssh.IXANY,
+	"IXOFF":   ssh.IXOFF,
+	"IMAXBEL": ssh.IMAXBEL,
+	"IUTF8":   ssh.IUTF8,
+
+	// Local modes
+	"ISIG":    ssh.ISIG,
+	"ICANON":  ssh.ICANON,
+	"XCASE":   ssh.XCASE,
+	"ECHO":    ssh.ECHO,
+	"ECHOE":   ssh.ECHOE,
+	"ECHOK":   ssh.ECHOK,
+	"ECHONL":  ssh.ECHONL,
+	"NOFLSH":  ssh.NOFLSH,
+	"TOSTOP":  ssh.TOSTOP,
+	"IEXTEN":  ssh.IEXTEN,
+	"ECHOCTL": ssh.ECHOCTL,
+	"ECHOKE":  ssh.ECHOKE,
+	"PENDIN":  ssh.PENDIN,
+
+	// Output modes
+	"OPOST":  ssh.OPOST,
+	"OLCUC":  ssh.OLCUC,
+	"ONLCR":  ssh.ONLCR,
+	"OCRNL":  ssh.OCRNL,
+	"ONOCR":  ssh.ONOCR,
+	"ONLRET": ssh.ONLRET,
+
+	// Control modes
+	"CS7":    ssh.CS7,
+	"CS8":    ssh.CS8,
+	"PARENB": ssh.PARENB,
+	"PARODD": ssh.PARODD,
+
+	// Speeds
+	"TTY_OP_ISPEED": ssh.TTY_OP_ISPEED,
+	"TTY_OP_OSPEED": ssh.TTY_OP_OSPEED,
+}
+
+// terminalModes returns the default terminal modes with the configured
+// overrides applied
+func terminalModes(config SSHConfig) (ssh.TerminalModes, error) {
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,     // Enable echo
+		ssh.TTY_OP_ISPEED: 14400, // Input speed = 14.4kbaud
+		ssh.TTY_OP_OSPEED: 14400, // Output speed = 14.4kbaud
+	}
+
+	for name, value := range config.TerminalModes {
+		opcode, ok := terminalModeOpcodes[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown terminal mode %q", name)
+		}
+		modes[opcode] = value
+	}
+
+	return modes, nil
+}
+
+// setEnv sends the configured environment variables on a session. Servers
+// commonly refuse variables not listed in AcceptEnv, so failures are only
+// logged.
+func setEnv(session *ssh.Session, env map[string]string) {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := session.Setenv(name, env[name]); err != nil {
+			log.Printf("[SSH] Server refused environment variable %s: %v", name, err)
+		}
+	}
+}
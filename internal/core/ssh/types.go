@@ -1,5 +1,10 @@
 package ssh
 
+import (
+	"fmt"
+	"time"
+)
+
 // AuthMethod represents SSH authentication methods
 type AuthMethod string
 
@@ -7,30 +12,149 @@ const (
 	AuthPassword            AuthMethod = "password"
 	AuthPublicKey           AuthMethod = "publickey"
 	AuthKeyboardInteractive AuthMethod = "keyboard-interactive"
+	AuthAgent               AuthMethod = "agent"
+)
+
+// Connection states reported by Client.Status and status handlers
+const (
+	StateConnected    = "connected"
+	StateReconnecting = "reconnecting"
+	StateDisconnected = "disconnected"
 )
 
-// SSHConfig represents SSH connection configuration
+// PromptHandler answers keyboard-interactive challenges, returning one answer per question
+type PromptHandler func(user, instruction string, questions []string, echos []bool) ([]string, error)
+
+// SSHConfig represents SSH connection configuration. Paths and sockets on
+// this machine are never decoded from JSON, so API clients can't have the
+// backend read files of their choosing; they come from ssh_config instead.
 type SSHConfig struct {
+	// Host alias looked up in ssh_config (~/.ssh/config by default).
+	// Resolved values only fill fields that are not set explicitly.
+	HostAlias  string `json:"host_alias,omitempty"`
+	ConfigFile string `json:"-"`
+
 	Host       string     `json:"host"`
 	Port       int        `json:"port"`
 	Username   string     `json:"username"`
 	AuthMethod AuthMethod `json:"auth_method"`
 
+	// Auth methods tried in order; overrides AuthMethod when set
+	AuthMethods []AuthMethod `json:"auth_methods,omitempty"`
+
 	// Password authentication
 	Password string `json:"password,omitempty"`
 
 	// Public key authentication
-	PrivateKey       string `json:"private_key,omitempty"`        // PEM format or file path
-	PrivateKeyPath   string `json:"private_key_path,omitempty"`   // Path to private key file
+	PrivateKey           string `json:"private_key,omitempty"`            // PEM format
+	PrivateKeyPath       string `json:"-"`                                // Path to private key file
 	PrivateKeyPassphrase string `json:"private_key_passphrase,omitempty"` // Passphrase for encrypted key
 
+	// Certificate authentication. The OpenSSH user certificate is presented
+	// together with the private key or the matching agent identity.
+	Certificate     string `json:"certificate,omitempty"` // authorized_keys format
+	CertificatePath string `json:"-"`                     // Path to *-cert.pub file
+
+	// Keyboard-interactive authentication. When no handler is set,
+	// every question is answered with Password.
+	PromptHandler PromptHandler `json:"-"`
+
+	// Agent authentication
+	AgentSocket  string `json:"-"`                       // Default: $SSH_AUTH_SOCK
+	ForwardAgent bool   `json:"forward_agent,omitempty"` // Forward the local agent to the remote host
+
+	// Host key verification
+	KnownHostsFiles     []string `json:"-"`                               // known_hosts files to check host keys against
+	HostCertAuthorities []string `json:"host_cert_authorities,omitempty"` // "@cert-authority <patterns> <key>" entries
+
+	// Jump hosts dialed in order before the target (ProxyJump). Unset
+	// fields are inherited from the target; terminal settings are ignored.
+	JumpHosts []SSHConfig `json:"jump_hosts,omitempty"`
+
+	// Port forwards started after connecting; connecting fails if one can't start
+	Forwards []ForwardRule `json:"forwards,omitempty"`
+
+	// Algorithm preferences, empty for the defaults. As in ssh_config, a
+	// leading "+", "-" or "^" on the first entry appends to, removes from or
+	// prepends to the defaults, e.g. ["+diffie-hellman-group1-sha1"].
+	Ciphers           []string `json:"ciphers,omitempty"`
+	KeyExchanges      []string `json:"key_exchanges,omitempty"`
+	MACs              []string `json:"macs,omitempty"`
+	HostKeyAlgorithms []string `json:"host_key_algorithms,omitempty"`
+
 	// Terminal settings
-	TerminalType string `json:"terminal_type,omitempty"` // Default: xterm-256color
-	Cols         int    `json:"cols,omitempty"`          // Default: 80
-	Rows         int    `json:"rows,omitempty"`          // Default: 24
+	TerminalType  string            `json:"terminal_type,omitempty"`  // Default: xterm-256color
+	Cols          int               `json:"cols,omitempty"`           // Default: 80
+	Rows          int               `json:"rows,omitempty"`           // Default: 24
+	TerminalModes map[string]uint32 `json:"terminal_modes,omitempty"` // e.g. {"VERASE": 127}, overriding the defaults
+
+	// Environment variables sent before the shell or command starts; servers
+	// only accept those listed in their AcceptEnv
+	Env map[string]string `json:"env,omitempty"`
 
 	// Timeout
 	ConnectTimeout int `json:"connect_timeout,omitempty"` // Seconds, default: 30
+
+	// Automatic reconnect with exponential backoff after a lost connection
+	AutoReconnect        bool `json:"auto_reconnect,omitempty"`
+	ReconnectMaxAttempts int  `json:"reconnect_max_attempts,omitempty"` // 0 retries until closed
+	ReconnectMaxDelay    int  `json:"reconnect_max_delay,omitempty"`    // Seconds, default: 30
+
+	// Keepalive (ServerAliveInterval / ServerAliveCountMax)
+	KeepaliveInterval int `json:"keepalive_interval,omitempty"`  // Seconds, 0 disables keepalives
+	KeepaliveCountMax int `json:"keepalive_count_max,omitempty"` // Missed replies before disconnecting, default: 3
+}
+
+// ExitStatus describes how the remote shell or command ended
+type ExitStatus struct {
+	Code   int    `json:"code"`
+	Signal string `json:"signal,omitempty"` // Signal name without "SIG", e.g. "TERM"
+}
+
+// String returns a human readable description of the exit status
+func (e ExitStatus) String() string {
+	if e.Signal != "" {
+		return fmt.Sprintf("process killed by signal %s", e.Signal)
+	}
+	return fmt.Sprintf("process exited with %d", e.Code)
+}
+
+// ForwardType represents the kind of port forward
+type ForwardType string
+
+const (
+	ForwardLocal   ForwardType = "local"   // -L: local listener, connects from the remote host
+	ForwardRemote  ForwardType = "remote"  // -R: remote listener, connects from this machine
+	ForwardDynamic ForwardType = "dynamic" // -D: local SOCKS5 proxy, connects from the remote host
+)
+
+// ForwardRule describes a port forward
+type ForwardRule struct {
+	ID          string      `json:"id,omitempty"`
+	Type        ForwardType `json:"type"`
+	ListenAddr  string      `json:"listen_addr"`            // e.g. "127.0.0.1:8080", on the remote host for -R
+	TargetAddr  string      `json:"target_addr,omitempty"`  // e.g. "10.0.0.5:80", unused for -D
+	AllowPublic bool        `json:"allow_public,omitempty"` // -D: allow a non-loopback listen address
+}
+
+// ForwardStatus reports the state of a port forward
+type ForwardStatus struct {
+	ForwardRule
+	BoundAddr         string              `json:"bound_addr"`
+	BytesIn           int64               `json:"bytes_in"`  // Bytes received from the target
+	BytesOut          int64               `json:"bytes_out"` // Bytes sent to the target
+	TotalConnections  int64               `json:"total_connections"`
+	ActiveConnections []ForwardConnection `json:"active_connections"`
+}
+
+// ForwardConnection reports a connection carried by a port forward
+type ForwardConnection struct {
+	ID         string    `json:"id"`
+	RemoteAddr string    `json:"remote_addr"`
+	TargetAddr string    `json:"target_addr"`
+	StartedAt  time.Time `json:"started_at"`
+	BytesIn    int64     `json:"bytes_in"`
+	BytesOut   int64     `json:"bytes_out"`
 }
 
 // DefaultSSHConfig returns default SSH configuration
@@ -44,3 +168,29 @@ func DefaultSSHConfig() SSHConfig {
 		ConnectTimeout: 30,
 	}
 }
+
+// WithDefaults returns the configuration with unset fields taken from DefaultSSHConfig
+func (c SSHConfig) WithDefaults() SSHConfig {
+	defaults := DefaultSSHConfig()
+
+	if c.Port == 0 {
+		c.Port = defaults.Port
+	}
+	if c.AuthMethod == "" && len(c.AuthMethods) == 0 {
+		c.AuthMethod = defaults.AuthMethod
+	}
+	if c.TerminalType == "" {
+		c.TerminalType = defaults.TerminalType
+	}
+	if c.Cols == 0 {
+		c.Cols = defaults.Cols
+	}
+	if c.Rows == 0 {
+		c.Rows = defaults.Rows
+	}
+	if c.ConnectTimeout == 0 {
+		c.ConnectTimeout = defaults.ConnectTimeout
+	}
+
+	return c
+}
@@ -0,0 +1,30 @@
+package ssh
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSSHConfigJSONIgnoresPaths(t *testing.T) {
+	data := `{
+		"host": "h",
+		"ssh_config_file": "/tmp/config",
+		"private_key_path": "/etc/shadow",
+		"certificate_path": "/etc/passwd",
+		"agent_socket": "/tmp/agent.sock",
+		"known_hosts_files": ["/etc/hosts"],
+		"jump_hosts": [{"host": "j", "private_key_path": "/etc/shadow"}]
+	}`
+
+	var config SSHConfig
+	if err := json.Unmarshal([]byte(data), &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.ConfigFile != "" || config.PrivateKeyPath != "" || config.CertificatePath != "" ||
+		config.AgentSocket != "" || len(config.KnownHostsFiles) != 0 {
+		t.Errorf("paths decoded from JSON: %+v", config)
+	}
+	if len(config.JumpHosts) != 1 || config.JumpHosts[0].PrivateKeyPath != "" {
+		t.Errorf("jump host paths decoded from JSON: %+v", config.JumpHosts)
+	}
+}
@@ -0,0 +1,166 @@
+// Package client drives a FluxTerm backend through its REST API and the
+// /ws WebSocket protocol.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"github.com/yourusername/fluxterm/pkg/protocol/ws"
+)
+
+// Software identifies this package in the protocol handshake
+const Software = "fluxterm-go-client"
+
+// Client talks to a FluxTerm backend
+type Client struct {
+	BaseURL    *url.URL          // e.g. http://127.0.0.1:8080
+	HTTPClient *http.Client      // Default: http.DefaultClient
+	Dialer     *websocket.Dialer // Default: websocket.DefaultDialer
+	Reconnect  ReconnectPolicy   // How WebSocket connections recover from drops
+}
+
+// New creates a client for the backend at baseURL
+func New(baseURL string) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base URL: scheme must be http or https")
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+
+	return &Client{
+		BaseURL:   u,
+		Reconnect: DefaultReconnectPolicy(),
+	}, nil
+}
+
+// Error is an error reply to a WebSocket request
+type Error struct {
+	ws.ErrorPayload
+	RequestID string
+}
+
+func (e *Error) Error() string {
+	if e.Action != "" {
+		return fmt.Sprintf("%s failed: %s (%s)", e.Action, e.Message, e.Code)
+	}
+	return fmt.Sprintf("%s (%s)", e.Message, e.Code)
+}
+
+// APIError is an unsuccessful REST response
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.StatusCode, e.Message)
+}
+
+// httpClient returns the HTTP client to use
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// endpoint resolves an API path against the base URL. The args fill the
+// verbs of format and are escaped as single path segments.
+func (c *Client) endpoint(format string, args ...string) string {
+	escaped := make([]interface{}, len(args))
+	for i, arg := range args {
+		escaped[i] = url.PathEscape(arg)
+	}
+	rawPath := fmt.Sprintf(format, escaped...)
+	path, _ := url.PathUnescape(rawPath)
+
+	u := *c.BaseURL
+	u.RawPath = u.EscapedPath() + rawPath
+	u.Path += path
+	return u.String()
+}
+
+// do sends a REST request with an optional JSON body and decodes the JSON
+// response into out
+func (c *Client) do(ctx context.Context, method, endpoint string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &APIError{StatusCode: resp.StatusCode, Message: errorMessage(data)}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("invalid response from %s: %w", endpoint, err)
+	}
+	return nil
+}
+
+// errorMessage extracts the message of an error response, which is either
+// {"error": ...} or {"success": false, "message": ...}
+func errorMessage(data []byte) string {
+	var body struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(data, &body); err == nil {
+		if body.Error != "" {
+			return body.Error
+		}
+		if body.Message != "" {
+			return body.Message
+		}
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// wsURL returns the URL of the WebSocket endpoint
+func (c *Client) wsURL() string {
+	u := *c.BaseURL
+	if u.Scheme == "https" {
+		u.Scheme = "wss"
+	} else {
+		u.Scheme = "ws"
+	}
+	u.Path += "/ws"
+	return u.String()
+}
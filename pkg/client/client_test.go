@@ -0,0 +1,145 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/fluxterm/internal/api"
+	"github.com/yourusername/fluxterm/internal/core/serial"
+	"github.com/yourusername/fluxterm/pkg/protocol/ws"
+)
+
+// newTestClient starts a backend and returns a client for it
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	server := httptest.NewServer(api.SetupRouter(serial.NewManager(), nil))
+	t.Cleanup(server.Close)
+
+	c, err := New(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// findSession returns the listed session with an ID
+func findSession(t *testing.T, c *Client, id string) *SessionInfo {
+	t.Helper()
+
+	sessions, err := c.ListSessions(context.Background())
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+	for i := range sessions {
+		if sessions[i].SessionID == id {
+			return &sessions[i]
+		}
+	}
+	return nil
+}
+
+func TestEndpoint(t *testing.T) {
+	c, err := New("http://127.0.0.1:8080/prefix/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := c.endpoint("/api/v1/ports/%s/status", "/dev/ttyUSB0")
+	want := "http://127.0.0.1:8080/prefix/api/v1/ports/%2Fdev%2FttyUSB0/status"
+	if got != want {
+		t.Errorf("endpoint = %q, want %q", got, want)
+	}
+	if got, want := c.wsURL(), "ws://127.0.0.1:8080/prefix/ws"; got != want {
+		t.Errorf("wsURL = %q, want %q", got, want)
+	}
+
+	if _, err := New("ftp://127.0.0.1"); err == nil {
+		t.Error("New accepted a non-HTTP URL")
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	c := newTestClient(t)
+
+	_, err := c.DuplicateSSH(context.Background(), "missing", 0, 0)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("DuplicateSSH error = %v, want an APIError", err)
+	}
+	if apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "Session not found" {
+		t.Errorf("APIError = %d %q", apiErr.StatusCode, apiErr.Message)
+	}
+}
+
+func TestSessionLifecycle(t *testing.T) {
+	c := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	owner, err := c.Dial(ctx)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer owner.Close()
+	if owner.Version() != ws.ProtocolVersion || owner.Server().Software != "fluxterm" {
+		t.Errorf("negotiated version %d with %q", owner.Version(), owner.Server().Software)
+	}
+
+	session, err := owner.OpenSession(ctx, "demo")
+	if err != nil {
+		t.Fatalf("OpenSession: %v", err)
+	}
+	if session.ID != "demo" {
+		t.Errorf("session ID = %q, want %q", session.ID, "demo")
+	}
+
+	// The default session of the handshake is closed again
+	info := findSession(t, c, "demo")
+	if info == nil {
+		t.Fatal("opened session not listed")
+	}
+	if sessions, _ := c.ListSessions(ctx); len(sessions) != 1 {
+		t.Errorf("listed %d sessions, want 1", len(sessions))
+	}
+	if len(info.Subscribers) != 1 || info.Subscribers[0].Role != "owner" ||
+		info.Subscribers[0].Client != Software || info.Subscribers[0].Encoding != ws.EncodingBinary {
+		t.Errorf("subscribers = %+v", info.Subscribers)
+	}
+
+	observerConn, err := c.Dial(ctx)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer observerConn.Close()
+
+	observer, err := observerConn.JoinSession(ctx, "demo", ws.ModeObserver)
+	if err != nil {
+		t.Fatalf("JoinSession: %v", err)
+	}
+	if _, err := observer.Write([]byte("ls\n")); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("observer Write error = %v, want ErrReadOnly", err)
+	}
+	if info := findSession(t, c, "demo"); info == nil || len(info.Subscribers) != 2 {
+		t.Errorf("session after join = %+v, want 2 subscribers", info)
+	}
+
+	// The owner closes the session for everyone
+	if err := session.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	select {
+	case <-observer.Done():
+	case <-ctx.Done():
+		t.Fatal("observer session not ended by the owner closing it")
+	}
+	if findSession(t, c, "demo") != nil {
+		t.Error("closed session still listed")
+	}
+}
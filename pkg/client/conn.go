@@ -0,0 +1,616 @@
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/yourusername/fluxterm/pkg/protocol/ws"
+)
+
+// Connection errors
+var (
+	ErrClosed        = errors.New("connection closed")
+	ErrDisconnected  = errors.New("WebSocket disconnected")
+	ErrSessionClosed = errors.New("session closed")
+	ErrDetached      = errors.New("session attached to another WebSocket")
+	ErrReadOnly      = errors.New("session is attached read-only")
+)
+
+// writeTimeout bounds a single WebSocket write
+const writeTimeout = 10 * time.Second
+
+// ReconnectPolicy controls how a Conn redials after its WebSocket drops.
+// Sessions with a serial or SSH connection survive on the backend for its
+// detach grace period and are reattached; others end.
+type ReconnectPolicy struct {
+	Enabled     bool
+	MaxAttempts int           // 0 retries until the Conn is closed
+	MaxDelay    time.Duration // Longest wait between attempts
+}
+
+// DefaultReconnectPolicy retries with backoff up to 30 seconds apart
+func DefaultReconnectPolicy() ReconnectPolicy {
+	return ReconnectPolicy{
+		Enabled:  true,
+		MaxDelay: 30 * time.Second,
+	}
+}
+
+// Conn is a WebSocket connection to the backend carrying any number of
+// sessions
+type Conn struct {
+	client *Client
+
+	mu       sync.Mutex
+	ws       *websocket.Conn // nil while reconnecting
+	server   ws.HelloPayload
+	version  int // Negotiated protocol version
+	sessions map[string]*Session
+	calls    map[string]*call // Requests waiting for replies, by request ID
+	prefix   string           // Keeps request IDs apart from other clients' in shared sessions
+	seq      uint64
+	closed   bool
+	err      error // Why the connection ended
+
+	writeMu sync.Mutex
+	done    chan struct{} // Closed when the connection ends
+}
+
+// call is a request waiting for its replies
+type call struct {
+	id      string
+	replies chan ws.Message
+	done    chan struct{} // Closed when the caller stops waiting
+	lost    chan struct{} // Closed when the WebSocket drops first
+}
+
+// Dial connects to the backend's WebSocket endpoint and negotiates the
+// protocol version
+func (c *Client) Dial(ctx context.Context) (*Conn, error) {
+	conn := &Conn{
+		client:   c,
+		sessions: make(map[string]*Session),
+		calls:    make(map[string]*call),
+		prefix:   strconv.FormatUint(rand.Uint64(), 36),
+		done:     make(chan struct{}),
+	}
+
+	wsConn, err := conn.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn.ws = wsConn
+	go conn.readLoop(wsConn)
+
+	return conn, nil
+}
+
+// dial opens a WebSocket and performs the handshake. The session the
+// backend opens on every new WebSocket is closed, since sessions are opened
+// explicitly.
+func (c *Conn) dial(ctx context.Context) (*websocket.Conn, error) {
+	dialer := c.client.Dialer
+	if dialer == nil {
+		dialer = websocket.DefaultDialer
+	}
+
+	wsConn, _, err := dialer.DialContext(ctx, c.client.wsURL(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", c.client.wsURL(), err)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		wsConn.SetReadDeadline(deadline)
+	}
+	if err := c.handshake(wsConn); err != nil {
+		wsConn.Close()
+		return nil, err
+	}
+	wsConn.SetReadDeadline(time.Time{})
+
+	return wsConn, nil
+}
+
+// handshake exchanges hellos over a new WebSocket. It reads synchronously,
+// before the read loop starts.
+func (c *Conn) handshake(wsConn *websocket.Conn) error {
+	var server ws.HelloPayload
+	var defaultSession string
+	for defaultSession == "" {
+		msg, err := readJSON(wsConn)
+		if err != nil {
+			return fmt.Errorf("handshake: %w", err)
+		}
+		switch msg.Type {
+		case ws.MsgTypeHello:
+			if err := json.Unmarshal(msg.Payload, &server); err != nil {
+				return fmt.Errorf("handshake: invalid hello: %w", err)
+			}
+		case ws.MsgTypeStatus:
+			defaultSession = msg.SessionID
+		}
+	}
+
+	version, err := ws.Negotiate(server)
+	if err != nil {
+		return fmt.Errorf("handshake: %w", err)
+	}
+
+	requestID := c.nextRequestID()
+	hello := ws.NewHello(Software)
+	if err := c.write(wsConn, newMessage(ws.MsgTypeHello, "", requestID, hello)); err != nil {
+		return fmt.Errorf("handshake: %w", err)
+	}
+	for {
+		msg, err := readJSON(wsConn)
+		if err != nil {
+			return fmt.Errorf("handshake: %w", err)
+		}
+		if msg.RequestID != requestID {
+			continue
+		}
+		if msg.Type == ws.MsgTypeError {
+			return fmt.Errorf("handshake: %w", replyError(msg))
+		}
+		break
+	}
+
+	ctrl := newControl(ws.ActionCloseSession, nil)
+	if err := c.write(wsConn, newMessage(ws.MsgTypeControl, defaultSession, "", ctrl)); err != nil {
+		return fmt.Errorf("handshake: %w", err)
+	}
+
+	c.mu.Lock()
+	c.server = server
+	c.version = version
+	c.mu.Unlock()
+	return nil
+}
+
+// Version returns the negotiated protocol version
+func (c *Conn) Version() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.version
+}
+
+// Server returns the capabilities the backend announced
+func (c *Conn) Server() ws.HelloPayload {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.server
+}
+
+// Done is closed when the connection ends for good
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the connection ended, once it has
+func (c *Conn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close closes the WebSocket. Connected sessions stay open on the backend
+// for their detach grace period.
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	wsConn := c.ws
+	c.ws = nil
+	c.mu.Unlock()
+
+	c.shutdown(ErrClosed)
+	if wsConn == nil {
+		return nil
+	}
+
+	c.writeMu.Lock()
+	wsConn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(writeTimeout))
+	c.writeMu.Unlock()
+	return wsConn.Close()
+}
+
+// shutdown ends the connection and its sessions
+func (c *Conn) shutdown(err error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	c.err = err
+	sessions := c.sessions
+	c.sessions = make(map[string]*Session)
+	c.failCalls()
+	c.mu.Unlock()
+
+	for _, session := range sessions {
+		session.finish(err)
+	}
+	close(c.done)
+}
+
+// failCalls releases the requests whose replies were lost. Must be called
+// with c.mu held.
+func (c *Conn) failCalls() {
+	for id, call := range c.calls {
+		close(call.lost)
+		delete(c.calls, id)
+	}
+}
+
+// readLoop dispatches the messages of a WebSocket until it fails
+func (c *Conn) readLoop(wsConn *websocket.Conn) {
+	for {
+		messageType, data, err := wsConn.ReadMessage()
+		if err != nil {
+			c.disconnected(wsConn, err)
+			return
+		}
+
+		if messageType == websocket.BinaryMessage {
+			c.handleBinary(data)
+		} else {
+			c.handleMessage(data)
+		}
+	}
+}
+
+// handleBinary delivers a binary data frame to its session
+func (c *Conn) handleBinary(data []byte) {
+	var frame ws.BinaryFrame
+	if err := frame.UnmarshalBinary(data); err != nil || frame.Type != ws.FrameTypeData {
+		return
+	}
+	if session := c.session(frame.SessionID); session != nil {
+		session.output(frame.Payload)
+	}
+}
+
+// handleMessage delivers a JSON message to the request it answers and to
+// its session
+func (c *Conn) handleMessage(data []byte) {
+	var msg ws.Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return
+	}
+	if msg.RequestID != "" {
+		c.deliver(msg)
+	}
+
+	session := c.session(msg.SessionID)
+	if session == nil {
+		return
+	}
+
+	switch msg.Type {
+	case ws.MsgTypeData:
+		var payload ws.DataPayload
+		if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+			return
+		}
+		if decoded, err := base64.StdEncoding.DecodeString(payload.Data); err == nil {
+			session.output(decoded)
+		}
+	case ws.MsgTypeStatus:
+		var payload ws.StatusPayload
+		if err := json.Unmarshal(msg.Payload, &payload); err == nil {
+			session.status(payload)
+		}
+	case ws.MsgTypeAuthPrompt:
+		var payload ws.AuthPromptPayload
+		if err := json.Unmarshal(msg.Payload, &payload); err == nil {
+			// Answering may take a while; keep reading meanwhile
+			go session.prompt(payload)
+		}
+	}
+}
+
+// deliver hands a reply to the request waiting for it
+func (c *Conn) deliver(msg ws.Message) {
+	c.mu.Lock()
+	call, ok := c.calls[msg.RequestID]
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	select {
+	case call.replies <- msg:
+	case <-call.done:
+	}
+}
+
+// disconnected handles a failed WebSocket, reconnecting when the policy
+// allows it
+func (c *Conn) disconnected(wsConn *websocket.Conn, err error) {
+	wsConn.Close()
+
+	c.mu.Lock()
+	if c.closed || c.ws != wsConn {
+		c.mu.Unlock()
+		return
+	}
+	c.ws = nil
+	c.failCalls()
+	c.mu.Unlock()
+
+	if !c.client.Reconnect.Enabled {
+		c.shutdown(fmt.Errorf("%w: %v", ErrDisconnected, err))
+		return
+	}
+	go c.reconnect(err)
+}
+
+// reconnect redials with exponential backoff and reattaches the sessions
+func (c *Conn) reconnect(cause error) {
+	policy := c.client.Reconnect
+	maxDelay := policy.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = 30 * time.Second
+	}
+
+	delay := 500 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		// Up to 25% jitter so clients don't redial in lockstep
+		wait := delay + time.Duration(rand.Int64N(int64(delay)/4+1))
+		select {
+		case <-time.After(wait):
+		case <-c.done:
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), maxDelay)
+		wsConn, err := c.dial(ctx)
+		cancel()
+		if err == nil {
+			c.resume(wsConn)
+			return
+		}
+
+		cause = err
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			c.shutdown(fmt.Errorf("%w: gave up after %d reconnect attempts: %v", ErrDisconnected, attempt, cause))
+			return
+		}
+		delay = min(delay*2, maxDelay)
+	}
+}
+
+// resume switches to a redialed WebSocket and reattaches the sessions
+func (c *Conn) resume(wsConn *websocket.Conn) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		wsConn.Close()
+		return
+	}
+	c.ws = wsConn
+	sessions := make([]*Session, 0, len(c.sessions))
+	for _, session := range c.sessions {
+		sessions = append(sessions, session)
+	}
+	c.mu.Unlock()
+
+	go c.readLoop(wsConn)
+
+	for _, session := range sessions {
+		ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+		if err := session.reattach(ctx); err != nil {
+			c.removeSession(session)
+			session.finish(err)
+		}
+		cancel()
+	}
+}
+
+// session returns the session with the given ID
+func (c *Conn) session(id string) *Session {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sessions[id]
+}
+
+// addSession registers a session so its messages are delivered to it
+func (c *Conn) addSession(session *Session) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return c.err
+	}
+	if _, exists := c.sessions[session.ID]; exists {
+		return fmt.Errorf("session %s already open on this connection", session.ID)
+	}
+	c.sessions[session.ID] = session
+	return nil
+}
+
+// removeSession unregisters a session
+func (c *Conn) removeSession(session *Session) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.sessions[session.ID] == session {
+		delete(c.sessions, session.ID)
+	}
+}
+
+// nextRequestID returns a request ID unique on this connection
+func (c *Conn) nextRequestID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.seq++
+	return c.prefix + "-" + strconv.FormatUint(c.seq, 10)
+}
+
+// start sends a control request and registers for its replies. The caller
+// must end the call with finish.
+func (c *Conn) start(sessionID, action string, params interface{}) (*call, error) {
+	if validator, ok := params.(ws.Validator); ok {
+		if err := validator.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	call := &call{
+		id:      c.nextRequestID(),
+		replies: make(chan ws.Message, 16),
+		done:    make(chan struct{}),
+		lost:    make(chan struct{}),
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	c.calls[call.id] = call
+	c.mu.Unlock()
+
+	if err := c.send(newMessage(ws.MsgTypeControl, sessionID, call.id, newControl(action, params))); err != nil {
+		c.finish(call)
+		return nil, err
+	}
+	return call, nil
+}
+
+// finish stops waiting for the replies of a request
+func (c *Conn) finish(call *call) {
+	c.mu.Lock()
+	if c.calls[call.id] == call {
+		delete(c.calls, call.id)
+	}
+	c.mu.Unlock()
+	close(call.done)
+}
+
+// wait returns the next reply to a request. Error replies are returned as
+// *Error.
+func (c *Conn) wait(ctx context.Context, call *call) (ws.Message, error) {
+	select {
+	case msg := <-call.replies:
+		if msg.Type == ws.MsgTypeError {
+			return msg, replyError(msg)
+		}
+		return msg, nil
+	case <-call.lost:
+		return ws.Message{}, ErrDisconnected
+	case <-ctx.Done():
+		return ws.Message{}, ctx.Err()
+	}
+}
+
+// roundTrip sends a control request and waits for its first reply
+func (c *Conn) roundTrip(ctx context.Context, sessionID, action string, params interface{}) (ws.Message, error) {
+	call, err := c.start(sessionID, action, params)
+	if err != nil {
+		return ws.Message{}, err
+	}
+	defer c.finish(call)
+
+	return c.wait(ctx, call)
+}
+
+// send writes a JSON message to the current WebSocket
+func (c *Conn) send(msg ws.Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return c.sendFrame(websocket.TextMessage, data)
+}
+
+// sendFrame writes a frame to the current WebSocket
+func (c *Conn) sendFrame(messageType int, data []byte) error {
+	c.mu.Lock()
+	wsConn, closed, connErr := c.ws, c.closed, c.err
+	c.mu.Unlock()
+
+	if closed {
+		return connErr
+	}
+	if wsConn == nil {
+		return ErrDisconnected
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	wsConn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return wsConn.WriteMessage(messageType, data)
+}
+
+// write writes a JSON message to a WebSocket that isn't in use yet
+func (c *Conn) write(wsConn *websocket.Conn, msg ws.Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	wsConn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return wsConn.WriteMessage(websocket.TextMessage, data)
+}
+
+// readJSON reads the next JSON message, skipping binary frames
+func readJSON(wsConn *websocket.Conn) (ws.Message, error) {
+	for {
+		messageType, data, err := wsConn.ReadMessage()
+		if err != nil {
+			return ws.Message{}, err
+		}
+		if messageType != websocket.TextMessage {
+			continue
+		}
+
+		var msg ws.Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return ws.Message{}, fmt.Errorf("invalid message: %w", err)
+		}
+		return msg, nil
+	}
+}
+
+// newMessage builds a message with a JSON payload
+func newMessage(msgType ws.MessageType, sessionID, requestID string, payload interface{}) ws.Message {
+	payloadJSON, _ := json.Marshal(payload)
+	return ws.Message{
+		Type:      msgType,
+		SessionID: sessionID,
+		RequestID: requestID,
+		Payload:   payloadJSON,
+		Timestamp: time.Now().UnixMilli(),
+	}
+}
+
+// newControl builds a control payload
+func newControl(action string, params interface{}) ws.ControlPayload {
+	ctrl := ws.ControlPayload{Action: action}
+	if params != nil {
+		ctrl.Params, _ = json.Marshal(params)
+	}
+	return ctrl
+}
+
+// replyError decodes an error reply
+func replyError(msg ws.Message) error {
+	e := &Error{RequestID: msg.RequestID}
+	if err := json.Unmarshal(msg.Payload, &e.ErrorPayload); err != nil {
+		e.Code = "INVALID_ERROR"
+		e.Message = string(msg.Payload)
+	}
+	return e
+}
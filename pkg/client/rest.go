@@ -0,0 +1,343 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/yourusername/fluxterm/pkg/protocol/ws"
+)
+
+// PortInfo describes a serial port found on the backend's machine
+type PortInfo struct {
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	IsUSB        bool   `json:"is_usb"`
+	VID          string `json:"vid,omitempty"`
+	PID          string `json:"pid,omitempty"`
+	SerialNumber string `json:"serial_number,omitempty"`
+}
+
+// SerialConfig configures a serial port opened over REST
+type SerialConfig struct {
+	Port        string `json:"port"`
+	BaudRate    int    `json:"baud_rate"`
+	DataBits    int    `json:"data_bits"`
+	StopBits    int    `json:"stop_bits"` // 1, 15 (for 1.5) or 2
+	Parity      string `json:"parity"`
+	FlowControl string `json:"flow_control"` // Only "none" is supported
+}
+
+// PortStatus reports an open serial port
+type PortStatus struct {
+	Name   string       `json:"name"`
+	Open   bool         `json:"open"`
+	Config SerialConfig `json:"config"`
+}
+
+// ExitStatus reports how a remote command or shell ended
+type ExitStatus struct {
+	Code   int    `json:"code"`
+	Signal string `json:"signal,omitempty"`
+}
+
+// SSHSession reports an SSH session kept by the backend
+type SSHSession struct {
+	SessionID    string      `json:"session_id,omitempty"`
+	Connected    bool        `json:"connected"`
+	AuthMethod   string      `json:"auth_method,omitempty"`
+	State        string      `json:"state,omitempty"`
+	Reason       string      `json:"reason,omitempty"`
+	ExitStatus   *ExitStatus `json:"exit_status,omitempty"`
+	ConnectionID string      `json:"connection_id,omitempty"`
+	Channels     int         `json:"channels,omitempty"`
+}
+
+// ExecResult is the output of a command run over REST
+type ExecResult struct {
+	Stdout     string      `json:"stdout"`
+	Stderr     string      `json:"stderr"`
+	ExitStatus *ExitStatus `json:"exit_status,omitempty"`
+	Truncated  bool        `json:"truncated,omitempty"`
+}
+
+// ForwardStatus reports a port forward of an SSH session
+type ForwardStatus struct {
+	ws.ForwardParams
+	BoundAddr         string              `json:"bound_addr"`
+	BytesIn           int64               `json:"bytes_in"`
+	BytesOut          int64               `json:"bytes_out"`
+	TotalConnections  int64               `json:"total_connections"`
+	ActiveConnections []ForwardConnection `json:"active_connections"`
+}
+
+// ForwardConnection reports a connection carried by a port forward
+type ForwardConnection struct {
+	ID         string    `json:"id"`
+	RemoteAddr string    `json:"remote_addr"`
+	TargetAddr string    `json:"target_addr"`
+	StartedAt  time.Time `json:"started_at"`
+	BytesIn    int64     `json:"bytes_in"`
+	BytesOut   int64     `json:"bytes_out"`
+}
+
+// SessionInfo describes a WebSocket session and its subscribers
+type SessionInfo struct {
+	SessionID    string           `json:"session_id"`
+	ConnType     string           `json:"conn_type,omitempty"`
+	Detached     bool             `json:"detached"`
+	OutputOffset int64            `json:"output_offset"`
+	Subscribers  []SubscriberInfo `json:"subscribers"`
+	Log          *LogStatus       `json:"log,omitempty"` // Set while the output is logged
+}
+
+// LogStatus reports the logging of a session's output on the backend
+type LogStatus struct {
+	Path           string    `json:"path"` // Current log file
+	Format         string    `json:"format"`
+	FileName       string    `json:"file_name"` // Template
+	MaxSize        int64     `json:"max_size"`
+	RotateInterval int       `json:"rotate_interval"` // Seconds
+	MaxFiles       int       `json:"max_files"`
+	StartedAt      time.Time `json:"started_at"`
+	BytesLogged    int64     `json:"bytes_logged"`
+	FileSize       int64     `json:"file_size"`
+	Files          int       `json:"files"`
+	Error          string    `json:"error,omitempty"`
+}
+
+// SubscriberInfo describes a WebSocket attached to a session
+type SubscriberInfo struct {
+	SocketID        string     `json:"socket_id"`
+	Role            string     `json:"role"`
+	Encoding        string     `json:"encoding"`
+	ProtocolVersion int        `json:"protocol_version,omitempty"`
+	Client          string     `json:"client,omitempty"`
+	Queue           QueueStats `json:"queue"`
+}
+
+// QueueStats reports the outbound queue of a subscriber
+type QueueStats struct {
+	Depth           int   `json:"depth"`
+	PendingBytes    int   `json:"pending_bytes"`
+	MaxDepth        int   `json:"max_depth"`
+	MessagesSent    int64 `json:"messages_sent"`
+	DataBytesSent   int64 `json:"data_bytes_sent"`
+	ChunksCoalesced int64 `json:"chunks_coalesced"`
+	Pauses          int64 `json:"pauses"`
+}
+
+// result is the envelope of responses that report success in the body
+type result struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+}
+
+func (r result) err() error {
+	if !r.Success {
+		return errors.New(r.Message)
+	}
+	return nil
+}
+
+// Health checks that the backend is up
+func (c *Client) Health(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, c.endpoint("/health"), nil, nil)
+}
+
+// ListPorts lists the serial ports of the backend's machine
+func (c *Client) ListPorts(ctx context.Context) ([]PortInfo, error) {
+	var resp struct {
+		Ports []PortInfo `json:"ports"`
+	}
+	err := c.do(ctx, http.MethodGet, c.endpoint("/api/v1/ports"), nil, &resp)
+	return resp.Ports, err
+}
+
+// ListOpenPorts lists the names of the serial ports the backend has open
+func (c *Client) ListOpenPorts(ctx context.Context) ([]string, error) {
+	var resp struct {
+		Ports []string `json:"ports"`
+	}
+	err := c.do(ctx, http.MethodGet, c.endpoint("/api/v1/ports/open"), nil, &resp)
+	return resp.Ports, err
+}
+
+// OpenPort opens a serial port without a session, returning the applied
+// configuration
+func (c *Client) OpenPort(ctx context.Context, config SerialConfig) (*SerialConfig, error) {
+	var resp struct {
+		Config SerialConfig `json:"config"`
+	}
+	if err := c.do(ctx, http.MethodPost, c.endpoint("/api/v1/ports/open"), config, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Config, nil
+}
+
+// ClosePort closes a serial port
+func (c *Client) ClosePort(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodPost, c.endpoint("/api/v1/ports/%s/close", name), nil, nil)
+}
+
+// PortStatus reports an open serial port
+func (c *Client) PortStatus(ctx context.Context, name string) (*PortStatus, error) {
+	var status PortStatus
+	if err := c.do(ctx, http.MethodGet, c.endpoint("/api/v1/ports/%s/status", name), nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// SetDTR sets the DTR line of an open serial port
+func (c *Client) SetDTR(ctx context.Context, name string, value bool) error {
+	body := map[string]bool{"value": value}
+	return c.do(ctx, http.MethodPost, c.endpoint("/api/v1/ports/%s/dtr", name), body, nil)
+}
+
+// SetRTS sets the RTS line of an open serial port
+func (c *Client) SetRTS(ctx context.Context, name string, value bool) error {
+	body := map[string]bool{"value": value}
+	return c.do(ctx, http.MethodPost, c.endpoint("/api/v1/ports/%s/rts", name), body, nil)
+}
+
+// ConnectSSH opens an SSH session on the backend, which WebSocket sessions
+// can then attach with Session.AttachSSH. Keyboard-interactive auth isn't
+// available over REST.
+func (c *Client) ConnectSSH(ctx context.Context, params ws.ConnectSSHParams) (*SSHSession, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	return c.sshSession(ctx, http.MethodPost, c.endpoint("/api/v1/ssh/connect"), params)
+}
+
+// DuplicateSSH opens another shell on the connection of an SSH session
+func (c *Client) DuplicateSSH(ctx context.Context, sessionID string, cols, rows int) (*SSHSession, error) {
+	body := map[string]int{"cols": cols, "rows": rows}
+	return c.sshSession(ctx, http.MethodPost, c.endpoint("/api/v1/ssh/%s/duplicate", sessionID), body)
+}
+
+// SSHStatus reports an SSH session
+func (c *Client) SSHStatus(ctx context.Context, sessionID string) (*SSHSession, error) {
+	return c.sshSession(ctx, http.MethodGet, c.endpoint("/api/v1/ssh/%s/status", sessionID), nil)
+}
+
+// DisconnectSSH closes an SSH session
+func (c *Client) DisconnectSSH(ctx context.Context, sessionID string) error {
+	_, err := c.sshSession(ctx, http.MethodDelete, c.endpoint("/api/v1/ssh/%s", sessionID), nil)
+	return err
+}
+
+// sshSession calls an SSH session endpoint
+func (c *Client) sshSession(ctx context.Context, method, endpoint string, body interface{}) (*SSHSession, error) {
+	var resp struct {
+		result
+		SSHSession
+	}
+	if err := c.do(ctx, method, endpoint, body, &resp); err != nil {
+		return nil, err
+	}
+	if err := resp.err(); err != nil {
+		return nil, err
+	}
+	return &resp.SSHSession, nil
+}
+
+// ExecSSH runs a command without a PTY on an SSH session and returns its
+// output. The timeout is in seconds; 0 uses the backend's default.
+func (c *Client) ExecSSH(ctx context.Context, sessionID, command string, timeout int) (*ExecResult, error) {
+	body := map[string]interface{}{"command": command, "timeout": timeout}
+
+	var resp struct {
+		result
+		ExecResult
+	}
+	if err := c.do(ctx, http.MethodPost, c.endpoint("/api/v1/ssh/%s/exec", sessionID), body, &resp); err != nil {
+		return nil, err
+	}
+	if err := resp.err(); err != nil {
+		return &resp.ExecResult, err
+	}
+	return &resp.ExecResult, nil
+}
+
+// ListForwards lists the port forwards of an SSH session
+func (c *Client) ListForwards(ctx context.Context, sessionID string) ([]ForwardStatus, error) {
+	var resp struct {
+		result
+		Forwards []ForwardStatus `json:"forwards"`
+	}
+	if err := c.do(ctx, http.MethodGet, c.endpoint("/api/v1/ssh/%s/forwards", sessionID), nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Forwards, resp.err()
+}
+
+// AddForward starts a port forward on an SSH session
+func (c *Client) AddForward(ctx context.Context, sessionID string, forward ws.ForwardParams) (*ForwardStatus, error) {
+	if err := forward.Validate(); err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		result
+		Forward *ForwardStatus `json:"forward"`
+	}
+	if err := c.do(ctx, http.MethodPost, c.endpoint("/api/v1/ssh/%s/forwards", sessionID), forward, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Forward, resp.err()
+}
+
+// RemoveForward stops a port forward of an SSH session
+func (c *Client) RemoveForward(ctx context.Context, sessionID, forwardID string) error {
+	var resp result
+	if err := c.do(ctx, http.MethodDelete, c.endpoint("/api/v1/ssh/%s/forwards/%s", sessionID, forwardID), nil, &resp); err != nil {
+		return err
+	}
+	return resp.err()
+}
+
+// ListSessions lists the WebSocket sessions of the backend, including
+// detached ones that can still be attached
+func (c *Client) ListSessions(ctx context.Context) ([]SessionInfo, error) {
+	var resp struct {
+		result
+		Sessions []SessionInfo `json:"sessions"`
+	}
+	if err := c.do(ctx, http.MethodGet, c.endpoint("/api/v1/ws/sessions"), nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Sessions, resp.err()
+}
+
+// SessionLog reports the logging of a session, or nil when it isn't logged
+func (c *Client) SessionLog(ctx context.Context, sessionID string) (*LogStatus, error) {
+	return c.sessionLog(ctx, http.MethodGet, sessionID, nil)
+}
+
+// StartSessionLog starts logging a session's output on the backend
+func (c *Client) StartSessionLog(ctx context.Context, sessionID string, params ws.StartLogParams) (*LogStatus, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	return c.sessionLog(ctx, http.MethodPost, sessionID, params)
+}
+
+// StopSessionLog stops logging a session's output, returning the final
+// status of the log
+func (c *Client) StopSessionLog(ctx context.Context, sessionID string) (*LogStatus, error) {
+	return c.sessionLog(ctx, http.MethodDelete, sessionID, nil)
+}
+
+func (c *Client) sessionLog(ctx context.Context, method, sessionID string, body interface{}) (*LogStatus, error) {
+	var resp struct {
+		result
+		Log *LogStatus `json:"log"`
+	}
+	if err := c.do(ctx, method, c.endpoint("/api/v1/ws/sessions/%s/log", sessionID), body, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Log, resp.err()
+}
@@ -0,0 +1,505 @@
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/yourusername/fluxterm/pkg/protocol/ws"
+)
+
+// maxBuffered is how much unread output a session keeps. The oldest output
+// is dropped beyond it.
+const maxBuffered = 4 << 20
+
+// maxWriteChunk is the largest data frame a session sends
+const maxWriteChunk = 32 << 10
+
+// roleOwner is the role of the socket a session is opened or attached on
+const roleOwner = "owner"
+
+// StatusHandler is called with the status messages of a session. It runs on
+// the connection's read loop and must not block.
+type StatusHandler func(status ws.StatusPayload)
+
+// PromptHandler answers a keyboard-interactive challenge while an SSH
+// connection authenticates. Returning an error cancels the authentication.
+type PromptHandler func(prompt ws.AuthPromptPayload) ([]string, error)
+
+// Session is a terminal session carried by a Conn. It reads the output of
+// its serial or SSH connection and writes input to it.
+type Session struct {
+	ID   string
+	conn *Conn
+
+	mu       sync.Mutex
+	cond     *sync.Cond // Signaled when output arrives or the session ends
+	buf      []byte     // Output not read yet
+	offset   int64      // Output bytes the backend has sent, for replay on reattach
+	role     string     // "owner", ws.ModeWriter or ws.ModeObserver
+	onStatus StatusHandler
+	onPrompt PromptHandler
+	err      error
+	done     chan struct{}
+}
+
+// newSession creates a session attached with a role
+func newSession(conn *Conn, id, role string) *Session {
+	s := &Session{
+		ID:   id,
+		conn: conn,
+		role: role,
+		done: make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// OpenSession opens a new session on the connection. An empty ID lets the
+// backend choose one.
+func (c *Conn) OpenSession(ctx context.Context, id string) (*Session, error) {
+	reply, err := c.roundTrip(ctx, id, ws.ActionOpenSession, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	session := newSession(c, reply.SessionID, roleOwner)
+	if err := c.addSession(session); err != nil {
+		return nil, err
+	}
+	if err := session.setBinary(ctx); err != nil {
+		session.abandon(err)
+		return nil, err
+	}
+	return session, nil
+}
+
+// AttachSession takes over a session from the WebSocket it was opened on,
+// typically one that is detached, and replays its scrollback
+func (c *Conn) AttachSession(ctx context.Context, id string) (*Session, error) {
+	return c.attach(ctx, newSession(c, id, roleOwner))
+}
+
+// JoinSession attaches to a session alongside its owner, as ws.ModeWriter
+// with input access or as a read-only ws.ModeObserver, and replays its
+// scrollback
+func (c *Conn) JoinSession(ctx context.Context, id, mode string) (*Session, error) {
+	if mode == "" {
+		mode = ws.ModeObserver
+	}
+	return c.attach(ctx, newSession(c, id, mode))
+}
+
+// attach registers a session and attaches it on the backend
+func (c *Conn) attach(ctx context.Context, session *Session) (*Session, error) {
+	if session.ID == "" {
+		return nil, &ws.ParamError{Field: "session_id", Reason: "is required"}
+	}
+
+	// Registered first, since the replay arrives before the reply
+	if err := c.addSession(session); err != nil {
+		return nil, err
+	}
+	if err := session.reattach(ctx); err != nil {
+		session.abandon(err)
+		return nil, err
+	}
+	return session, nil
+}
+
+// reattach attaches the session on the current WebSocket, replaying the
+// output after what was already received
+func (s *Session) reattach(ctx context.Context) error {
+	s.mu.Lock()
+	role, offset := s.role, s.offset
+	s.mu.Unlock()
+
+	var err error
+	if role == roleOwner {
+		_, err = s.conn.roundTrip(ctx, s.ID, ws.ActionAttachSession, ws.AttachSessionParams{Offset: offset})
+	} else {
+		_, err = s.conn.roundTrip(ctx, s.ID, ws.ActionJoinSession, ws.JoinSessionParams{Mode: role, Offset: offset})
+	}
+	if err != nil {
+		return err
+	}
+	return s.setBinary(ctx)
+}
+
+// setBinary switches the session's output to binary frames
+func (s *Session) setBinary(ctx context.Context) error {
+	_, err := s.conn.roundTrip(ctx, s.ID, ws.ActionSetEncoding, ws.SetEncodingParams{Encoding: ws.EncodingBinary})
+	return err
+}
+
+// abandon unregisters a session that failed to open
+func (s *Session) abandon(err error) {
+	s.conn.removeSession(s)
+	s.finish(err)
+}
+
+// SetStatusHandler sets the function called with the session's status
+// messages, e.g. connection state changes and subscribers joining
+func (s *Session) SetStatusHandler(handler StatusHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onStatus = handler
+}
+
+// SetPromptHandler sets the function answering keyboard-interactive
+// challenges. Without one, challenges are cancelled.
+func (s *Session) SetPromptHandler(handler PromptHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onPrompt = handler
+}
+
+// Read reads output of the session's connection. It returns io.EOF once the
+// session has ended and its output is drained; Err tells why it ended.
+func (s *Session) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.buf) == 0 && s.err == nil {
+		s.cond.Wait()
+	}
+	if len(s.buf) == 0 {
+		return 0, io.EOF
+	}
+
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
+
+// Write sends input to the session's connection
+func (s *Session) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	role, err := s.role, s.err
+	s.mu.Unlock()
+
+	if err != nil {
+		return 0, err
+	}
+	if role == ws.ModeObserver {
+		return 0, ErrReadOnly
+	}
+
+	written := 0
+	for written < len(p) {
+		n := min(len(p)-written, maxWriteChunk)
+		frame, err := ws.BinaryFrame{
+			Type:      ws.FrameTypeData,
+			SessionID: s.ID,
+			Payload:   p[written : written+n],
+		}.MarshalBinary()
+		if err != nil {
+			return written, err
+		}
+		if err := s.conn.sendFrame(websocket.BinaryMessage, frame); err != nil {
+			return written, err
+		}
+		written += n
+	}
+	return written, nil
+}
+
+// Offset returns the number of output bytes the backend has sent on the
+// session, including replayed output
+func (s *Session) Offset() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.offset
+}
+
+// Done is closed when the session ends
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns why the session ended, once it has
+func (s *Session) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// output buffers received output
+func (s *Session) output(data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.offset += int64(len(data))
+	s.buf = append(s.buf, data...)
+	if excess := len(s.buf) - maxBuffered; excess > 0 {
+		s.buf = s.buf[excess:]
+	}
+	s.cond.Broadcast()
+}
+
+// status handles a status message of the session
+func (s *Session) status(payload ws.StatusPayload) {
+	switch payload.State {
+	case "attached", "resync":
+		// The replay that follows starts here
+		s.mu.Lock()
+		s.offset = payload.Offset
+		s.mu.Unlock()
+	case "closed":
+		s.conn.removeSession(s)
+		s.finish(ErrSessionClosed)
+	case "detached":
+		s.conn.removeSession(s)
+		s.finish(ErrDetached)
+	}
+
+	s.mu.Lock()
+	handler := s.onStatus
+	s.mu.Unlock()
+	if handler != nil {
+		handler(payload)
+	}
+}
+
+// prompt answers a keyboard-interactive challenge
+func (s *Session) prompt(payload ws.AuthPromptPayload) {
+	s.mu.Lock()
+	handler := s.onPrompt
+	s.mu.Unlock()
+
+	resp := ws.AuthResponsePayload{PromptID: payload.PromptID, Cancel: true}
+	if handler != nil {
+		if answers, err := handler(payload); err == nil {
+			resp = ws.AuthResponsePayload{PromptID: payload.PromptID, Answers: answers}
+		}
+	}
+	s.conn.send(newMessage(ws.MsgTypeAuthResponse, s.ID, "", resp))
+}
+
+// finish ends the session
+func (s *Session) finish(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return
+	}
+	s.err = err
+	s.cond.Broadcast()
+	close(s.done)
+}
+
+// Connect opens a serial port on the session
+func (s *Session) Connect(ctx context.Context, params ws.ConnectParams) error {
+	_, err := s.conn.roundTrip(ctx, s.ID, ws.ActionConnect, params)
+	return err
+}
+
+// ConnectSSH opens an SSH connection on the session. Keyboard-interactive
+// challenges go to the prompt handler.
+func (s *Session) ConnectSSH(ctx context.Context, params ws.ConnectSSHParams) error {
+	_, err := s.conn.roundTrip(ctx, s.ID, ws.ActionConnectSSH, params)
+	return err
+}
+
+// AttachSSH attaches an SSH session opened over REST to the session
+func (s *Session) AttachSSH(ctx context.Context, params ws.AttachSSHParams) error {
+	_, err := s.conn.roundTrip(ctx, s.ID, ws.ActionAttachSSH, params)
+	return err
+}
+
+// DuplicateSSH opens another shell on the connection of an SSH session
+func (s *Session) DuplicateSSH(ctx context.Context, params ws.DuplicateSSHParams) error {
+	_, err := s.conn.roundTrip(ctx, s.ID, ws.ActionDuplicateSSH, params)
+	return err
+}
+
+// StartLog starts logging the session's output on the backend, replacing a
+// log already running
+func (s *Session) StartLog(ctx context.Context, params ws.StartLogParams) error {
+	if err := params.Validate(); err != nil {
+		return err
+	}
+	_, err := s.conn.roundTrip(ctx, s.ID, ws.ActionStartLog, params)
+	return err
+}
+
+// StopLog stops logging the session's output
+func (s *Session) StopLog(ctx context.Context) error {
+	_, err := s.conn.roundTrip(ctx, s.ID, ws.ActionStopLog, nil)
+	return err
+}
+
+// Disconnect closes the session's serial or SSH connection, keeping the
+// session open
+func (s *Session) Disconnect(ctx context.Context) error {
+	_, err := s.conn.roundTrip(ctx, s.ID, ws.ActionDisconnect, nil)
+	return err
+}
+
+// Resize sets the terminal size of the session's SSH connection. It doesn't
+// wait for the backend, which only replies when resizing fails.
+func (s *Session) Resize(cols, rows int) error {
+	params := ws.ResizeParams{Cols: cols, Rows: rows}
+	if err := params.Validate(); err != nil {
+		return err
+	}
+	return s.conn.send(newMessage(ws.MsgTypeControl, s.ID, "", newControl(ws.ActionResize, params)))
+}
+
+// Exec runs a command without a PTY on an SSH connection, streaming its
+// output to stdout and stderr. Without a timeout in params, the context's
+// deadline is used. The backend sends at most 1 MiB of each stream.
+func (s *Session) Exec(ctx context.Context, params ws.ExecSSHParams, stdout, stderr io.Writer) (*ExitStatus, error) {
+	if params.Timeout == 0 {
+		if deadline, ok := ctx.Deadline(); ok {
+			params.Timeout = int(math.Ceil(time.Until(deadline).Seconds()))
+		}
+	}
+
+	call, err := s.conn.start(s.ID, ws.ActionExecSSH, params)
+	if err != nil {
+		return nil, err
+	}
+	defer s.conn.finish(call)
+
+	for {
+		msg, err := s.conn.wait(ctx, call)
+		if err != nil {
+			return nil, err
+		}
+		if msg.Type != ws.MsgTypeExec {
+			continue
+		}
+
+		var payload ws.ExecPayload
+		if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+			return nil, fmt.Errorf("invalid exec message: %w", err)
+		}
+		if payload.Done {
+			if payload.Error != "" {
+				return nil, errors.New(payload.Error)
+			}
+			status := &ExitStatus{Signal: payload.ExitSignal}
+			if payload.ExitCode != nil {
+				status.Code = *payload.ExitCode
+			}
+			return status, nil
+		}
+
+		data, err := base64.StdEncoding.DecodeString(payload.Data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exec output: %w", err)
+		}
+		w := stdout
+		if payload.Stream == "stderr" {
+			w = stderr
+		}
+		if w != nil {
+			w.Write(data)
+		}
+	}
+}
+
+// SendFile sends a file over the session's serial port with XMODEM or
+// YMODEM. An empty protocol uses XMODEM-CRC. Progress is optional.
+func (s *Session) SendFile(ctx context.Context, name string, data []byte, protocol string, progress func(ws.FileTransferPayload)) error {
+	params := ws.SendFileParams{
+		Data:     base64.StdEncoding.EncodeToString(data),
+		FileName: name,
+		Protocol: protocol,
+	}
+	_, err := s.transfer(ctx, ws.ActionSendFile, params, progress)
+	return err
+}
+
+// ReceiveFile receives a file over the session's serial port with XMODEM.
+// An empty protocol uses XMODEM-CRC. Progress is optional.
+func (s *Session) ReceiveFile(ctx context.Context, name, protocol string, progress func(ws.FileTransferPayload)) ([]byte, error) {
+	params := ws.ReceiveFileParams{
+		FileName: name,
+		Protocol: protocol,
+	}
+	result, err := s.transfer(ctx, ws.ActionReceiveFile, params, progress)
+	if err != nil {
+		return nil, err
+	}
+
+	// The received data comes in the message of the completion
+	data, err := base64.StdEncoding.DecodeString(result.Message)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file data: %w", err)
+	}
+	return data, nil
+}
+
+// transfer runs a file transfer until it completes or fails
+func (s *Session) transfer(ctx context.Context, action string, params interface{}, progress func(ws.FileTransferPayload)) (*ws.FileTransferPayload, error) {
+	call, err := s.conn.start(s.ID, action, params)
+	if err != nil {
+		return nil, err
+	}
+	defer s.conn.finish(call)
+
+	for {
+		msg, err := s.conn.wait(ctx, call)
+		if err != nil {
+			return nil, err
+		}
+		if msg.Type != ws.MsgTypeFileTransfer {
+			continue
+		}
+
+		var payload ws.FileTransferPayload
+		if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+			return nil, fmt.Errorf("invalid file transfer message: %w", err)
+		}
+		switch payload.Action {
+		case "complete":
+			return &payload, nil
+		case "error":
+			return nil, fmt.Errorf("file transfer failed: %s", payload.Error)
+		}
+		if progress != nil {
+			progress(payload)
+		}
+	}
+}
+
+// Close closes the session. Its owner closes it for every subscriber, while
+// writers and observers just leave it.
+func (s *Session) Close(ctx context.Context) error {
+	select {
+	case <-s.done:
+		return nil
+	default:
+	}
+
+	call, err := s.conn.start(s.ID, ws.ActionCloseSession, nil)
+	if err != nil {
+		return err
+	}
+	defer s.conn.finish(call)
+
+	for {
+		select {
+		case <-s.done:
+			return nil
+		case msg := <-call.replies:
+			if msg.Type == ws.MsgTypeError {
+				return replyError(msg)
+			}
+		case <-call.lost:
+			return ErrDisconnected
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
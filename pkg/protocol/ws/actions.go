@@ -0,0 +1,50 @@
+package ws
+
+// Control actions, sent as the action of a ControlPayload
+const (
+	// Sessions
+	ActionOpenSession   = "open_session"
+	ActionAttachSession = "attach_session"
+	ActionJoinSession   = "join_session"
+	ActionCloseSession  = "close_session"
+
+	// Connections
+	ActionConnect      = "connect"
+	ActionConnectSSH   = "connect_ssh"
+	ActionAttachSSH    = "attach_ssh"
+	ActionDuplicateSSH = "duplicate_ssh"
+	ActionDisconnect   = "disconnect"
+
+	// Terminal
+	ActionResize      = "resize"
+	ActionSetEncoding = "set_encoding"
+	ActionExecSSH     = "exec_ssh"
+
+	// File transfer
+	ActionSendFile    = "send_file"
+	ActionReceiveFile = "receive_file"
+
+	// Logging
+	ActionStartLog = "start_log"
+	ActionStopLog  = "stop_log"
+)
+
+// ControlActions lists the control actions of the current protocol version
+var ControlActions = []string{
+	ActionOpenSession,
+	ActionAttachSession,
+	ActionJoinSession,
+	ActionCloseSession,
+	ActionConnect,
+	ActionConnectSSH,
+	ActionAttachSSH,
+	ActionDuplicateSSH,
+	ActionDisconnect,
+	ActionResize,
+	ActionSetEncoding,
+	ActionExecSSH,
+	ActionSendFile,
+	ActionReceiveFile,
+	ActionStartLog,
+	ActionStopLog,
+}
@@ -0,0 +1,61 @@
+package ws
+
+import "fmt"
+
+// Encodings negotiated with the "set_encoding" control action
+const (
+	EncodingJSON   = "json"   // Data as base64 inside JSON text frames (default)
+	EncodingBinary = "binary" // Data as binary frames, everything else as JSON
+)
+
+// FrameType identifies the content of a binary frame
+type FrameType byte
+
+const (
+	FrameTypeData FrameType = 0x01 // Terminal data, in either direction
+)
+
+// maxSessionIDLen is the longest session ID a binary frame header can carry
+const maxSessionIDLen = 255
+
+// BinaryFrame carries terminal data without JSON and base64 overhead:
+//
+//	+------+--------+------------+---------+
+//	| type | id len | session ID | payload |
+//	+------+--------+------------+---------+
+//	  1 B     1 B     id len B     rest
+type BinaryFrame struct {
+	Type      FrameType
+	SessionID string
+	Payload   []byte
+}
+
+// MarshalBinary encodes the frame
+func (f BinaryFrame) MarshalBinary() ([]byte, error) {
+	if len(f.SessionID) > maxSessionIDLen {
+		return nil, fmt.Errorf("session ID too long: %d bytes", len(f.SessionID))
+	}
+
+	data := make([]byte, 0, 2+len(f.SessionID)+len(f.Payload))
+	data = append(data, byte(f.Type), byte(len(f.SessionID)))
+	data = append(data, f.SessionID...)
+	data = append(data, f.Payload...)
+	return data, nil
+}
+
+// UnmarshalBinary decodes a frame. The payload aliases data.
+func (f *BinaryFrame) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 {
+		return fmt.Errorf("binary frame too short: %d bytes", len(data))
+	}
+
+	idLen := int(data[1])
+	if len(data) < 2+idLen {
+		return fmt.Errorf("binary frame truncated: session ID needs %d bytes, %d left", idLen, len(data)-2)
+	}
+
+	f.Type = FrameType(data[0])
+	f.SessionID = string(data[2 : 2+idLen])
+	f.Payload = data[2+idLen:]
+	return nil
+}
@@ -0,0 +1,81 @@
+package ws
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestBinaryFrameRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame BinaryFrame
+		want  []byte
+	}{
+		{
+			name:  "data",
+			frame: BinaryFrame{Type: FrameTypeData, SessionID: "abc", Payload: []byte("hi\r\n")},
+			want:  []byte{0x01, 3, 'a', 'b', 'c', 'h', 'i', '\r', '\n'},
+		},
+		{
+			name:  "empty session ID",
+			frame: BinaryFrame{Type: FrameTypeData, Payload: []byte{0x00, 0xff}},
+			want:  []byte{0x01, 0, 0x00, 0xff},
+		},
+		{
+			name:  "empty payload",
+			frame: BinaryFrame{Type: FrameTypeData, SessionID: "s"},
+			want:  []byte{0x01, 1, 's'},
+		},
+		{
+			name:  "longest session ID",
+			frame: BinaryFrame{Type: FrameTypeData, SessionID: strings.Repeat("x", maxSessionIDLen), Payload: []byte("p")},
+			want:  append(append([]byte{0x01, 255}, strings.Repeat("x", maxSessionIDLen)...), 'p'),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.frame.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, tt.want) {
+				t.Fatalf("MarshalBinary() = %x, want %x", data, tt.want)
+			}
+
+			var got BinaryFrame
+			if err := got.UnmarshalBinary(data); err != nil {
+				t.Fatal(err)
+			}
+			if got.Type != tt.frame.Type || got.SessionID != tt.frame.SessionID || !bytes.Equal(got.Payload, tt.frame.Payload) {
+				t.Errorf("UnmarshalBinary() = %+v, want %+v", got, tt.frame)
+			}
+		})
+	}
+}
+
+func TestBinaryFrameMarshalSessionIDTooLong(t *testing.T) {
+	frame := BinaryFrame{Type: FrameTypeData, SessionID: strings.Repeat("x", maxSessionIDLen+1)}
+	if _, err := frame.MarshalBinary(); err == nil {
+		t.Error("expected an error for a session ID over 255 bytes")
+	}
+}
+
+func TestBinaryFrameUnmarshalInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"type only", []byte{0x01}},
+		{"truncated session ID", []byte{0x01, 4, 'a', 'b'}},
+	}
+
+	for _, tt := range tests {
+		var frame BinaryFrame
+		if err := frame.UnmarshalBinary(tt.data); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
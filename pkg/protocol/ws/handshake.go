@@ -0,0 +1,110 @@
+package ws
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Protocol versions
+const (
+	ProtocolVersion    = 1 // Version spoken by this package
+	MinProtocolVersion = 1 // Oldest version still accepted from a peer
+)
+
+// Transports a session can connect through
+const (
+	TransportSerial = "serial"
+	TransportSSH    = "ssh"
+)
+
+// File transfer protocols, selected with the "protocol" param of send_file
+// and receive_file
+const (
+	FileProtocolXMODEM   = "xmodem"   // 128-byte blocks with checksum
+	FileProtocolXMODEM1K = "xmodem1k" // 1K blocks with CRC
+	FileProtocolYMODEM   = "ymodem"   // 1K blocks with CRC
+)
+
+// Session log formats, selected with the "format" param of start_log
+const (
+	LogFormatPlain       = "plain"       // Output as received
+	LogFormatTimestamped = "timestamped" // Each line prefixed with its arrival time
+	LogFormatHex         = "hex"         // Hex dump with offsets and arrival times
+)
+
+// Error codes for requests outside the negotiated capabilities
+const (
+	ErrCodeUnsupportedVersion   = "UNSUPPORTED_VERSION"
+	ErrCodeUnsupportedAction    = "UNSUPPORTED_ACTION"
+	ErrCodeUnsupportedEncoding  = "UNSUPPORTED_ENCODING"
+	ErrCodeUnsupportedProtocol  = "UNSUPPORTED_PROTOCOL"
+	ErrCodeUnsupportedLogFormat = "UNSUPPORTED_LOG_FORMAT"
+)
+
+// HelloPayload opens the handshake. The server sends one as the first
+// message on a WebSocket; the client answers with its own, and the server
+// confirms the negotiated version with a "negotiated" status. From then on
+// only the capabilities both hellos list are used, see Intersect; a client
+// that never says hello gets everything the server supports.
+type HelloPayload struct {
+	Version       int      `json:"version"`
+	MinVersion    int      `json:"min_version,omitempty"` // Oldest version the sender accepts
+	Software      string   `json:"software,omitempty"`    // Name and version of the sender
+	Transports    []string `json:"transports,omitempty"`
+	FileTransfers []string `json:"file_transfers,omitempty"`
+	Encodings     []string `json:"encodings,omitempty"`
+	LogFormats    []string `json:"log_formats,omitempty"`
+	Actions       []string `json:"actions,omitempty"` // Control actions
+}
+
+// NewHello returns the hello describing everything this package supports
+func NewHello(software string) HelloPayload {
+	return HelloPayload{
+		Version:       ProtocolVersion,
+		MinVersion:    MinProtocolVersion,
+		Software:      software,
+		Transports:    []string{TransportSerial, TransportSSH},
+		FileTransfers: []string{FileProtocolXMODEM, FileProtocolXMODEM1K, FileProtocolYMODEM},
+		Encodings:     []string{EncodingJSON, EncodingBinary},
+		LogFormats:    []string{LogFormatPlain, LogFormatTimestamped, LogFormatHex},
+		Actions:       ControlActions,
+	}
+}
+
+// Intersect returns the capabilities listed by both h and peer, in the order
+// of h, at the lower of the two versions
+func (h HelloPayload) Intersect(peer HelloPayload) HelloPayload {
+	return HelloPayload{
+		Version:       min(h.Version, peer.Version),
+		MinVersion:    max(h.MinVersion, peer.MinVersion),
+		Software:      h.Software,
+		Transports:    intersect(h.Transports, peer.Transports),
+		FileTransfers: intersect(h.FileTransfers, peer.FileTransfers),
+		Encodings:     intersect(h.Encodings, peer.Encodings),
+		LogFormats:    intersect(h.LogFormats, peer.LogFormats),
+		Actions:       intersect(h.Actions, peer.Actions),
+	}
+}
+
+// intersect returns the values of a that b contains as well
+func intersect(a, b []string) []string {
+	var common []string
+	for _, value := range a {
+		if slices.Contains(b, value) {
+			common = append(common, value)
+		}
+	}
+	return common
+}
+
+// Negotiate returns the highest protocol version both this package and the
+// peer support
+func Negotiate(peer HelloPayload) (int, error) {
+	if peer.Version < MinProtocolVersion {
+		return 0, fmt.Errorf("protocol version %d is no longer supported, need at least %d", peer.Version, MinProtocolVersion)
+	}
+	if peer.MinVersion > ProtocolVersion {
+		return 0, fmt.Errorf("peer needs protocol version %d or later, have %d", peer.MinVersion, ProtocolVersion)
+	}
+	return min(peer.Version, ProtocolVersion), nil
+}
@@ -0,0 +1,31 @@
+package ws
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIntersect(t *testing.T) {
+	server := NewHello("server")
+	client := HelloPayload{
+		Version:    ProtocolVersion + 1,
+		MinVersion: MinProtocolVersion,
+		Encodings:  []string{"cbor", EncodingJSON},
+		Actions:    []string{ActionStopLog, ActionConnect},
+	}
+
+	got := server.Intersect(client)
+	if got.Version != ProtocolVersion || got.Software != "server" {
+		t.Errorf("version %d of %q, want %d of the server", got.Version, got.Software, ProtocolVersion)
+	}
+	if want := []string{EncodingJSON}; !reflect.DeepEqual(got.Encodings, want) {
+		t.Errorf("encodings = %q, want %q", got.Encodings, want)
+	}
+	// In the server's order
+	if want := []string{ActionConnect, ActionStopLog}; !reflect.DeepEqual(got.Actions, want) {
+		t.Errorf("actions = %q, want %q", got.Actions, want)
+	}
+	if len(got.Transports) != 0 || len(got.FileTransfers) != 0 || len(got.LogFormats) != 0 {
+		t.Errorf("capabilities the client didn't list were kept: %+v", got)
+	}
+}
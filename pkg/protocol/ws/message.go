@@ -11,12 +11,17 @@ const (
 	MsgTypeStatus       MessageType = "status"
 	MsgTypeError        MessageType = "error"
 	MsgTypeFileTransfer MessageType = "file_transfer"
+	MsgTypeAuthPrompt   MessageType = "auth_prompt"
+	MsgTypeAuthResponse MessageType = "auth_response"
+	MsgTypeExec         MessageType = "exec"
+	MsgTypeHello        MessageType = "hello"
 )
 
 // Message represents a WebSocket message
 type Message struct {
 	Type      MessageType     `json:"type"`
 	SessionID string          `json:"session_id,omitempty"`
+	RequestID string          `json:"request_id,omitempty"` // Set by the client; echoed in the replies
 	Payload   json.RawMessage `json:"payload"`
 	Timestamp int64           `json:"timestamp"`
 }
@@ -27,22 +32,38 @@ type DataPayload struct {
 	Encoding string `json:"encoding"` // "raw" | "base64"
 }
 
-// ControlPayload represents a control command
+// ControlPayload represents a control command. Params hold the *Params
+// struct of the action and are read with DecodeParams.
 type ControlPayload struct {
-	Action string                 `json:"action"` // "connect" | "disconnect" | "resize"
-	Params map[string]interface{} `json:"params,omitempty"`
+	Action string          `json:"action"` // One of ControlActions
+	Params json.RawMessage `json:"params,omitempty"`
 }
 
 // StatusPayload represents status information
 type StatusPayload struct {
 	State   string `json:"state"`
 	Message string `json:"message,omitempty"`
+	Reason  string `json:"reason,omitempty"` // Why a connection was lost
+	Offset  int64  `json:"offset,omitempty"` // Output offset a session's replay starts at
+
+	// Who joined or left a shared session
+	Subscriber string `json:"subscriber,omitempty"` // WebSocket ID
+	Role       string `json:"role,omitempty"`       // "owner" | "writer" | "observer"
+
+	// How a remote process ended, when it did
+	ExitCode   *int   `json:"exit_code,omitempty"`
+	ExitSignal string `json:"exit_signal,omitempty"`
 }
 
 // ErrorPayload represents an error
 type ErrorPayload struct {
 	Code    string `json:"code"`
 	Message string `json:"message"`
+	Action  string `json:"action,omitempty"` // Control action that failed
+	Field   string `json:"field,omitempty"`  // Param that failed validation
+
+	// Set when a request was outside the negotiated capabilities
+	Supported []string `json:"supported,omitempty"` // Values that would have been accepted
 }
 
 // FileTransferPayload represents file transfer progress/status
@@ -55,3 +76,37 @@ type FileTransferPayload struct {
 	Message  string `json:"message,omitempty"`
 	Error    string `json:"error,omitempty"`
 }
+
+// AuthPromptPayload represents a keyboard-interactive challenge sent to the client
+type AuthPromptPayload struct {
+	PromptID    string               `json:"prompt_id"`
+	User        string               `json:"user,omitempty"`
+	Instruction string               `json:"instruction,omitempty"`
+	Questions   []AuthPromptQuestion `json:"questions"`
+	Timeout     int                  `json:"timeout"` // Seconds until the prompt expires
+}
+
+// AuthPromptQuestion represents a single keyboard-interactive question
+type AuthPromptQuestion struct {
+	Prompt string `json:"prompt"`
+	Echo   bool   `json:"echo"` // Whether the answer may be displayed while typing
+}
+
+// AuthResponsePayload represents the client's answers to an auth prompt
+type AuthResponsePayload struct {
+	PromptID string   `json:"prompt_id"`
+	Answers  []string `json:"answers"`
+	Cancel   bool     `json:"cancel,omitempty"`
+}
+
+// ExecPayload streams the output and result of a non-interactive command
+type ExecPayload struct {
+	ExecID     string `json:"exec_id"`
+	Stream     string `json:"stream,omitempty"` // "stdout" | "stderr"
+	Data       string `json:"data,omitempty"`   // Base64 encoded
+	Done       bool   `json:"done,omitempty"`   // Set on the final message
+	ExitCode   *int   `json:"exit_code,omitempty"`
+	ExitSignal string `json:"exit_signal,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Truncated  bool   `json:"truncated,omitempty"` // Output exceeded 1 MiB per stream and was cut off
+}
@@ -0,0 +1,430 @@
+package ws
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// ErrCodeInvalidParams is sent when control params fail to decode or validate
+const ErrCodeInvalidParams = "INVALID_PARAMS"
+
+// Join modes, sent as the "mode" param of join_session
+const (
+	ModeWriter   = "writer"   // Input access
+	ModeObserver = "observer" // Read-only
+)
+
+// ParamError reports a control param that failed to decode or validate
+type ParamError struct {
+	Field  string // JSON path of the param, e.g. "jump_hosts.0.port"
+	Reason string
+}
+
+func (e *ParamError) Error() string {
+	if e.Field == "" {
+		return e.Reason
+	}
+	return e.Field + ": " + e.Reason
+}
+
+// Validator is implemented by params that check their own values
+type Validator interface {
+	Validate() error
+}
+
+// DecodeParams unmarshals the params of a control message into v and
+// validates them. Unknown params are rejected so misspelled ones aren't
+// silently ignored. Errors are *ParamError.
+func DecodeParams(raw json.RawMessage, v interface{}) error {
+	if len(raw) > 0 && string(raw) != "null" {
+		if err := decodeStrict(raw, v); err != nil {
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) {
+				return &ParamError{Field: typeErr.Field, Reason: "must be " + kindName(typeErr.Type)}
+			}
+			// encoding/json reports unknown fields only by message
+			if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+				return &ParamError{Field: strings.Trim(field, `"`), Reason: "is not a known param"}
+			}
+			return &ParamError{Reason: "invalid params: " + err.Error()}
+		}
+	}
+
+	if validator, ok := v.(Validator); ok {
+		return validator.Validate()
+	}
+	return nil
+}
+
+// decodeStrict unmarshals a single JSON value, failing on unknown fields
+func decodeStrict(raw json.RawMessage, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("unexpected data after params")
+	}
+	return nil
+}
+
+// kindName describes the JSON value expected for a Go type
+func kindName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	}
+	return "a " + t.String()
+}
+
+// Param validation helpers
+
+func required(field, value string) error {
+	if value == "" {
+		return &ParamError{Field: field, Reason: "is required"}
+	}
+	return nil
+}
+
+func positive(field string, value int) error {
+	if value <= 0 {
+		return &ParamError{Field: field, Reason: "must be positive"}
+	}
+	return nil
+}
+
+func nonNegative(field string, value int) error {
+	if value < 0 {
+		return &ParamError{Field: field, Reason: "must not be negative"}
+	}
+	return nil
+}
+
+func oneOf(field, value string, allowed ...string) error {
+	if value != "" && !slices.Contains(allowed, value) {
+		return &ParamError{Field: field, Reason: "must be one of " + strings.Join(allowed, ", ")}
+	}
+	return nil
+}
+
+// nested prefixes the field of a ParamError with the path of its parent
+func nested(prefix string, err error) error {
+	var paramErr *ParamError
+	if errors.As(err, &paramErr) {
+		return &ParamError{Field: prefix + "." + paramErr.Field, Reason: paramErr.Reason}
+	}
+	return err
+}
+
+// firstError returns the first non-nil error
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DetachParams set how long a session outlives its last WebSocket
+type DetachParams struct {
+	DetachGrace *int `json:"detach_grace,omitempty"` // Seconds; 0 closes the connection right away
+}
+
+func (p DetachParams) validate() error {
+	if p.DetachGrace != nil {
+		return nonNegative("detach_grace", *p.DetachGrace)
+	}
+	return nil
+}
+
+// AttachSessionParams are the params of attach_session
+type AttachSessionParams struct {
+	Offset int64 `json:"offset,omitempty"` // Output offset to replay from
+}
+
+// Validate implements Validator
+func (p AttachSessionParams) Validate() error {
+	if p.Offset < 0 {
+		return &ParamError{Field: "offset", Reason: "must not be negative"}
+	}
+	return nil
+}
+
+// JoinSessionParams are the params of join_session
+type JoinSessionParams struct {
+	Mode   string `json:"mode,omitempty"`   // ModeWriter or ModeObserver (default)
+	Offset int64  `json:"offset,omitempty"` // Output offset to replay from
+}
+
+// Validate implements Validator
+func (p JoinSessionParams) Validate() error {
+	return firstError(
+		oneOf("mode", p.Mode, ModeWriter, ModeObserver),
+		AttachSessionParams{Offset: p.Offset}.Validate(),
+	)
+}
+
+// ConnectParams are the params of connect, opening a serial port
+type ConnectParams struct {
+	Port        string  `json:"port"`
+	BaudRate    int     `json:"baud_rate,omitempty"`    // Default: 115200
+	DataBits    int     `json:"data_bits,omitempty"`    // 5 to 8, default: 8
+	StopBits    float64 `json:"stop_bits,omitempty"`    // 1, 1.5 or 2, default: 1
+	Parity      string  `json:"parity,omitempty"`       // Default: none
+	FlowControl string  `json:"flow_control,omitempty"` // Only "none" is supported
+	DetachParams
+}
+
+// Validate implements Validator
+func (p ConnectParams) Validate() error {
+	if err := firstError(
+		required("port", p.Port),
+		nonNegative("baud_rate", p.BaudRate),
+		oneOf("parity", p.Parity, "none", "odd", "even", "mark", "space"),
+		oneOf("flow_control", p.FlowControl, "none"),
+		p.DetachParams.validate(),
+	); err != nil {
+		return err
+	}
+	if p.DataBits != 0 && (p.DataBits < 5 || p.DataBits > 8) {
+		return &ParamError{Field: "data_bits", Reason: "must be between 5 and 8"}
+	}
+	if p.StopBits != 0 && p.StopBits != 1 && p.StopBits != 1.5 && p.StopBits != 2 {
+		return &ParamError{Field: "stop_bits", Reason: "must be 1, 1.5 or 2"}
+	}
+	return nil
+}
+
+// ConnectSSHParams are the params of connect_ssh. Jump hosts take the same
+// fields; their terminal and reconnect settings are ignored. Keys and
+// certificates are passed inline: files and agent sockets on the backend's
+// machine are only used through the host_alias settings of its ~/.ssh/config.
+type ConnectSSHParams struct {
+	HostAlias string `json:"host_alias,omitempty"` // Host from ~/.ssh/config
+
+	Host        string   `json:"host,omitempty"`
+	Port        int      `json:"port,omitempty"`
+	Username    string   `json:"username,omitempty"`
+	AuthMethod  string   `json:"auth_method,omitempty"`
+	AuthMethods []string `json:"auth_methods,omitempty"` // Tried in order
+
+	Password             string `json:"password,omitempty"`
+	PrivateKey           string `json:"private_key,omitempty"`
+	PrivateKeyPassphrase string `json:"private_key_passphrase,omitempty"`
+	ForwardAgent         bool   `json:"forward_agent,omitempty"`
+	Certificate          string `json:"certificate,omitempty"`
+
+	HostCertAuthorities []string `json:"host_cert_authorities,omitempty"`
+
+	JumpHosts []ConnectSSHParams `json:"jump_hosts,omitempty"` // Dialed in order before the target
+	Forwards  []ForwardParams    `json:"forwards,omitempty"`
+
+	Ciphers           []string `json:"ciphers,omitempty"`
+	KeyExchanges      []string `json:"key_exchanges,omitempty"`
+	MACs              []string `json:"macs,omitempty"`
+	HostKeyAlgorithms []string `json:"host_key_algorithms,omitempty"`
+
+	TerminalType  string            `json:"terminal_type,omitempty"`
+	TerminalModes map[string]uint32 `json:"terminal_modes,omitempty"`
+	Env           map[string]string `json:"env,omitempty"`
+	Cols          int               `json:"cols,omitempty"`
+	Rows          int               `json:"rows,omitempty"`
+
+	KeepaliveInterval    int  `json:"keepalive_interval,omitempty"` // Seconds
+	KeepaliveCountMax    int  `json:"keepalive_count_max,omitempty"`
+	AutoReconnect        bool `json:"auto_reconnect,omitempty"`
+	ReconnectMaxAttempts int  `json:"reconnect_max_attempts,omitempty"`
+	ReconnectMaxDelay    int  `json:"reconnect_max_delay,omitempty"` // Seconds
+
+	DetachParams
+}
+
+var authMethods = []string{"password", "publickey", "keyboard-interactive", "agent"}
+
+// Validate implements Validator
+func (p ConnectSSHParams) Validate() error {
+	if p.Host == "" && p.HostAlias == "" {
+		return &ParamError{Field: "host", Reason: "host or host_alias is required"}
+	}
+	if p.Port < 0 || p.Port > 65535 {
+		return &ParamError{Field: "port", Reason: "must be a port number"}
+	}
+	if err := firstError(
+		oneOf("auth_method", p.AuthMethod, authMethods...),
+		nonNegative("cols", p.Cols),
+		nonNegative("rows", p.Rows),
+		nonNegative("keepalive_interval", p.KeepaliveInterval),
+		nonNegative("keepalive_count_max", p.KeepaliveCountMax),
+		nonNegative("reconnect_max_attempts", p.ReconnectMaxAttempts),
+		nonNegative("reconnect_max_delay", p.ReconnectMaxDelay),
+		p.DetachParams.validate(),
+	); err != nil {
+		return err
+	}
+	for i, method := range p.AuthMethods {
+		if err := oneOf(fmt.Sprintf("auth_methods.%d", i), method, authMethods...); err != nil {
+			return err
+		}
+	}
+	// Agent and publickey keys are offered together
+	agent, publicKey := slices.Index(p.AuthMethods, "agent"), slices.Index(p.AuthMethods, "publickey")
+	if agent >= 0 && publicKey >= 0 && agent-publicKey != 1 && publicKey-agent != 1 {
+		return &ParamError{Field: "auth_methods", Reason: "agent and publickey must be adjacent"}
+	}
+	for i, forward := range p.Forwards {
+		if err := forward.Validate(); err != nil {
+			return nested(fmt.Sprintf("forwards.%d", i), err)
+		}
+	}
+	for i, jump := range p.JumpHosts {
+		if err := jump.Validate(); err != nil {
+			return nested(fmt.Sprintf("jump_hosts.%d", i), err)
+		}
+	}
+	return nil
+}
+
+// ForwardParams describe a port forward opened with an SSH connection
+type ForwardParams struct {
+	ID         string `json:"id,omitempty"`
+	Type       string `json:"type"`                  // "local" | "remote" | "dynamic"
+	ListenAddr string `json:"listen_addr"`           // e.g. "127.0.0.1:8080"
+	TargetAddr string `json:"target_addr,omitempty"` // Unused for dynamic forwards
+	// Dynamic forwards listen on loopback unless set, as the SOCKS proxy is
+	// unauthenticated
+	AllowPublic bool `json:"allow_public,omitempty"`
+}
+
+// Validate implements Validator
+func (p ForwardParams) Validate() error {
+	if err := firstError(
+		required("type", p.Type),
+		oneOf("type", p.Type, "local", "remote", "dynamic"),
+		required("listen_addr", p.ListenAddr),
+	); err != nil {
+		return err
+	}
+	if p.Type != "dynamic" {
+		return required("target_addr", p.TargetAddr)
+	}
+	return nil
+}
+
+// AttachSSHParams are the params of attach_ssh
+type AttachSSHParams struct {
+	SessionID string `json:"session_id"` // SSH session to attach
+	DetachParams
+}
+
+// Validate implements Validator
+func (p AttachSSHParams) Validate() error {
+	return firstError(required("session_id", p.SessionID), p.DetachParams.validate())
+}
+
+// DuplicateSSHParams are the params of duplicate_ssh
+type DuplicateSSHParams struct {
+	SessionID string `json:"session_id"` // SSH session whose connection is reused
+	Cols      int    `json:"cols,omitempty"`
+	Rows      int    `json:"rows,omitempty"`
+	DetachParams
+}
+
+// Validate implements Validator
+func (p DuplicateSSHParams) Validate() error {
+	return firstError(
+		required("session_id", p.SessionID),
+		nonNegative("cols", p.Cols),
+		nonNegative("rows", p.Rows),
+		p.DetachParams.validate(),
+	)
+}
+
+// ExecSSHParams are the params of exec_ssh
+type ExecSSHParams struct {
+	Command   string `json:"command"`
+	SessionID string `json:"session_id,omitempty"` // Default: the session's own SSH connection
+	ExecID    string `json:"exec_id,omitempty"`    // Echoed in exec messages; generated when empty
+	Timeout   int    `json:"timeout,omitempty"`    // Seconds
+}
+
+// Validate implements Validator
+func (p ExecSSHParams) Validate() error {
+	return firstError(required("command", p.Command), nonNegative("timeout", p.Timeout))
+}
+
+// ResizeParams are the params of resize
+type ResizeParams struct {
+	Cols int `json:"cols"`
+	Rows int `json:"rows"`
+}
+
+// Validate implements Validator
+func (p ResizeParams) Validate() error {
+	return firstError(positive("cols", p.Cols), positive("rows", p.Rows))
+}
+
+// SetEncodingParams are the params of set_encoding
+type SetEncodingParams struct {
+	Encoding string `json:"encoding"` // EncodingJSON or EncodingBinary
+}
+
+// SendFileParams are the params of send_file
+type SendFileParams struct {
+	Data     string `json:"data"` // Base64 encoded
+	FileName string `json:"file_name,omitempty"`
+	Protocol string `json:"protocol,omitempty"` // Default: XMODEM-CRC
+}
+
+// Validate implements Validator
+func (p SendFileParams) Validate() error {
+	return required("data", p.Data)
+}
+
+// ReceiveFileParams are the params of receive_file
+type ReceiveFileParams struct {
+	FileName string `json:"file_name,omitempty"`
+	Protocol string `json:"protocol,omitempty"` // Default: XMODEM-CRC
+}
+
+// StartLogParams are the params of start_log, and the body of
+// POST /api/v1/ws/sessions/:id/log
+type StartLogParams struct {
+	Format         string `json:"format,omitempty"`          // LogFormat*, default: plain
+	FileName       string `json:"file_name,omitempty"`       // Template relative to the log directory
+	MaxSize        *int64 `json:"max_size,omitempty"`        // Bytes per file before rotating; 0 never rotates, default: 10 MiB
+	RotateInterval int    `json:"rotate_interval,omitempty"` // Seconds per file before rotating
+	MaxFiles       *int   `json:"max_files,omitempty"`       // Files kept, oldest deleted first; 0 keeps all, default: 5
+}
+
+// Validate implements Validator
+func (p StartLogParams) Validate() error {
+	if err := nonNegative("rotate_interval", p.RotateInterval); err != nil {
+		return err
+	}
+	if p.MaxSize != nil && *p.MaxSize < 0 {
+		return &ParamError{Field: "max_size", Reason: "must not be negative"}
+	}
+	if p.MaxFiles != nil {
+		return nonNegative("max_files", *p.MaxFiles)
+	}
+	return nil
+}
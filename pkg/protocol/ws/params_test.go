@@ -0,0 +1,113 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestDecodeParams(t *testing.T) {
+	tests := []struct {
+		name   string
+		raw    string
+		params Validator
+		field  string // Field of the expected ParamError, "-" for none
+		reason string // Reason of the expected ParamError, if checked
+	}{
+		// Decoding
+		{name: "missing params are validated", raw: "", params: &ResizeParams{}, field: "cols"},
+		{name: "null params are validated", raw: "null", params: &ExecSSHParams{}, field: "command"},
+		{name: "type mismatch", raw: `{"cols":"80","rows":24}`, params: &ResizeParams{}, field: "cols", reason: "must be an integer"},
+		{name: "nested type mismatch", raw: `{"host":"h","jump_hosts":[{"port":"22"}]}`, params: &ConnectSSHParams{}, field: "jump_hosts.0.port", reason: "must be an integer"},
+		{name: "malformed JSON", raw: `{"cols":`, params: &ResizeParams{}, field: ""},
+		{name: "wrong JSON kind", raw: `[1,2]`, params: &ResizeParams{}, field: "", reason: "must be an object"},
+		{name: "unknown param", raw: `{"cols":80,"rows":24,"colour":true}`, params: &ResizeParams{}, field: "colour", reason: "is not a known param"},
+		{name: "unknown nested param", raw: `{"host":"h","jump_hosts":[{"host":"j","agent_socket":"/tmp/s"}]}`, params: &ConnectSSHParams{}, field: "agent_socket", reason: "is not a known param"},
+		{name: "trailing data", raw: `{"cols":80,"rows":24} {}`, params: &ResizeParams{}, field: ""},
+
+		// Resize
+		{name: "resize", raw: `{"cols":80,"rows":24}`, params: &ResizeParams{}, field: "-"},
+		{name: "resize zero rows", raw: `{"cols":80,"rows":0}`, params: &ResizeParams{}, field: "rows", reason: "must be positive"},
+
+		// Sessions
+		{name: "attach negative offset", raw: `{"offset":-1}`, params: &AttachSessionParams{}, field: "offset"},
+		{name: "join observer", raw: `{"mode":"observer","offset":10}`, params: &JoinSessionParams{}, field: "-"},
+		{name: "join unknown mode", raw: `{"mode":"owner"}`, params: &JoinSessionParams{}, field: "mode"},
+
+		// Serial
+		{name: "connect", raw: `{"port":"/dev/ttyUSB0","stop_bits":1.5,"parity":"even"}`, params: &ConnectParams{}, field: "-"},
+		{name: "connect without port", raw: `{}`, params: &ConnectParams{}, field: "port", reason: "is required"},
+		{name: "connect data bits", raw: `{"port":"p","data_bits":9}`, params: &ConnectParams{}, field: "data_bits"},
+		{name: "connect stop bits", raw: `{"port":"p","stop_bits":3}`, params: &ConnectParams{}, field: "stop_bits"},
+		{name: "connect parity", raw: `{"port":"p","parity":"bogus"}`, params: &ConnectParams{}, field: "parity"},
+		{name: "connect flow control", raw: `{"port":"p","flow_control":"none"}`, params: &ConnectParams{}, field: "-"},
+		{name: "connect unsupported flow control", raw: `{"port":"p","flow_control":"rtscts"}`, params: &ConnectParams{}, field: "flow_control"},
+		{name: "connect detach grace", raw: `{"port":"p","detach_grace":-1}`, params: &ConnectParams{}, field: "detach_grace"},
+		{name: "connect zero detach grace", raw: `{"port":"p","detach_grace":0}`, params: &ConnectParams{}, field: "-"},
+
+		// SSH
+		{name: "ssh", raw: `{"host":"h","auth_methods":["agent","publickey","password"]}`, params: &ConnectSSHParams{}, field: "-"},
+		{name: "ssh alias", raw: `{"host_alias":"h"}`, params: &ConnectSSHParams{}, field: "-"},
+		{name: "ssh without host", raw: `{}`, params: &ConnectSSHParams{}, field: "host"},
+		{name: "ssh port", raw: `{"host":"h","port":70000}`, params: &ConnectSSHParams{}, field: "port"},
+		{name: "ssh auth method", raw: `{"host":"h","auth_method":"magic"}`, params: &ConnectSSHParams{}, field: "auth_method"},
+		{name: "ssh auth methods", raw: `{"host":"h","auth_methods":["password","magic"]}`, params: &ConnectSSHParams{}, field: "auth_methods.1"},
+		{name: "ssh split key methods", raw: `{"host":"h","auth_methods":["agent","password","publickey"]}`, params: &ConnectSSHParams{}, field: "auth_methods"},
+		{name: "ssh forward", raw: `{"host":"h","forwards":[{"type":"dynamic","listen_addr":"1080"}]}`, params: &ConnectSSHParams{}, field: "-"},
+		{name: "ssh forward target", raw: `{"host":"h","forwards":[{"type":"local","listen_addr":"8080"}]}`, params: &ConnectSSHParams{}, field: "forwards.0.target_addr"},
+		{name: "ssh jump host", raw: `{"host":"h","jump_hosts":[{"host":"j"},{"port":22}]}`, params: &ConnectSSHParams{}, field: "jump_hosts.1.host"},
+		{name: "ssh keepalive", raw: `{"host":"h","keepalive_interval":-5}`, params: &ConnectSSHParams{}, field: "keepalive_interval"},
+		{name: "duplicate", raw: `{"session_id":"s","cols":-1}`, params: &DuplicateSSHParams{}, field: "cols"},
+		{name: "attach ssh", raw: `{}`, params: &AttachSSHParams{}, field: "session_id"},
+		{name: "exec timeout", raw: `{"command":"ls","timeout":-1}`, params: &ExecSSHParams{}, field: "timeout"},
+
+		// Files and logging
+		{name: "send file", raw: `{}`, params: &SendFileParams{}, field: "data"},
+		{name: "start log", raw: `{"format":"hex","max_size":0,"max_files":0}`, params: &StartLogParams{}, field: "-"},
+		{name: "start log max size", raw: `{"max_size":-1}`, params: &StartLogParams{}, field: "max_size"},
+		{name: "start log max files", raw: `{"max_files":-1}`, params: &StartLogParams{}, field: "max_files"},
+		{name: "start log interval", raw: `{"rotate_interval":-1}`, params: &StartLogParams{}, field: "rotate_interval"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := DecodeParams(json.RawMessage(tt.raw), tt.params)
+			if tt.field == "-" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			var paramErr *ParamError
+			if !errors.As(err, &paramErr) {
+				t.Fatalf("error = %v, want a *ParamError", err)
+			}
+			if paramErr.Field != tt.field {
+				t.Errorf("field = %q, want %q (%v)", paramErr.Field, tt.field, err)
+			}
+			if tt.reason != "" && paramErr.Reason != tt.reason {
+				t.Errorf("reason = %q, want %q", paramErr.Reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestDecodeParamsWithoutValidator(t *testing.T) {
+	var params SetEncodingParams
+	if err := DecodeParams(json.RawMessage(`{"encoding":"binary"}`), &params); err != nil {
+		t.Fatal(err)
+	}
+	if params.Encoding != EncodingBinary {
+		t.Errorf("encoding = %q, want %q", params.Encoding, EncodingBinary)
+	}
+}
+
+func TestParamErrorMessage(t *testing.T) {
+	if got := (&ParamError{Field: "cols", Reason: "must be positive"}).Error(); got != "cols: must be positive" {
+		t.Errorf("Error() = %q", got)
+	}
+	if got := (&ParamError{Reason: "invalid params"}).Error(); got != "invalid params" {
+		t.Errorf("Error() = %q", got)
+	}
+}
@@ -208,8 +208,6 @@ export function PortSelector({ onConnect, onDisconnect, connected, onSaveAsProfi
             className="bg-[#3c3c3c] text-slate-200 border border-[#555] px-2 py-2 rounded text-sm disabled:opacity-50 disabled:cursor-not-allowed focus:outline-none focus:border-primary focus:ring-1 focus:ring-primary"
           >
             <option value="none">None</option>
-            <option value="rtscts">RTS/CTS</option>
-            <option value="xonxoff">XON/XOFF</option>
           </select>
         </div>
 
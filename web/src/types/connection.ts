@@ -1,16 +1,33 @@
 import type { SerialConfig } from './serial';
 
 export interface SSHConfig {
+  host_alias?: string; // Host alias from ~/.ssh/config
   host: string;
   port: number;
   username: string;
-  auth_method: 'password' | 'publickey';
+  auth_method: 'password' | 'publickey' | 'agent';
+  auth_methods?: ('password' | 'publickey' | 'agent' | 'keyboard-interactive')[];
   password?: string;
   private_key?: string;
-  private_key_path?: string;
   private_key_passphrase?: string;
+  forward_agent?: boolean;
+  certificate?: string;
+  host_cert_authorities?: string[];
+  jump_hosts?: Partial<SSHConfig>[]; // Dialed in order before the target
+  ciphers?: string[]; // A leading "+", "-" or "^" adjusts the defaults
+  key_exchanges?: string[];
+  macs?: string[];
+  host_key_algorithms?: string[];
+  terminal_type?: string;
+  terminal_modes?: Record<string, number>; // e.g. { VERASE: 127 }
+  env?: Record<string, string>;
   cols?: number;
   rows?: number;
+  keepalive_interval?: number; // Seconds, 0 disables keepalives
+  keepalive_count_max?: number;
+  auto_reconnect?: boolean;
+  reconnect_max_attempts?: number; // 0 retries until closed
+  reconnect_max_delay?: number; // Seconds
 }
 
 // Discriminated union for type-safe configs
@@ -1,9 +1,19 @@
-export type MessageType = 'data' | 'control' | 'status' | 'error' | 'file_transfer';
+export type MessageType =
+  | 'data'
+  | 'control'
+  | 'status'
+  | 'error'
+  | 'file_transfer'
+  | 'auth_prompt'
+  | 'auth_response'
+  | 'exec'
+  | 'hello';
 
 export interface WSMessage {
   type: MessageType;
   session_id?: string;
-  payload: DataPayload | ControlPayload | StatusPayload | ErrorPayload;
+  request_id?: string; // Echoed in the replies to a request
+  payload: DataPayload | ControlPayload | StatusPayload | ErrorPayload | HelloPayload;
   timestamp: number;
 }
 
@@ -12,19 +22,66 @@ export interface DataPayload {
   encoding: 'raw' | 'base64';
 }
 
+// Data message encoding negotiated with the 'set_encoding' action. In binary
+// mode, terminal data travels as binary frames:
+// [type: 1 byte][session ID length: 1 byte][session ID][payload]
+export type DataEncoding = 'json' | 'binary';
+
+export const FRAME_TYPE_DATA = 0x01;
+
 export interface ControlPayload {
-  action: 'connect' | 'connect_ssh' | 'attach_ssh' | 'disconnect' | 'resize' | 'send_file' | 'receive_file';
+  action:
+    | 'open_session'
+    | 'attach_session'
+    | 'join_session'
+    | 'close_session'
+    | 'connect'
+    | 'connect_ssh'
+    | 'attach_ssh'
+    | 'duplicate_ssh'
+    | 'exec_ssh'
+    | 'set_encoding'
+    | 'disconnect'
+    | 'resize'
+    | 'send_file'
+    | 'receive_file'
+    | 'start_log'
+    | 'stop_log';
   params?: Record<string, unknown>;
 }
 
+export type SubscriberRole = 'owner' | 'writer' | 'observer';
+
 export interface StatusPayload {
-  state: 'connected' | 'disconnected' | 'connecting' | 'error' | 'ready';
+  state: 'connected' | 'disconnected' | 'connecting' | 'reconnecting' | 'error' | 'ready' | 'encoding' | 'closed' | 'attached' | 'detached' | 'joined' | 'left' | 'negotiated' | 'logging' | 'log_stopped';
   message?: string;
+  reason?: string; // Why a connection was lost
+  offset?: number; // Output offset a session's replay starts at
+  subscriber?: string; // WebSocket that joined or left a shared session
+  role?: SubscriberRole;
+  exit_code?: number; // How a remote process ended
+  exit_signal?: string;
 }
 
 export interface ErrorPayload {
   code: string;
   message: string;
+  action?: string; // Control action that failed
+  field?: string; // Param that failed validation
+  supported?: string[]; // Values the server accepts instead
+}
+
+// Exchanged when a WebSocket opens to agree on a protocol version. Once the
+// client sends one, only what both hellos list may be used.
+export interface HelloPayload {
+  version: number;
+  min_version?: number;
+  software?: string;
+  transports?: string[];
+  file_transfers?: string[];
+  encodings?: string[];
+  log_formats?: string[];
+  actions?: string[];
 }
 
 export interface FileTransferPayload {
@@ -36,3 +93,28 @@ export interface FileTransferPayload {
   message?: string;
   error?: string;
 }
+
+export interface AuthPromptPayload {
+  prompt_id: string;
+  user?: string;
+  instruction?: string;
+  questions: { prompt: string; echo: boolean }[];
+  timeout: number; // Seconds until the prompt expires
+}
+
+export interface AuthResponsePayload {
+  prompt_id: string;
+  answers: string[];
+  cancel?: boolean;
+}
+
+export interface ExecPayload {
+  exec_id: string;
+  stream?: 'stdout' | 'stderr';
+  data?: string; // Base64 encoded
+  done?: boolean; // Set on the final message
+  exit_code?: number;
+  exit_signal?: string;
+  error?: string;
+  truncated?: boolean; // Output exceeded 1 MiB per stream and was cut off
+}
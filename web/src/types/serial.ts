@@ -4,7 +4,7 @@ export interface SerialConfig {
   data_bits: 5 | 6 | 7 | 8;
   stop_bits: 1 | 1.5 | 2;
   parity: 'none' | 'odd' | 'even' | 'mark' | 'space';
-  flow_control: 'none' | 'rtscts' | 'xonxoff';
+  flow_control: 'none'; // Hardware and software flow control aren't supported
 }
 
 export interface PortInfo {